@@ -0,0 +1,72 @@
+package main
+
+///////////////////////////////////////////////////////////////////////////////
+// ESB bridge emulator
+//
+// Console application which emulates an esb-bridge device on a pseudo terminal. The printed device path can be
+// passed to the server instead of a real device, e.g. `server -d /dev/pts/3`
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+)
+
+var opts struct {
+	FwVersion   string        `name:"fw-version" default:"1.0.0" help:"Firmware version reported by the emulated device (default: 1.0.0)"`
+	Latency     time.Duration `name:"latency" default:"0s" help:"Delay of every answer of the emulated device (e.g. 5ms)"`
+	AckLoss     float64       `name:"ack-loss" default:"0" help:"Probability (0.0 - 1.0) that a message to a peripheral is not acknowledged"`
+	Peripherals []string      `short:"p" name:"peripheral" help:"Pipeline address of an echoing peripheral (e.g. 111.111.111.111.1), can be repeated"`
+	Scenario    string        `short:"s" name:"scenario" help:"JSON file describing the emulated device and its peripherals"`
+}
+
+func main() {
+	kong.Parse(&opts)
+
+	e := emulator.New()
+
+	_, err := fmt.Sscanf(opts.FwVersion, "%d.%d.%d", &e.FwVersion[0], &e.FwVersion[1], &e.FwVersion[2])
+	if err != nil {
+		log.Fatalf("Invalid firmware version %q: %v", opts.FwVersion, err)
+	}
+	e.Latency = opts.Latency
+
+	for _, p := range opts.Peripherals {
+		addr, err := esbbridge.ParseAddress(p)
+		if err != nil {
+			log.Fatalf("Invalid peripheral: %v", err)
+		}
+		e.AddPeripheral(&emulator.Peripheral{Address: addr, AckLoss: opts.AckLoss})
+	}
+
+	if opts.Scenario != "" {
+		scenario, err := emulator.LoadScenario(opts.Scenario)
+		if err != nil {
+			log.Fatalf("Could not load scenario: %v", err)
+		}
+		if err := scenario.Apply(e); err != nil {
+			log.Fatalf("Invalid scenario: %v", err)
+		}
+	}
+	defer e.Close()
+
+	pty, err := e.OpenPty()
+	if err != nil {
+		log.Fatalf("Could not create pseudo terminal: %v", err)
+	}
+	defer pty.Close()
+
+	log.Printf("Emulated esb-bridge device listening on %v", pty.Path)
+
+	// Wait here for a SIGINT (CTRL+C)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+}
@@ -0,0 +1,80 @@
+package main
+
+///////////////////////////////////////////////////////////////////////////////
+// ESB bridge MQTT bridge
+//
+// Console application which connects an esb-bridge RPC server to an MQTT broker. Incoming messages of the
+// configured pipeline addresses are published on the broker, transfers and sends can be requested over the broker.
+// See package pkg/mqttbridge for the topics
+//
+// Exit codes: 0 after a shutdown by SIGINT or SIGTERM, 1 if the bridge could not be started or failed while running
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alecthomas/kong"
+	"github.com/spritkopf/esb-bridge/pkg/client"
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	"github.com/spritkopf/esb-bridge/pkg/mqttbridge"
+)
+
+var opts struct {
+	Server      string   `short:"s" name:"server" default:"localhost:9815" help:"Address of the esb-bridge RPC server (default: localhost:9815)"`
+	TLSCA       string   `name:"tls-ca" help:"PEM encoded CA bundle to verify the RPC server, enables TLS"`
+	TLSCert     string   `name:"tls-cert" help:"PEM encoded client certificate for the RPC server"`
+	TLSKey      string   `name:"tls-key" help:"PEM encoded private key of the client certificate"`
+	Token       string   `name:"token" help:"Bearer token for the RPC server (requires TLS)"`
+	Broker      string   `short:"b" name:"broker" default:"tcp://localhost:1883" help:"Address of the MQTT broker (default: tcp://localhost:1883)"`
+	ClientID    string   `name:"client-id" help:"MQTT client ID (default: esb-bridge)"`
+	Username    string   `name:"username" help:"MQTT user name"`
+	Password    string   `name:"password" help:"MQTT password"`
+	TopicPrefix string   `name:"topic-prefix" help:"First level of all MQTT topics (default: esb)"`
+	Addresses   []string `short:"a" name:"addr" help:"Pipeline address to publish incoming messages of (e.g. 111.111.111.111.1), can be repeated (default: all addresses)"`
+}
+
+func main() {
+	kong.Parse(&opts)
+
+	cfg := mqttbridge.Config{
+		Broker:      opts.Broker,
+		ClientID:    opts.ClientID,
+		Username:    opts.Username,
+		Password:    opts.Password,
+		TopicPrefix: opts.TopicPrefix,
+	}
+	for _, a := range opts.Addresses {
+		addr, err := esbbridge.ParseAddress(a)
+		if err != nil {
+			log.Printf("Invalid address: %v", err)
+			os.Exit(1)
+		}
+		cfg.Addresses = append(cfg.Addresses, addr[:])
+	}
+
+	esb := &client.EsbClient{TLSCA: opts.TLSCA, TLSCert: opts.TLSCert, TLSKey: opts.TLSKey, Token: opts.Token}
+	if err := esb.Connect(opts.Server); err != nil {
+		log.Printf("Error connecting to the esb-bridge server: %v", err)
+		os.Exit(1)
+	}
+	defer esb.Disconnect()
+
+	// Stop on SIGINT (CTRL+C) or SIGTERM
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		log.Printf("Received %v, shutting down", <-sig)
+		cancel()
+	}()
+
+	if err := mqttbridge.New(cfg, esb).Run(ctx); err != nil {
+		log.Printf("MQTT bridge stopped with error: %v", err)
+		esb.Disconnect()
+		os.Exit(1)
+	}
+	log.Printf("MQTT bridge stopped")
+}
@@ -4,31 +4,91 @@ package main
 // ESB bridge server
 //
 // Console application to start the esb-bridge RPC server
+//
+// Exit codes: 0 after a shutdown by SIGINT or SIGTERM, 1 if the server could not be started or failed while running
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kong"
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
 	"github.com/spritkopf/esb-bridge/pkg/server"
 )
 
 var opts struct {
-	Verbose bool   `short:"v" help:"Additional output"`
-	Port    uint   `short:"p" name:"port" default:"9815" help:"TCP port to listen on (default: 9815)"`
-	Device  string `short:"d" name:"device" help:"Serial port of the esb-bridge device (e.g. /dev/ttyACM0)"`
+	Verbose         bool          `short:"v" help:"Additional output"`
+	Port            uint          `short:"p" name:"port" help:"TCP port to listen on all interfaces (default: 9815), shorthand for --listen :<port>"`
+	Listen          []string      `short:"l" name:"listen" help:"Address to listen on: host:port, [ipv6]:port or unix:///path/to/socket, can be repeated"`
+	Device          string        `short:"d" name:"device" help:"Serial port of the esb-bridge device (e.g. /dev/ttyACM0)"`
+	ShutdownTimeout time.Duration `name:"shutdown-timeout" default:"10s" help:"Time running requests get to finish on shutdown (default: 10s)"`
+	TLSCert         string        `name:"tls-cert" help:"PEM encoded server certificate, enables TLS (requires --tls-key)"`
+	TLSKey          string        `name:"tls-key" help:"PEM encoded private key of the server certificate"`
+	TLSClientCA     string        `name:"tls-client-ca" help:"PEM encoded CA bundle, clients must present a certificate signed by one of these CAs"`
+	HTTPListen      string        `name:"http" help:"Address of the HTTP/JSON gateway, e.g. :8080 (disabled by default)"`
+	Policy          string        `name:"policy" help:"JSON file which maps client identities (token or certificate name) to allowed RPCs, addresses and commands"`
+	MetricsListen   string        `name:"metrics" help:"Address of the Prometheus /metrics endpoint, e.g. :9816 (disabled by default)"`
+	ListenQueue     int           `name:"listen-queue" help:"Incoming messages queued per Listen stream for slow clients (default: 16)"`
+	ListenOverflow  string        `name:"listen-overflow" default:"drop-oldest" enum:"drop-oldest,drop-newest,disconnect" help:"What happens to incoming messages while the queue of a slow client is full: drop-oldest, drop-newest or disconnect"`
 }
 
 func main() {
 	kong.Parse(&opts)
 
-	cancel, err := server.Start(opts.Device, opts.Port)
-	defer cancel()
+	cfg := server.Config{
+		Device:          opts.Device,
+		Listen:          opts.Listen,
+		ShutdownTimeout: opts.ShutdownTimeout,
+		TLSCert:         opts.TLSCert,
+		TLSKey:          opts.TLSKey,
+		TLSClientCA:     opts.TLSClientCA,
+		HTTPListen:      opts.HTTPListen,
+		MetricsListen:   opts.MetricsListen,
+		ListenQueueSize: opts.ListenQueue,
+	}
+	if opts.Port != 0 {
+		cfg.Listen = append(cfg.Listen, fmt.Sprintf(":%v", opts.Port))
+	}
+	overflow, err := esbbridge.ParseOverflowPolicy(opts.ListenOverflow)
+	if err != nil {
+		log.Printf("Invalid --listen-overflow: %v", err)
+		os.Exit(1)
+	}
+	cfg.ListenOverflow = overflow
+	if opts.Policy != "" {
+		policy, err := server.LoadPolicy(opts.Policy)
+		if err != nil {
+			log.Printf("Error loading policy: %v", err)
+			os.Exit(1)
+		}
+		cfg.Policy = policy
+	}
 
+	s, err := server.New(cfg)
 	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		log.Printf("Error starting server: %v", err)
+		os.Exit(1)
 	}
 
-	for {
-		// Wait here for a SIGINT (CTRL+C)
+	// Shut down on SIGINT (CTRL+C) or SIGTERM, a second signal exits immediately
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		log.Printf("Received %v, shutting down", <-sig)
+		cancel()
+		log.Printf("Received %v, exiting", <-sig)
+		os.Exit(1)
+	}()
+
+	if err := s.Run(ctx); err != nil {
+		log.Printf("Server stopped with error: %v", err)
+		os.Exit(1)
 	}
+	log.Printf("Server stopped")
 }
@@ -4,11 +4,13 @@ go 1.15
 
 require (
 	github.com/alecthomas/kong v0.2.15
-	github.com/golang/protobuf v1.4.2
+	github.com/eclipse/paho.mqtt.golang v1.3.5
+	github.com/golang/protobuf v1.4.3
+	github.com/prometheus/client_golang v1.10.0
 	github.com/sigurn/crc16 v0.0.0-20160107003519-da416fad5162
 	github.com/sigurn/utils v0.0.0-20190728110027-e1fefb11a144 // indirect
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
-	golang.org/x/sys v0.0.0-20210124154548-22da62e12c0c // indirect
+	golang.org/x/sys v0.0.0-20210309074719-68d13333faf2 // indirect
 	google.golang.org/grpc v1.36.0
 	google.golang.org/protobuf v1.25.0
 )
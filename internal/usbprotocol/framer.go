@@ -0,0 +1,111 @@
+package usbprotocol
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/sigurn/crc16"
+)
+
+// Stats holds counters about the health of the link to the device
+type Stats struct {
+	// FramesIn is the number of valid packets received
+	FramesIn uint64
+	// FramesOut is the number of packets sent
+	FramesOut uint64
+	// Resyncs is the number of times the packet alignment was lost and the reader had to hunt for the next sync byte
+	Resyncs uint64
+	// CRCErrors is the number of discarded packets with a CRC mismatch
+	CRCErrors uint64
+	// LengthErrors is the number of discarded packets with an invalid payload length
+	LengthErrors uint64
+	// DroppedBytes is the number of bytes discarded while hunting for a sync byte
+	DroppedBytes uint64
+	// StaleAnswers is the number of discarded answers which arrived too late or had an unexpected command ID
+	StaleAnswers uint64
+}
+
+// framer reassembles packets from the byte stream of the transport. Reads from the transport need not be aligned
+// to packet boundaries, the framer buffers partial packets and skips garbage and corrupted packets by sliding forward
+// to the next sync byte
+type framer struct {
+	buf    []byte
+	synced bool   // true while the stream is aligned to packet boundaries
+	stats  *Stats // updated atomically, other goroutines read the counters
+}
+
+// push appends bytes received from the transport
+func (f *framer) push(data []byte) {
+	f.buf = append(f.buf, data...)
+}
+
+// next returns the next valid packet from the buffered data. Returns false if more data is needed
+func (f *framer) next() (Message, bool) {
+	for {
+		// hunt for the sync byte
+		i := 0
+		for i < len(f.buf) && f.buf[i] != syncByte {
+			i++
+		}
+		if i > 0 {
+			f.drop(i)
+		}
+
+		if len(f.buf) < packetSize {
+			// wait for the rest of the packet
+			return Message{}, false
+		}
+
+		payloadLen := int(f.buf[idxlen])
+		if payloadLen > MaxPayloadLen {
+			atomic.AddUint64(&f.stats.LengthErrors, 1)
+			f.drop(1)
+			continue
+		}
+
+		crcCalc := crc16.Checksum(f.buf[:packetSize-2], crcTable)
+		crcRx := binary.LittleEndian.Uint16(f.buf[packetSize-2 : packetSize])
+		if crcCalc != crcRx {
+			atomic.AddUint64(&f.stats.CRCErrors, 1)
+			f.drop(1)
+			continue
+		}
+
+		msg := Message{
+			Cmd:     CommandID(f.buf[idxCmd]),
+			Err:     f.buf[idxErr],
+			Payload: make([]byte, payloadLen)}
+		copy(msg.Payload, f.buf[idxPayload:])
+
+		// move the remaining bytes to the front, so the buffer does not grow forever
+		f.buf = f.buf[:copy(f.buf, f.buf[packetSize:])]
+		f.synced = true
+		atomic.AddUint64(&f.stats.FramesIn, 1)
+
+		return msg, true
+	}
+}
+
+// drop discards n bytes at the beginning of the buffer
+func (f *framer) drop(n int) {
+	if f.synced {
+		atomic.AddUint64(&f.stats.Resyncs, 1)
+		f.synced = false
+	}
+	atomic.AddUint64(&f.stats.DroppedBytes, uint64(n))
+
+	f.buf = f.buf[:copy(f.buf, f.buf[n:])]
+}
+
+// load returns a copy of the atomically updated counters
+func (s *Stats) load() Stats {
+	return Stats{
+		FramesIn:     atomic.LoadUint64(&s.FramesIn),
+		FramesOut:    atomic.LoadUint64(&s.FramesOut),
+		Resyncs:      atomic.LoadUint64(&s.Resyncs),
+		CRCErrors:    atomic.LoadUint64(&s.CRCErrors),
+		LengthErrors: atomic.LoadUint64(&s.LengthErrors),
+		DroppedBytes: atomic.LoadUint64(&s.DroppedBytes),
+		StaleAnswers: atomic.LoadUint64(&s.StaleAnswers),
+	}
+}
@@ -0,0 +1,111 @@
+package usbprotocol
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// collect pushes the chunks into a framer and returns all decoded packets
+func collect(f *framer, chunks ...[]byte) []Message {
+	var msgs []Message
+	for _, c := range chunks {
+		f.push(c)
+		for {
+			msg, ok := f.next()
+			if !ok {
+				break
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// TestFramerPartialReads tests that packets split over several reads are reassembled
+func TestFramerPartialReads(t *testing.T) {
+	f := framer{stats: &Stats{}}
+	p1 := encodePacket(Message{Cmd: CmdTest, Payload: []byte{1, 2, 3}})
+	p2 := encodePacket(Message{Cmd: CmdRx, Payload: []byte{4}})
+	stream := append(p1, p2...)
+
+	msgs := collect(&f, stream[:10], stream[10:63], stream[63:100], stream[100:])
+
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 packets, got %v", len(msgs))
+	}
+	if msgs[0].Cmd != CmdTest || !bytes.Equal(msgs[0].Payload, []byte{1, 2, 3}) || msgs[1].Cmd != CmdRx {
+		t.Fatalf("Unexpected packets: %v", msgs)
+	}
+	if s := f.stats.load(); s.FramesIn != 2 || s.DroppedBytes != 0 || s.Resyncs != 0 {
+		t.Fatalf("Unexpected stats: %+v", s)
+	}
+}
+
+// TestFramerResync tests that the framer recovers from stray bytes and corrupted packets
+func TestFramerResync(t *testing.T) {
+	f := framer{stats: &Stats{}}
+	p1 := encodePacket(Message{Cmd: CmdTest, Payload: []byte{1}})
+	corrupted := encodePacket(Message{Cmd: CmdTest, Payload: []byte{2}})
+	corrupted[10] ^= 0xFF
+	badLen := encodePacket(Message{Cmd: CmdTest})
+	badLen[idxlen] = MaxPayloadLen + 1
+	p2 := encodePacket(Message{Cmd: CmdTest, Payload: []byte{3}})
+
+	var stream []byte
+	stream = append(stream, p1...)
+	stream = append(stream, 0x00, syncByte, 0x42) // stray bytes, including a sync byte
+	stream = append(stream, corrupted...)
+	stream = append(stream, badLen...)
+	stream = append(stream, p2...)
+
+	msgs := collect(&f, stream)
+
+	if len(msgs) != 2 || msgs[0].Payload[0] != 1 || msgs[1].Payload[0] != 3 {
+		t.Fatalf("Unexpected packets: %v", msgs)
+	}
+	s := f.stats.load()
+	if s.Resyncs != 1 {
+		t.Fatalf("Expected 1 resync, got %+v", s)
+	}
+	if s.DroppedBytes != 3+packetSize+packetSize {
+		t.Fatalf("Expected %v dropped bytes, got %+v", 3+2*packetSize, s)
+	}
+	if s.CRCErrors < 1 || s.LengthErrors < 1 {
+		t.Fatalf("Expected CRC and length errors, got %+v", s)
+	}
+}
+
+// TestReaderResync tests that a connection keeps working after garbage was received
+func TestReaderResync(t *testing.T) {
+	host, dev := net.Pipe()
+	var c Conn
+	if err := c.OpenTransport(host); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	lc := make(chan Message, 1)
+	c.AddListener(CmdIrq, lc)
+
+	go func() {
+		dev.Write([]byte{0x01, syncByte, 0x02})
+		packet := encodePacket(Message{Cmd: CmdIrq, Payload: []byte{7}})
+		dev.Write(packet[:20])
+		dev.Write(packet[20:])
+	}()
+
+	select {
+	case msg := <-lc:
+		if !bytes.Equal(msg.Payload, []byte{7}) {
+			t.Fatalf("Unexpected message payload: %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout, no message was received")
+	}
+
+	if s := c.Stats(); s.FramesIn != 1 || s.DroppedBytes != 3 {
+		t.Fatalf("Unexpected stats: %+v", s)
+	}
+}
@@ -0,0 +1,97 @@
+package usbprotocol
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// transaction is a request waiting for its answer. Only one transaction may be in flight per connection, because
+// the firmware answers without any request tag and the answer can only be matched by its command ID
+type transaction struct {
+	cmd      CommandID
+	slot     chan struct{} // the transaction slot of the connection, released by end()
+	answer   chan Message  // receives the matching answer, buffered
+	mismatch chan struct{} // closed when an answer with a different command ID was received
+}
+
+// begin waits until no other transaction is in flight on the slot and registers a new one for the command.
+// Fails if ctx is done or the connection is closed before
+func (c *Conn) begin(ctx context.Context, slot chan struct{}, cmd CommandID, done <-chan struct{}) (*transaction, error) {
+	// select picks a random ready case, a free slot must not win over a context which is done already
+	if ctx.Err() != nil {
+		return nil, contextError(ctx)
+	}
+	select {
+	case slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, contextError(ctx)
+	case <-done:
+		return nil, ErrSerial
+	}
+
+	tx := &transaction{cmd: cmd, slot: slot, answer: make(chan Message, 1), mismatch: make(chan struct{})}
+
+	c.pendingMutex.Lock()
+	c.pending = tx
+	c.pendingMutex.Unlock()
+
+	return tx, nil
+}
+
+// end finishes the transaction and allows the next one to begin
+func (c *Conn) end(tx *transaction) {
+	c.pendingMutex.Lock()
+	if c.pending == tx {
+		c.pending = nil
+	}
+	c.pendingMutex.Unlock()
+
+	<-tx.slot
+}
+
+// drain keeps a failed transaction open in the background until its late answer arrived or the drain period is
+// over. This way a late answer is discarded instead of being taken as answer to the next request
+func (c *Conn) drain(tx *transaction, d time.Duration, closed <-chan struct{}) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-tx.answer:
+		atomic.AddUint64(&c.stats.StaleAnswers, 1)
+	case <-timer.C:
+	case <-closed:
+	}
+
+	c.end(tx)
+}
+
+// dispatchAnswer passes an incoming answer to the transaction in flight. Answers which do not belong to it are dropped
+func (c *Conn) dispatchAnswer(msg Message) {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+
+	tx := c.pending
+	if tx != nil && tx.cmd == msg.Cmd {
+		c.pending = nil
+		tx.answer <- msg
+		return
+	}
+
+	atomic.AddUint64(&c.stats.StaleAnswers, 1)
+	if tx != nil {
+		select {
+		case <-tx.mismatch:
+		default:
+			close(tx.mismatch)
+		}
+	}
+}
+
+// contextError returns the error for a done context, an expired deadline is reported as ErrTimeout
+func contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return ctx.Err()
+}
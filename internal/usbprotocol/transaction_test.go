@@ -0,0 +1,180 @@
+package usbprotocol
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+)
+
+// TestConcurrentTransfers tests that concurrent transfers each receive their own answer
+func TestConcurrentTransfers(t *testing.T) {
+	var c Conn
+	if err := c.OpenTransport(emulator.New().Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i byte) {
+			defer wg.Done()
+			for j := byte(0); j < 10; j++ {
+				payload := []byte{i, j}
+				answer, err := c.Transfer(Message{Cmd: CmdTest, Payload: payload})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(answer.Payload, payload) {
+					errs <- fmt.Errorf("transfer %v received answer %v", payload, answer.Payload)
+					return
+				}
+			}
+		}(byte(i))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+// TestLateAnswer tests that an answer arriving after the timeout is not taken as answer to the next transfer
+func TestLateAnswer(t *testing.T) {
+	e := emulator.New()
+	e.Latency = 300 * time.Millisecond
+
+	c := Conn{TimeoutMillis: 100}
+	if err := c.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err := c.Transfer(Message{Cmd: CmdTest, Payload: []byte{1}})
+	if err != ErrTimeout {
+		t.Fatalf("Expected ErrTimeout, got %v", err)
+	}
+
+	c.TimeoutMillis = 1000
+	answer, err := c.Transfer(Message{Cmd: CmdTest, Payload: []byte{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(answer.Payload, []byte{2}) {
+		t.Fatalf("Received answer of the previous transfer: %v", answer.Payload)
+	}
+	if s := c.Stats(); s.StaleAnswers != 1 {
+		t.Fatalf("Expected 1 stale answer, got %+v", s)
+	}
+}
+
+// TestTransferContext tests that transfers give up when the context is canceled or its deadline expires, also
+// while waiting for another transfer
+func TestTransferContext(t *testing.T) {
+	e := emulator.New()
+
+	var c Conn
+	if err := c.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	e.DropAnswers(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.TransferContext(ctx, Message{Cmd: CmdTest}); err != ErrTimeout {
+		t.Fatalf("Expected ErrTimeout, got %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("Transfer returned after %v, the deadline of the context should be used", d)
+	}
+
+	// the first transfer is still draining, the next one waits for it
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := c.TransferContext(ctx, Message{Cmd: CmdTest}); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	answer, err := c.TransferContext(context.Background(), Message{Cmd: CmdTest, Payload: []byte{3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(answer.Payload, []byte{3}) {
+		t.Fatalf("Unexpected answer: %v", answer.Payload)
+	}
+}
+
+// TestTransferContextTimeout tests that a context with a later deadline does not extend the wait for a lost answer
+// beyond TimeoutMillis
+func TestTransferContextTimeout(t *testing.T) {
+	e := emulator.New()
+
+	c := Conn{TimeoutMillis: 100}
+	if err := c.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	e.DropAnswers(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.TransferContext(ctx, Message{Cmd: CmdTest}); err != ErrTimeout {
+		t.Fatalf("Expected ErrTimeout, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Transfer returned after %v, TimeoutMillis should be used", d)
+	}
+}
+
+// TestCloseDuringTransfers tests that closing the connection lets the running and waiting transfers fail
+func TestCloseDuringTransfers(t *testing.T) {
+	e := emulator.New()
+	e.Latency = 20 * time.Millisecond
+
+	var c Conn
+	if err := c.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := c.Transfer(Message{Cmd: CmdTest}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != ErrSerial {
+			t.Fatalf("Expected ErrSerial, got %v", err)
+		}
+	}
+	if _, err := c.Transfer(Message{Cmd: CmdTest}); err != ErrSerial {
+		t.Fatalf("Expected ErrSerial after Close(), got %v", err)
+	}
+}
@@ -1,9 +1,15 @@
 package usbprotocol
 
 import (
-	"encoding/binary"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sigurn/crc16"
@@ -21,7 +27,10 @@ const MaxPayloadLen = packetSize - 4 - 2
 const DefaultTimeout = 1200
 
 // sync byte, marks the beginning of a new packet
-const sync = 0x69
+const syncByte = 0x69
+
+// tcpPrefix marks a device string as network address of a serial-over-TCP server (e.g. ser2net)
+const tcpPrefix = "tcp://"
 
 const idxSync = 0
 const idxCmd = 1
@@ -48,6 +57,12 @@ var ErrTimeout = UsbError{4, errors.New("ErrTimeout: Timeout while waiting for a
 // ErrParam is returned when a passed parameter is invalid
 var ErrParam = UsbError{5, errors.New("ErrParam: Invalid Parameter")}
 
+// ErrDeviceLost - The connection to the device was lost (unplugged, reset or remote end closed)
+var ErrDeviceLost = UsbError{6, errors.New("ErrDeviceLost: Connection to the device was lost")}
+
+// ErrOpen is returned when a connection is opened which is open already
+var ErrOpen = UsbError{7, errors.New("ErrOpen: Connection is already open")}
+
 // UsbError is the general Error type for this package.
 // Member ErrCode is the specific error code to tell them apart
 type UsbError struct {
@@ -69,6 +84,8 @@ const (
 	CmdIrq CommandID = 0x80
 	// CmdRx - Rx callback, for async messages from peripheral -> central
 	CmdRx CommandID = 0x81
+	// CmdRxRadio - Rx callback with radio metadata, sent instead of CmdRx by newer firmware
+	CmdRxRadio CommandID = 0x82
 )
 
 // Message represents a message which is sent between host and device
@@ -76,24 +93,67 @@ type Message struct {
 	Cmd     CommandID
 	Err     uint8
 	Payload []byte
+	// Seq and Time are set for received messages: Seq numbers the received messages in the order of their arrival,
+	// see Sequence, Time is the time of arrival
+	Seq  uint64
+	Time time.Time
+}
+
+// Sequence numbers the received messages of one or more connections. Shared by the connections to the same device,
+// the numbers keep increasing when the device is reopened
+type Sequence struct {
+	n uint64 // first member, atomic counter must be 64 bit aligned on 32 bit platforms
 }
 
 type listenerChannel chan<- Message // listenerChannel is send-only
 
+// serialPort is a serial port opened by Open()
+type serialPort struct {
+	*serial.Port
+	name string // device path, used to detect a disappeared device
+}
+
 type listener struct {
 	cmd     CommandID
 	channel listenerChannel
+	removed chan struct{} // closed when the listener is removed, cancels a blocked send
+}
+
+// Conn is a connection to an esb-bridge device. It owns the transport, the reader goroutine and the registered
+// listeners. The zero value is a closed connection, call Open() or OpenTransport() before use
+type Conn struct {
+	stats Stats // first member, atomic counters must be 64 bit aligned on 32 bit platforms
+	// ownSequence numbers the received messages if Sequence is nil
+	ownSequence Sequence
+	listenerSeq uint64 // sequence number of the last message passed on to the listeners, atomic
+
+	// TimeoutMillis is the timeout in milliseconds used when waiting for an answer in Transfer().
+	// If set to 0, DefaultTimeout is used
+	TimeoutMillis uint32
+	// Sequence numbers the received messages, set it before opening the connection. If nil, the connection numbers
+	// its messages on its own
+	Sequence *Sequence
+
+	mu     sync.Mutex // protects port, closed, done and txSlot, which are replaced by OpenTransport() and Close()
+	port   io.ReadWriteCloser
+	closed chan struct{} // closed when the port is closed, stops the reader goroutine
+	done   chan struct{} // closed when the reader goroutine stopped, after closing the port or losing the device
+	err    error         // reason of a lost connection, set before done is closed
+
+	listenersMutex sync.Mutex // protects listeners
+	listeners      []listener // Stores callback channels associated to command IDs to listen for
+
+	txSlot       chan struct{} // holds a token while a transaction is in flight, serializes the transfers
+	pendingMutex sync.Mutex    // protects pending
+	pending      *transaction  // transaction waiting for its answer from the reader goroutine
 }
 
 /////////////////////////////
 // Package variables (private)
 /////////////////////////////
 var crcTable *crc16.Table
-var port *serial.Port
 
-var rxChannel chan Message  // Used to pass incoming serial messages from the readerThread to the receive goroutine
-var ansChannel chan Message // Used to pass incoming serial messages as answer from the the receive goroutine to the transfer function
-var listeners []listener    // Stores callback channels associated to command IDs to listen for
+var defaultConn Conn // connection used by the package level API
 
 /////////////////////////////
 // Package API (public)
@@ -102,151 +162,426 @@ var listeners []listener    // Stores callback channels associated to command ID
 // TimeoutMillis is the timeout in milliseconds used when waiting for an answer in Transfer()
 var TimeoutMillis uint32 = DefaultTimeout
 
-// Open connects to the specified virtual COM port
-// The parameter 'device' holds the name of the device to connect to, i.e. '/dev/ttyACM0'
+// Open connects the default connection to the specified virtual COM port, see Conn.Open()
 func Open(device string) error {
-	var err error
-	// Open port in mode 115200_N81
-	c := &serial.Config{Name: device, Baud: 115200, ReadTimeout: time.Millisecond * 500}
-	port, err = serial.OpenPort(c)
+	return defaultConn.Open(device)
+}
+
+// OpenTransport connects the default connection over an already opened transport, see Conn.OpenTransport()
+func OpenTransport(t io.ReadWriteCloser) error {
+	return defaultConn.OpenTransport(t)
+}
+
+// Close closes the default connection
+func Close() {
+	defaultConn.Close()
+}
 
-	if err == nil {
-		// Start reader goroutine, which sends incoming messages on rxChannel
-		rxChannel = make(chan Message)
-		ansChannel = make(chan Message)
+// Transfer sends a message to the usb device over the default connection and returns the answer, see Conn.Transfer()
+func Transfer(msg Message) (Message, error) {
+	return defaultConn.transfer(context.Background(), msg, TimeoutMillis)
+}
 
-		go serialReaderThread()
+// TransferContext sends a message to the usb device over the default connection and returns the answer,
+// see Conn.TransferContext()
+func TransferContext(ctx context.Context, msg Message) (Message, error) {
+	return defaultConn.transfer(ctx, msg, TimeoutMillis)
+}
+
+// AddListener adds a listenener for the provided command to the default connection, see Conn.AddListener()
+func AddListener(cmd CommandID, c listenerChannel) error {
+	return defaultConn.AddListener(cmd, c)
+}
+
+// RemoveListener removes the listeners of a channel from the default connection, see Conn.RemoveListener()
+func RemoveListener(c listenerChannel) int {
+	return defaultConn.RemoveListener(c)
+}
+
+// GetStats returns the link counters of the default connection, see Conn.Stats()
+func GetStats() Stats {
+	return defaultConn.Stats()
+}
+
+// Open connects to the specified virtual COM port
+// The parameter 'device' holds the name of the device to connect to, i.e. '/dev/ttyACM0'.
+// Device strings starting with "tcp://" (e.g. 'tcp://localhost:3333') connect to a serial-over-TCP server like ser2net
+func (c *Conn) Open(device string) error {
+	t, err := openDevice(device)
+	if err != nil {
+		return err
 	}
 
-	return err
+	if err := c.OpenTransport(t); err != nil {
+		t.Close()
+		return err
+	}
+	return nil
 }
 
-// Close closes the connection to any opened virtual COM port
-func Close() {
+// OpenTransport uses an already opened transport (a serial port, a pty, a TCP socket, an in-memory pipe, ...) as
+// connection to the device. The transport is closed by Close(). Returns ErrOpen if the connection is open already,
+// also after the device was lost it must be closed before it is opened again
+func (c *Conn) OpenTransport(t io.ReadWriteCloser) error {
+	if t == nil {
+		return ErrParam
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.port != nil {
+		return ErrOpen
+	}
+
+	c.port = t
+	c.closed = make(chan struct{})
+	c.done = make(chan struct{})
+	c.err = nil
+	c.txSlot = make(chan struct{}, 1)
+
+	// Start reader goroutine, which dispatches incoming messages to the listeners and the transfer function
+	go c.serialReaderThread(c.port, c.closed, c.done)
+
+	return nil
+}
+
+// Close closes the connection to the virtual COM port. All registered listeners are removed. Transfers in flight fail
+// with ErrSerial. Close returns after the reader goroutine stopped
+func (c *Conn) Close() {
+	c.mu.Lock()
+	port, closed, done := c.port, c.closed, c.done
+	c.port = nil
+	c.mu.Unlock()
+
 	if port != nil {
+		close(closed)
 		port.Close()
 	}
+
+	// removing the listeners unblocks the reader goroutine if it is sending to a listener
+	c.listenersMutex.Lock()
+	for _, l := range c.listeners {
+		close(l.removed)
+	}
+	c.listeners = nil
+	c.listenersMutex.Unlock()
+
+	if port != nil {
+		<-done
+	}
 }
 
-// Transfer sends a message to the usb device and returns the answer
+// Done returns a channel which is closed when the connection is closed or the device was lost, see Err()
+func (c *Conn) Done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.done
+}
+
+// Err returns the reason why the connection was lost (wrapping ErrDeviceLost) after Done() was closed.
+// Returns nil while the connection is open or if it was closed by Close()
+func (c *Conn) Err() error {
+	select {
+	case <-c.Done():
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Transfer sends a message to the usb device and returns the answer.
+// Concurrent transfers are serialized. If no answer arrives in time, ErrTimeout is returned and the next transfer
+// is delayed until the late answer was drained, but at most for the timeout or DefaultTimeout, whichever is longer.
+// Answers with an unexpected command ID are discarded and reported as ErrCmdMismatch
 //
 // Params:
 //   msg - The messge to be transmitted (payload can be nil for zero TX payload (request-only style commands))
 // Returns: answer message, error
-func Transfer(msg Message) (Message, error) {
-	if len(msg.Payload) > MaxPayloadLen {
-		return Message{}, ErrSize
+func (c *Conn) Transfer(msg Message) (Message, error) {
+	return c.transfer(context.Background(), msg, c.timeoutMillis())
+}
+
+// TransferContext sends a message to the usb device and returns the answer, like Transfer(). It waits for the answer
+// until the deadline of ctx or TimeoutMillis, whichever expires first, so a lost answer does not delay the other
+// transfers for longer than TimeoutMillis. If ctx is canceled, ctx.Err() is returned, an expired deadline is
+// reported as ErrTimeout
+func (c *Conn) TransferContext(ctx context.Context, msg Message) (Message, error) {
+	return c.transfer(ctx, msg, c.timeoutMillis())
+}
+
+// AddListener adds a listenener for the provided command. Any incoming message with this CommandID will
+// sent to the provided channel
+func (c *Conn) AddListener(cmd CommandID, ch listenerChannel) error {
+
+	if ch == nil {
+		return ErrParam
 	}
-	txBuf := make([]byte, packetSize)
 
-	txBuf[0] = sync
-	txBuf[1] = byte(msg.Cmd)
-	txBuf[2] = 0
+	c.listenersMutex.Lock()
+	c.listeners = append(c.listeners, listener{cmd: cmd, channel: ch, removed: make(chan struct{})})
+	c.listenersMutex.Unlock()
 
-	if msg.Payload == nil {
-		txBuf[3] = 0
-	} else {
-		txBuf[3] = byte(len(msg.Payload))
-		copy(txBuf[4:], msg.Payload[:])
+	return nil
+}
+
+// RemoveListener removes all listeners registered for the channel. A message which is being sent to the channel
+// while it is removed may still be delivered, but the reader goroutine does not block on the channel anymore.
+// Returns the number of removed listeners
+func (c *Conn) RemoveListener(ch listenerChannel) int {
+	c.listenersMutex.Lock()
+	defer c.listenersMutex.Unlock()
+
+	kept := c.listeners[:0]
+	for _, l := range c.listeners {
+		if l.channel == ch {
+			close(l.removed)
+		} else {
+			kept = append(kept, l)
+		}
 	}
+	removed := len(c.listeners) - len(kept)
+	c.listeners = kept
 
-	crc := crc16.Checksum(txBuf[:len(txBuf)-2], crcTable)
-	var h, l uint8 = uint8(crc & 0xff), uint8(crc >> 8)
-	txBuf[62] = byte(h)
-	txBuf[63] = byte(l)
+	return removed
+}
+
+// ListenerSeq returns the sequence number of the last received message passed on to the listeners. Messages are
+// passed on in the order of their arrival, so the listeners got all messages which arrived before an answer returned
+// by Transfer() when it returns
+func (c *Conn) ListenerSeq() uint64 {
+	return atomic.LoadUint64(&c.listenerSeq)
+}
+
+// Last returns the sequence number of the last received message, 0 if none was received
+func (s *Sequence) Last() uint64 {
+	return atomic.LoadUint64(&s.n)
+}
+
+// Stats returns the link counters of the connection. The counters are kept when the connection is closed and reopened
+func (c *Conn) Stats() Stats {
+	return c.stats.load()
+}
+
+//////////////////////////////
+// Internal functions (private)
+//////////////////////////////
+
+// timeoutMillis returns the timeout waiting for an answer
+func (c *Conn) timeoutMillis() uint32 {
+	if c.TimeoutMillis == 0 {
+		return DefaultTimeout
+	}
+	return c.TimeoutMillis
+}
+
+// transfer sends the message and waits for the answer until ctx is done or, if timeoutMillis is not 0, the timeout
+// expired
+func (c *Conn) transfer(ctx context.Context, msg Message, timeoutMillis uint32) (Message, error) {
+	if len(msg.Payload) > MaxPayloadLen {
+		return Message{}, ErrSize
+	}
+	// the port may be closed concurrently, writing to a closed port fails and done is closed
+	c.mu.Lock()
+	port, done, slot := c.port, c.done, c.txSlot
+	c.mu.Unlock()
+	if port == nil {
+		return Message{}, ErrSerial
+	}
+	txBuf := encodePacket(msg)
+
+	tx, err := c.begin(ctx, slot, msg.Cmd, done)
+	if err != nil {
+		return Message{}, err
+	}
 
 	// Send the message
 	bytesWritten, err := port.Write(txBuf)
 
 	if err != nil {
+		c.end(tx)
 		return Message{}, err
 	}
 
 	if bytesWritten != len(txBuf) {
+		c.end(tx)
 		return Message{}, ErrSerial
 	}
+	atomic.AddUint64(&c.stats.FramesOut, 1)
+
+	var timeout <-chan time.Time
+	if timeoutMillis > 0 {
+		timer := time.NewTimer(time.Duration(timeoutMillis) * time.Millisecond)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	drainPeriod := time.Duration(c.timeoutMillis()) * time.Millisecond
+	if timeoutMillis > c.timeoutMillis() {
+		drainPeriod = time.Duration(timeoutMillis) * time.Millisecond
+	}
+	if drainPeriod < DefaultTimeout*time.Millisecond {
+		drainPeriod = DefaultTimeout * time.Millisecond
+	}
 
 	// Wait for answer or Timeout
 	select {
-	case answer := <-ansChannel:
-		// check that answer actually matches request (cmdID)
-		if answer.Cmd != msg.Cmd {
-			// Answer command byte must be identical
-			return Message{}, ErrCmdMismatch
-		}
+	case answer := <-tx.answer:
+		c.end(tx)
 		return answer, nil
 
-	case <-time.After(time.Duration(TimeoutMillis) * time.Millisecond):
-		// timeout, flush port
+	case <-tx.mismatch:
+		// Answer command byte must be identical, the actual answer may still arrive
+		go c.drain(tx, drainPeriod, done)
+		return Message{}, ErrCmdMismatch
+
+	case <-timeout:
+		// timeout, drain a late answer
+		go c.drain(tx, drainPeriod, done)
 		return Message{}, ErrTimeout
+
+	case <-ctx.Done():
+		// the caller gave up, drain a late answer
+		go c.drain(tx, drainPeriod, done)
+		return Message{}, contextError(ctx)
+
+	case <-done:
+		c.end(tx)
+		if c.err != nil {
+			return Message{}, ErrDeviceLost
+		}
+		return Message{}, ErrSerial
 	}
 
 }
 
-// AddListener adds a listenener for the provided command. Any incoming message with this CommandID will
-// sent to the provided channel
-func AddListener(cmd CommandID, c listenerChannel) error {
+// encodePacket builds the 64 byte USB packet (sync, header, payload, crc) for a message
+func encodePacket(msg Message) []byte {
+	txBuf := make([]byte, packetSize)
 
-	if c == nil {
-		return ErrParam
+	txBuf[idxSync] = syncByte
+	txBuf[idxCmd] = byte(msg.Cmd)
+	txBuf[idxErr] = msg.Err
+
+	if msg.Payload == nil {
+		txBuf[idxlen] = 0
+	} else {
+		txBuf[idxlen] = byte(len(msg.Payload))
+		copy(txBuf[idxPayload:], msg.Payload[:])
 	}
 
-	listeners = append(listeners, listener{cmd: cmd, channel: c})
+	crc := crc16.Checksum(txBuf[:len(txBuf)-2], crcTable)
+	var h, l uint8 = uint8(crc & 0xff), uint8(crc >> 8)
+	txBuf[62] = byte(h)
+	txBuf[63] = byte(l)
 
-	return nil
+	return txBuf
 }
 
-//////////////////////////////
-// Internal functions (private)
-//////////////////////////////
+// openDevice opens the transport described by the device string
+func openDevice(device string) (io.ReadWriteCloser, error) {
+	if strings.HasPrefix(device, tcpPrefix) {
+		return net.Dial("tcp", strings.TrimPrefix(device, tcpPrefix))
+	}
 
-func serialReaderThread() {
+	// Open port in mode 115200_N81
+	c := &serial.Config{Name: device, Baud: 115200, ReadTimeout: time.Millisecond * 500}
+	p, err := serial.OpenPort(c)
+	if err != nil {
+		return nil, err
+	}
+	return &serialPort{Port: p, name: device}, nil
+}
 
-	for {
-		var rxBuf [packetSize]byte
+// Read reads from the serial port. A read timeout is reported as io.EOF by tarm/serial, it is passed on as empty
+// read instead. A port whose device node disappeared (unplugged or re-enumerating after a reset) reports an error
+func (p *serialPort) Read(b []byte) (int, error) {
+	n, err := p.Port.Read(b)
+	if err == io.EOF {
+		if _, statErr := os.Stat(p.name); statErr != nil {
+			return n, statErr
+		}
+		return n, nil
+	}
+	return n, err
+}
 
-		if port != nil {
-			bytesRead, err := port.Read(rxBuf[:])
+// serialReaderThread reads from the transport until the port is closed or reading fails. done is closed on exit
+func (c *Conn) serialReaderThread(t io.Reader, closed <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
 
-			// check packet length, must be 64
-			if err != nil || bytesRead != packetSize {
-				continue
-			}
+	f := framer{stats: &c.stats}
+	rxBuf := make([]byte, 4*packetSize)
 
-			// check sync byte
-			if rxBuf[idxSync] != sync {
-				continue
+	for {
+		bytesRead, err := t.Read(rxBuf)
+
+		if err != nil {
+			select {
+			case <-closed:
+				// port was closed, stop reading
+				return
+			default:
 			}
+			// the device is gone or the other end closed the stream, nothing more to read
+			c.err = fmt.Errorf("%w: %v", ErrDeviceLost, err)
+			return
+		}
 
-			// check CRC
-			crcCalc := crc16.Checksum(rxBuf[:packetSize-2], crcTable)
-			crcRx := binary.LittleEndian.Uint16(rxBuf[packetSize-2:])
-			if crcCalc != crcRx {
-				continue
-			}
+		f.push(rxBuf[:bytesRead])
 
-			// Get payload length
-			payloadLen := rxBuf[3]
+		for {
+			answerMessage, ok := f.next()
+			if !ok {
+				break
+			}
 
-			answerMessage := Message{
-				Cmd:     CommandID(rxBuf[idxCmd]),
-				Err:     rxBuf[idxErr],
-				Payload: rxBuf[idxPayload : idxPayload+payloadLen]}
+			answerMessage.Seq = c.sequence().next()
+			answerMessage.Time = time.Now()
 
-			isAnswer := true
 			// message received, look if a listener is registered
+			listeners := c.matchingListeners(answerMessage.Cmd)
+			if len(listeners) == 0 {
+				c.dispatchAnswer(answerMessage)
+				continue
+			}
+			atomic.StoreUint64(&c.listenerSeq, answerMessage.Seq)
 			for _, l := range listeners {
-				if l.cmd == answerMessage.Cmd {
-					l.channel <- answerMessage
-					isAnswer = false
+				select {
+				case l.channel <- answerMessage:
+				case <-l.removed:
 				}
 			}
-			if isAnswer {
-				ansChannel <- answerMessage
-			}
 		}
+	}
+}
+
+// sequence returns the sequence numbering the received messages
+func (c *Conn) sequence() *Sequence {
+	if c.Sequence != nil {
+		return c.Sequence
+	}
+	return &c.ownSequence
+}
+
+// next returns the next sequence number
+func (s *Sequence) next() uint64 {
+	return atomic.AddUint64(&s.n, 1)
+}
 
+// matchingListeners returns the listeners registered for a command
+func (c *Conn) matchingListeners(cmd CommandID) []listener {
+	c.listenersMutex.Lock()
+	defer c.listenersMutex.Unlock()
+
+	var matching []listener
+	for _, l := range c.listeners {
+		if l.cmd == cmd {
+			matching = append(matching, l)
+		}
 	}
+	return matching
 }
 
 func init() {
@@ -1,14 +1,56 @@
 package usbprotocol
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
 )
 
+var testDevice = flag.String("device", "", "Serial port of a real esb-bridge device (e.g. /dev/ttyACM0), the emulator is used if empty")
+var testEmulator = emulator.New()
+
+// openTestDevice opens the default connection to the real test device or to the emulator
+func openTestDevice(t *testing.T) {
+	var err error
+	if *testDevice != "" {
+		err = Open(*testDevice)
+	} else {
+		err = OpenTransport(testEmulator.Pipe())
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pressButton asks the user to press the button on the real test device, or simulates a button press on the emulator
+func pressButton() {
+	if *testDevice != "" {
+		fmt.Printf("Please press the button during the next 10 seconds\n")
+		return
+	}
+	time.AfterFunc(100*time.Millisecond, func() { testEmulator.Interrupt(nil) })
+}
+
 //TestOpenSuccess tests that the virtual COM port can be opened
 func TestOpenSuccess(t *testing.T) {
-	err := Open(("/dev/ttyACM0"))
+	device := *testDevice
+	if device == "" {
+		pty, err := testEmulator.OpenPty()
+		if err != nil {
+			t.Skipf("Emulator pty not available: %v", err)
+		}
+		defer pty.Close()
+		device = pty.Path
+	}
+
+	err := Open(device)
 
 	if err != nil {
 		t.Fatal(err)
@@ -46,7 +88,7 @@ func TestTransferMessageTooLong(t *testing.T) {
 // TestTransfer tests the successful operation of the Transfer function
 func TestTransfer(t *testing.T) {
 
-	Open("/dev/ttyACM0")
+	openTestDevice(t)
 
 	pl := []byte{1, 2, 3, 4}
 	msg := Message{Cmd: CmdTest, Payload: pl}
@@ -65,7 +107,7 @@ func TestTransfer(t *testing.T) {
 // TestTransfer tests the successful tarnsfer of multiple messages in quick succession
 func TestTransferMulti(t *testing.T) {
 
-	Open("/dev/ttyACM0")
+	openTestDevice(t)
 	pl := []byte{1, 2, 3, 4}
 	msg := Message{Cmd: CmdTest, Payload: pl}
 	for i := 0; i < 5; i++ {
@@ -84,7 +126,7 @@ func TestTransferMulti(t *testing.T) {
 // TestTransferInvalidCommand tests the error handling on invalid command ID
 func TestTransferInvalidCommand(t *testing.T) {
 
-	Open("/dev/ttyACM0")
+	openTestDevice(t)
 
 	msg := Message{Cmd: 0xFE, Payload: nil}
 	answer, err := Transfer(msg)
@@ -103,21 +145,21 @@ func TestTransferInvalidCommand(t *testing.T) {
 // TestTransferTimeout tests the error handling on timeout while waiting for a response from the device
 func TestTransferTimeout(t *testing.T) {
 
-	///////////
-	// Manual Test: Uncomment below and run the test manually
-	//////////
-
-	// var expectedErrCode = ErrTimeout.ErrCode
-	// Open("/dev/ttyACM0")
+	if *testDevice != "" {
+		t.Skip("A timeout can only be provoked on the emulator")
+	}
 
-	// _, _, err := Transfer(CmdTest, nil)
+	var expectedErrCode = ErrTimeout.ErrCode
+	openTestDevice(t)
+	defer Close()
 
-	// e, ok := err.(UsbError)
-	// if (!ok) || (e.ErrCode != expectedErrCode) {
-	// 	t.Fatalf("Expected ErrTimeout (%v), got: %v", expectedErrCode, e)
-	// }
+	testEmulator.DropAnswers(1)
+	_, err := Transfer(Message{Cmd: CmdTest})
 
-	// Close()
+	e, ok := err.(UsbError)
+	if (!ok) || (e.ErrCode != expectedErrCode) {
+		t.Fatalf("Expected ErrTimeout (%v), got: %v", expectedErrCode, e)
+	}
 }
 
 // TestListenerInvalidParam tests that Addlistener will return an error if an invalid channel parameter (nil) is passed
@@ -135,19 +177,15 @@ func TestListenerInvalidParam(t *testing.T) {
 // Note: This is a manual test, it requires the user to press a button on the board
 func TestListener(t *testing.T) {
 
-	/////////
-	//Manual Test: Uncomment below and run the test manually
-	////////
-
 	messageReceived := false
 
-	Open("/dev/ttyACM0")
+	openTestDevice(t)
 
 	lc := make(chan Message, 1)
 
 	AddListener(CmdIrq, lc)
 
-	fmt.Printf("Please press the button during the next 60 seconds\n")
+	pressButton()
 
 timeoutLoop:
 	for i := 10; i > 0; i-- {
@@ -173,58 +211,48 @@ timeoutLoop:
 // Note: This is a manual test, it requires the user to press a button on the board
 func TestMultipleListeners(t *testing.T) {
 
-	///////////
-	// Manual Test: Uncomment below and run the test manually
-	//////////
-
-	// 	messageReceived1 := false
-	// 	messageReceived2 := false
-
-	// 	Open("/dev/ttyACM0")
-
-	// 	lc1 := make(chan Message, 1)
-	// 	lc2 := make(chan Message, 1)
+	messageReceived1 := false
+	messageReceived2 := false
 
-	// 	AddListener(CmdIrq, lc1)
-	// 	AddListener(CmdIrq, lc2)
+	openTestDevice(t)
 
-	// 	fmt.Printf("Please press the button during the next 60 seconds\n")
+	lc1 := make(chan Message, 1)
+	lc2 := make(chan Message, 1)
 
-	// 	go func() {
-	// 		msg := <-lc1
-	// 		fmt.Printf("Message received1: %v\n", msg)
-	// 		messageReceived1 = true
-	// 		return
-	// 	}()
-	// 	go func() {
-	// 		msg := <-lc2
-	// 		fmt.Printf("Message received2: %v\n", msg)
-	// 		messageReceived2 = true
-	// 		return
-	// 	}()
+	AddListener(CmdIrq, lc1)
+	AddListener(CmdIrq, lc2)
 
-	// timeoutLoop:
-	// 	for i := 10; i > 0; i-- {
-	// 		time.Sleep(1 * time.Second)
-	// 		fmt.Printf("%v\n", i)
+	pressButton()
 
-	// 		if messageReceived1 && messageReceived2 {
-	// 			break timeoutLoop
-	// 		}
-	// 	}
+timeoutLoop:
+	for i := 10; i > 0; i-- {
+		select {
+		case msg := <-lc1:
+			fmt.Printf("Message received1: %v\n", msg)
+			messageReceived1 = true
+		case msg := <-lc2:
+			fmt.Printf("Message received2: %v\n", msg)
+			messageReceived2 = true
+		case <-time.After(1 * time.Second):
+			fmt.Printf("%v\n", i)
+		}
 
-	// 	Close()
+		if messageReceived1 && messageReceived2 {
+			break timeoutLoop
+		}
+	}
 
-	// 	if !messageReceived1 || !messageReceived2 {
-	// 		t.Fatalf("Timeout, not all messages were received")
-	// 	}
+	Close()
 
+	if !messageReceived1 || !messageReceived2 {
+		t.Fatalf("Timeout, not all messages were received")
+	}
 }
 
 // TestEcho Sends a USB packet and expects an echo messsage back
 func TestEcho(t *testing.T) {
 
-	Open("/dev/ttyACM0")
+	openTestDevice(t)
 
 	pl := []byte{5, 19, 20}
 	msg := Message{Cmd: CmdTest, Payload: pl}
@@ -247,3 +275,306 @@ func TestEcho(t *testing.T) {
 	Close()
 
 }
+
+// TestOpenTransportInvalidParam tests that OpenTransport returns ErrParam if no transport is passed
+func TestOpenTransportInvalidParam(t *testing.T) {
+	err := OpenTransport(nil)
+
+	e, ok := err.(UsbError)
+	if (!ok) || (e.ErrCode != ErrParam.ErrCode) {
+		t.Fatalf("OpenTransport should return ErrParam if nil is passed as transport, got: %v", err)
+	}
+}
+
+// TestOpenTransportTwice tests that an open connection can not be opened again before it was closed
+func TestOpenTransportTwice(t *testing.T) {
+	var c Conn
+	if err := c.OpenTransport(emulator.New().Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	second := emulator.New().Pipe()
+	if err := c.OpenTransport(second); err != ErrOpen {
+		t.Fatalf("OpenTransport should return ErrOpen on an open connection, got: %v", err)
+	}
+	second.Close()
+
+	// the first transport is still in use
+	if _, err := c.Transfer(Message{Cmd: CmdTest}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+	if err := c.OpenTransport(emulator.New().Pipe()); err != nil {
+		t.Fatalf("OpenTransport should succeed after Close(), got: %v", err)
+	}
+	c.Close()
+}
+
+// TestTransferOverTransport tests the Transfer function over an in-memory transport
+func TestTransferOverTransport(t *testing.T) {
+	err := OpenTransport(emulator.New().Pipe())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	pl := []byte{5, 19, 20}
+	answer, err := Transfer(Message{Cmd: CmdTest, Payload: pl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(answer.Payload, pl) {
+		t.Fatalf("Unexpected answer: Expected:%v , Got:%v", pl, answer.Payload)
+	}
+
+	answer, err = Transfer(Message{Cmd: 0xFE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Err != 0x10 {
+		t.Fatalf("Answer message should have the E_NO_CMD Error code when requesting a unknown command")
+	}
+}
+
+// TestListenerOverTransport tests that a Listener channel receives unsolicited messages from an in-memory transport
+func TestListenerOverTransport(t *testing.T) {
+	e := emulator.New()
+	err := OpenTransport(e.Pipe())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	lc := make(chan Message, 1)
+	AddListener(CmdIrq, lc)
+
+	// a round trip makes sure the emulator serves the connection before the interrupt is sent
+	if _, err := Transfer(Message{Cmd: CmdTest}); err != nil {
+		t.Fatal(err)
+	}
+	e.Interrupt([]byte{1, 2})
+
+	select {
+	case msg := <-lc:
+		if !bytes.Equal(msg.Payload, []byte{1, 2}) {
+			t.Fatalf("Unexpected message payload: %v", msg.Payload)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("Timeout, no message was received")
+	}
+}
+
+// TestMultipleConns tests that two connections can be used independently of each other
+func TestMultipleConns(t *testing.T) {
+	e1 := emulator.New()
+	e2 := emulator.New()
+
+	var c1, c2 Conn
+	if err := c1.OpenTransport(e1.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	if err := c2.OpenTransport(e2.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	lc1 := make(chan Message, 1)
+	lc2 := make(chan Message, 1)
+	c1.AddListener(CmdIrq, lc1)
+	c2.AddListener(CmdIrq, lc2)
+
+	if _, err := c2.Transfer(Message{Cmd: CmdTest}); err != nil {
+		t.Fatal(err)
+	}
+	e2.Interrupt([]byte{2})
+
+	select {
+	case msg := <-lc2:
+		if !bytes.Equal(msg.Payload, []byte{2}) {
+			t.Fatalf("Unexpected message payload: %v", msg.Payload)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("Timeout, no message was received")
+	}
+	select {
+	case msg := <-lc1:
+		t.Fatalf("Message of second connection was received on first connection: %v", msg)
+	default:
+	}
+
+	c2.Close()
+	answer, err := c1.Transfer(Message{Cmd: CmdTest, Payload: []byte{1}})
+	if err != nil {
+		t.Fatalf("First connection should still work after closing the second one: %v", err)
+	}
+	if !bytes.Equal(answer.Payload, []byte{1}) {
+		t.Fatalf("Unexpected answer: %v", answer.Payload)
+	}
+}
+
+// TestDeviceLost tests that a lost device ends the connection with ErrDeviceLost, while Close() does not
+func TestDeviceLost(t *testing.T) {
+	e := emulator.New()
+
+	var c Conn
+	if err := c.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Transfer(Message{Cmd: CmdTest}); err != nil {
+		t.Fatal(err)
+	}
+	if c.Err() != nil {
+		t.Fatalf("Open connection should not report an error: %v", c.Err())
+	}
+
+	e.Unplug()
+
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout, connection loss was not detected")
+	}
+	if !errors.Is(c.Err(), ErrDeviceLost) {
+		t.Fatalf("Expected ErrDeviceLost, got %v", c.Err())
+	}
+	if _, err := c.Transfer(Message{Cmd: CmdTest}); err == nil {
+		t.Fatalf("Transfer to lost device should fail")
+	}
+
+	var c2 Conn
+	if err := c2.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	c2.Close()
+	<-c2.Done()
+	if c2.Err() != nil {
+		t.Fatalf("Closed connection should not report an error: %v", c2.Err())
+	}
+}
+
+// TestConcurrentListeners tests adding and removing listeners concurrently while messages are received. Listeners
+// which do not receive must not block the connection after they were removed. Run with -race
+func TestConcurrentListeners(t *testing.T) {
+	e := emulator.New()
+	var c Conn
+	if err := c.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Transfer(Message{Cmd: CmdTest}); err != nil {
+		t.Fatal(err)
+	}
+
+	// interrupts without listener would be taken for the answer of the final transfer
+	drain := make(chan Message)
+	if err := c.AddListener(CmdIrq, drain); err != nil {
+		t.Fatal(err)
+	}
+	defer c.RemoveListener(drain)
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		for {
+			select {
+			case <-drain:
+			case <-finished:
+				return
+			}
+		}
+	}()
+
+	stop := make(chan struct{})
+	interrupts := make(chan struct{})
+	go func() {
+		defer close(interrupts)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				e.Interrupt([]byte{1})
+			}
+		}
+	}()
+
+	const workers, cycles = 8, 250
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < cycles; i++ {
+				lc := make(chan Message) // unbuffered, only some listeners receive
+				if err := c.AddListener(CmdIrq, lc); err != nil {
+					t.Error(err)
+					return
+				}
+				if i%2 == 0 {
+					select {
+					case <-lc:
+					case <-time.After(time.Millisecond):
+					}
+				}
+				if n := c.RemoveListener(lc); n != 1 {
+					t.Errorf("Expected 1 removed listener, got %v", n)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	<-interrupts
+
+	if _, err := c.Transfer(Message{Cmd: CmdTest}); err != nil {
+		t.Fatalf("Transfer after removing the listeners failed: %v", err)
+	}
+}
+
+// TestSequence tests that the received messages of connections sharing a Sequence are numbered in order of arrival
+func TestSequence(t *testing.T) {
+	var seq Sequence
+	e := emulator.New()
+	conns := []*Conn{{Sequence: &seq}, {Sequence: &seq}}
+	for _, c := range conns {
+		if err := c.OpenTransport(e.Pipe()); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+
+	lc := make(chan Message, 1)
+	conns[0].AddListener(CmdIrq, lc)
+
+	var last uint64
+	for i := 0; i < 4; i++ {
+		answer, err := conns[i%2].Transfer(Message{Cmd: CmdTest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if answer.Seq <= last || answer.Time.IsZero() {
+			t.Fatalf("Answer %v: unexpected sequence number %v after %v, time %v", i, answer.Seq, last, answer.Time)
+		}
+		last = answer.Seq
+	}
+	if seq.Last() != last {
+		t.Fatalf("Expected last sequence number %v, got %v", last, seq.Last())
+	}
+
+	// the interrupt is sent to both connections
+	e.Interrupt(nil)
+	select {
+	case msg := <-lc:
+		if msg.Seq <= last {
+			t.Fatalf("Unexpected sequence number %v after %v", msg.Seq, last)
+		}
+		if conns[0].ListenerSeq() != msg.Seq {
+			t.Fatalf("Expected listener sequence number %v, got %v", msg.Seq, conns[0].ListenerSeq())
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("Timeout, no message was received")
+	}
+}
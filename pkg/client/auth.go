@@ -0,0 +1,17 @@
+package client
+
+import (
+	"context"
+)
+
+// tokenCredentials sends the bearer token of the client with every call
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity prevents sending the token over unencrypted connections
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
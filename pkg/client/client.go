@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
 	"time"
 
 	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
@@ -22,16 +21,49 @@ type EsbClientInterface interface {
 	Connect(address string) error
 	Disconnect() error
 	Transfer(msg esbbridge.EsbMessage) (esbbridge.EsbMessage, error)
+	TransferContext(ctx context.Context, msg esbbridge.EsbMessage) (esbbridge.EsbMessage, error)
+	Send(msg esbbridge.EsbMessage) error
+	SendContext(ctx context.Context, msg esbbridge.EsbMessage) error
+	GetBridgeInfo() (esbbridge.BridgeInfo, error)
 	Listen(ctx context.Context, addr []byte, cmd byte) (<-chan esbbridge.EsbMessage, error)
+	ListenStream(ctx context.Context, addr []byte, cmd byte) (*ListenStream, error)
+	ListenFilter(ctx context.Context, filter esbbridge.Filter) (*ListenStream, error)
+	Subscribe(ctx context.Context) (*Subscription, error)
+	Session(ctx context.Context) (*Session, error)
 }
 
 // EsbClient represents the RPC connection and implements the EsbClientInterface
 type EsbClient struct {
+	// Timeout is the timeout of calls like Transfer() and Send(), and of calls with a context without deadline.
+	// If set to 0, DefaultTimeout is used
+	Timeout time.Duration
+
+	// TLSCA is the path of a PEM encoded CA bundle used to verify the server certificate. If empty but TLSCert is
+	// set, the system CAs are used. If TLSCA and TLSCert are both empty, the connection is not encrypted
+	TLSCA string
+	// TLSCert and TLSKey are the paths of the PEM encoded client certificate and private key, needed if the
+	// server requires client certificates (mutual TLS)
+	TLSCert string
+	TLSKey  string
+	// TLSServerName overrides the name the server certificate is verified against, which is the host of the
+	// address by default. Needed e.g. for Unix domain sockets
+	TLSServerName string
+	// Token is sent as bearer token to authenticate the client, if the server has an access policy.
+	// Requires TLS
+	Token string
+
 	conn      *grpc.ClientConn
 	client    pb.EsbBridgeClient
 	connected bool
 }
 
+// ListenStream receives the incoming messages of a Listen stream, see EsbClient.ListenStream()
+type ListenStream struct {
+	messages chan esbbridge.EsbMessage
+	done     chan struct{} // closed when the stream ended, see err
+	err      error
+}
+
 //////////////////////////////////////////////////////////
 // Public members
 //////////////////////////////////////////////////////////
@@ -44,9 +76,19 @@ var DefaultTimeout time.Duration = 2 * time.Second
 // Param:
 //   address: remote address and port of the server, e.g. "localhost:10000"
 func (c *EsbClient) Connect(address string) error {
-	var err error
 	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithInsecure())
+	creds, err := c.transportCredentials()
+	if err != nil {
+		return fmt.Errorf("Could not connect to esb-bridge RPC server: %v", err)
+	}
+	if creds != nil {
+		opts = append(opts, grpc.WithTransportCredentials(creds))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if c.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(c.Token)))
+	}
 	opts = append(opts, grpc.WithBlock())
 	opts = append(opts, grpc.WithTimeout(DefaultTimeout))
 
@@ -65,7 +107,7 @@ func (c *EsbClient) Connect(address string) error {
 func (c *EsbClient) Disconnect() error {
 
 	if !c.connected {
-		return fmt.Errorf("Not connected to server")
+		return ErrNotConnected
 	}
 	err := c.conn.Close()
 	if err != nil {
@@ -79,57 +121,219 @@ func (c *EsbClient) Disconnect() error {
 
 // Transfer sends a message to a peripheral device and returns the answer message
 func (c *EsbClient) Transfer(msg esbbridge.EsbMessage) (esbbridge.EsbMessage, error) {
+	return c.TransferContext(context.Background(), msg)
+}
+
+// TransferContext sends a message to a peripheral device and returns the answer message. The deadline of ctx is
+// passed on to the server, which gives up waiting for the answer when it expires. If ctx has no deadline,
+// the Timeout of the client is used
+func (c *EsbClient) TransferContext(ctx context.Context, msg esbbridge.EsbMessage) (esbbridge.EsbMessage, error) {
 
 	if !c.connected {
-		return esbbridge.EsbMessage{}, fmt.Errorf("Not connected to server")
+		return esbbridge.EsbMessage{}, ErrNotConnected
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 	answerMessage, err := c.client.Transfer(ctx, &pb.EsbMessage{Addr: msg.Address, Cmd: []byte{msg.Cmd}, Payload: msg.Payload})
 	if err != nil {
-		log.Fatalf("%v.Transfer(_) = _, %v: ", c.client, err)
-		return esbbridge.EsbMessage{}, err
+		return esbbridge.EsbMessage{}, rpcError("Transfer", err)
 	}
 
-	return esbbridge.EsbMessage{Address: answerMessage.Addr, Cmd: answerMessage.Cmd[0], Error: answerMessage.Error[0], Payload: answerMessage.Payload}, nil
+	answer, ok := messageFromProto(answerMessage)
+	if !ok {
+		return esbbridge.EsbMessage{}, fmt.Errorf("Error calling remote procedure `Transfer()`: answer without cmd")
+	}
+	return answer, nil
 }
 
-// Listen will start a listening goroutine which listens for specific messages and sends them to the channel returned by Listen().
-// The RPC Message stream will keep running indefinitely until the context is cancelled. Use context.WithCancel and call the cancelFunc.
-// When the context is cancelled, the RPC stream is terminated and the server will stop listening for these messages
+// Send sends a message to a peripheral device without waiting for a reply. Returns an error if the peripheral
+// did not acknowledge the message
+func (c *EsbClient) Send(msg esbbridge.EsbMessage) error {
+	return c.SendContext(context.Background(), msg)
+}
+
+// SendContext sends a message to a peripheral device without waiting for a reply, like Send(). If ctx has no
+// deadline, the Timeout of the client is used
+func (c *EsbClient) SendContext(ctx context.Context, msg esbbridge.EsbMessage) error {
+
+	if !c.connected {
+		return ErrNotConnected
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	_, err := c.client.Send(ctx, &pb.EsbMessage{Addr: msg.Address, Cmd: []byte{msg.Cmd}, Payload: msg.Payload})
+	if err != nil {
+		return rpcError("Send", err)
+	}
+
+	return nil
+}
+
+// GetBridgeInfo returns information about the esb-bridge device connected to the server, e.g. to check that its
+// firmware is recent enough
+func (c *EsbClient) GetBridgeInfo() (esbbridge.BridgeInfo, error) {
+
+	if !c.connected {
+		return esbbridge.BridgeInfo{}, ErrNotConnected
+	}
+
+	ctx, cancel := c.withTimeout(context.Background())
+	defer cancel()
+	info, err := c.client.GetBridgeInfo(ctx, &pb.BridgeInfoRequest{})
+	if err != nil {
+		return esbbridge.BridgeInfo{}, rpcError("GetBridgeInfo", err)
+	}
+
+	return esbbridge.BridgeInfo{
+		FwVersion: esbbridge.FwVersion{
+			Major: uint8(info.GetFwVersion().GetMajor()),
+			Minor: uint8(info.GetFwVersion().GetMinor()),
+			Patch: uint8(info.GetFwVersion().GetPatch())},
+		Device:         info.Device,
+		Uptime:         time.Duration(info.UptimeSeconds) * time.Second,
+		State:          esbbridge.ConnectionState(info.State),
+		Capabilities:   info.Capabilities,
+		MaxPayloadSize: uint8(info.MaxPayloadSize),
+	}, nil
+}
+
+// Listen will start a listening goroutine which listens for specific messages and sends them to the channel returned by
+// Listen(). The RPC Message stream will keep running indefinitely until the context is cancelled or the stream fails,
+// then the channel is closed. When the context is cancelled, the RPC stream is terminated and the server will stop
+// listening for these messages. Use ListenStream() to learn why the stream ended
 func (c *EsbClient) Listen(ctx context.Context, addr []byte, cmd byte) (<-chan esbbridge.EsbMessage, error) {
+	stream, err := c.ListenStream(ctx, addr, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return stream.Messages(), nil
+}
+
+// ListenStream works like Listen(), but returns a ListenStream. When the stream fails, e.g. because the server
+// disconnected a client which did not keep up, the channel of ListenStream.Messages() is closed and
+// ListenStream.Err() returns the reason. The number of messages dropped by the server before a message is in
+// EsbMessage.Dropped
+func (c *EsbClient) ListenStream(ctx context.Context, addr []byte, cmd byte) (*ListenStream, error) {
+	return c.listen(ctx, &pb.Listener{Addr: addr, Cmd: []byte{cmd}})
+}
+
+// ListenFilter works like ListenStream(), but receives the messages matching a filter, see esbbridge.Filter
+func (c *EsbClient) ListenFilter(ctx context.Context, filter esbbridge.Filter) (*ListenStream, error) {
+	return c.listen(ctx, &pb.Listener{Filter: filterToProto(filter)})
+}
+
+// Messages returns the channel of the incoming messages. It is closed when the stream ended, see Err()
+func (l *ListenStream) Messages() <-chan esbbridge.EsbMessage {
+	return l.messages
+}
+
+// Err returns the reason the stream ended, e.g. esbbridge.ErrDisconnected if the server disconnected the client
+// because it did not keep up. It is nil while the stream is running and after the context was cancelled
+func (l *ListenStream) Err() error {
+	select {
+	case <-l.done:
+		return l.err
+	default:
+		return nil
+	}
+}
+
+//////////////////////////////////////////////////////////
+// Private functions
+//////////////////////////////////////////////////////////
+
+// listen starts the Listen RPC and a goroutine which passes the incoming messages on to the returned stream
+func (c *EsbClient) listen(ctx context.Context, listener *pb.Listener) (*ListenStream, error) {
 
 	if !c.connected {
-		return nil, fmt.Errorf("Not connected to server")
+		return nil, ErrNotConnected
 	}
 
-	stream, err := c.client.Listen(ctx, &pb.Listener{Addr: addr, Cmd: []byte{cmd}})
+	stream, err := c.client.Listen(ctx, listener)
 	if err != nil {
-		fmt.Printf("%v.Listen(_) = _, %v", c.client, err)
-		return nil, fmt.Errorf("Error calling remote procedure `Listen()`: %v", err)
+		return nil, rpcError("Listen", err)
 	}
 
-	rxChan := make(chan esbbridge.EsbMessage, 1)
+	l := &ListenStream{messages: make(chan esbbridge.EsbMessage, 1), done: make(chan struct{})}
+	go l.receive(ctx, stream)
 
-	go func() {
-		for {
-			incomingMessage, err := stream.Recv()
-			if err == io.EOF {
-				return
-			}
-			if err != nil {
-				fmt.Printf("%v.ListenWorker(_) = _, %v", c.client, err)
-				return
+	return l, nil
+}
+
+// receive passes the incoming messages on to the messages channel until the stream ends
+func (l *ListenStream) receive(ctx context.Context, stream pb.EsbBridge_ListenClient) {
+	defer close(l.messages)
+	defer close(l.done)
+
+	for {
+		incomingMessage, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() == nil && err != io.EOF {
+				l.err = rpcError("Listen", err)
 			}
-			fmt.Printf("Incoming Message: %v", incomingMessage)
-			answerMessage := esbbridge.EsbMessage{
-				Address: incomingMessage.Addr,
-				Cmd:     incomingMessage.Cmd[0],
-				Payload: incomingMessage.Payload}
-			rxChan <- answerMessage
+			return
+		}
+		answerMessage, ok := messageFromProto(incomingMessage)
+		if !ok {
+			continue
 		}
-	}()
+		select {
+		case l.messages <- answerMessage:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// messageFromProto converts an answer or an incoming message. Returns false if the message has no cmd
+func messageFromProto(m *pb.EsbMessage) (esbbridge.EsbMessage, bool) {
+	if len(m.GetCmd()) == 0 {
+		return esbbridge.EsbMessage{}, false
+	}
+	msg := esbbridge.EsbMessage{Address: m.Addr, Cmd: m.Cmd[0], Payload: m.Payload, Dropped: m.Dropped, Seq: m.Seq}
+	if len(m.Error) > 0 {
+		msg.Error = m.Error[0]
+	}
+	if m.TimeUnixNano != 0 {
+		msg.Timestamp = time.Unix(0, m.TimeUnixNano)
+	}
+	if m.Radio != nil {
+		msg.Radio = &esbbridge.RadioInfo{Pipe: uint8(m.Radio.Pipe), RSSI: int8(m.Radio.Rssi),
+			Retransmits: uint8(m.Radio.Retransmits)}
+	}
+	return msg, true
+}
 
-	return rxChan, nil
+// filterToProto converts a filter for the Listen request
+func filterToProto(filter esbbridge.Filter) *pb.Filter {
+	f := &pb.Filter{}
+	if filter.AddressMask != [esbbridge.AddressSize]byte{} {
+		f.Addr = append([]byte(nil), filter.Address[:]...)
+		f.AddrMask = append([]byte(nil), filter.AddressMask[:]...)
+	}
+	for _, r := range filter.Cmds {
+		f.Cmds = append(f.Cmds, &pb.CmdRange{First: uint32(r.First), Last: uint32(r.Last)})
+	}
+	for _, p := range filter.Payload {
+		f.Payload = append(f.Payload, &pb.PayloadMatch{Offset: uint32(p.Offset), Value: p.Value, Mask: p.Mask})
+	}
+	for _, e := range filter.Exclude {
+		f.Exclude = append(f.Exclude, filterToProto(e))
+	}
+	return f
+}
+
+// withTimeout applies the Timeout of the client to a context without deadline
+func (c *EsbClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
 }
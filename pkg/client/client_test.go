@@ -2,23 +2,77 @@ package client
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"testing"
+	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/internal/testcert"
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
 	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	"github.com/spritkopf/esb-bridge/pkg/server"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
 )
 
 var (
-	serverAddr = flag.String("server_addr", "localhost:9815", "The server address in the format of host:port")
+	serverAddr = flag.String("server_addr", "", "The server address in the format of host:port, an in-process server with an emulated device is used if empty")
 )
 
 var c EsbClient
+var testEmulator = emulator.New()
+
+// startTestServer starts an in-process RPC server connected to the emulator and returns its address
+func startTestServer() string {
+	testEmulator.AddPeripheral(&emulator.Peripheral{Address: [5]byte{111, 111, 111, 111, 1}})
+
+	bridge := &esbbridge.Bridge{}
+	if err := bridge.OpenTransport(testEmulator.Pipe()); err != nil {
+		log.Fatalf("Setup: Could not open emulated device: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Setup: failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterEsbBridgeServer(grpcServer, server.NewService(bridge))
+	go grpcServer.Serve(lis)
+
+	return lis.Addr().String()
+}
+
+// sendTestMessages simulates incoming messages from a peripheral until ctx is done, when running on the emulator.
+// On a real device the peripheral has to send the messages itself
+func sendTestMessages(ctx context.Context, addr [5]byte) {
+	if *serverAddr != "" {
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-time.After(100 * time.Millisecond):
+				testEmulator.Receive(addr, emulator.Message{Cmd: 0x01})
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
 
 func setup() {
-	err := c.Connect(*serverAddr)
+	addr := *serverAddr
+	if addr == "" {
+		addr = startTestServer()
+	}
+	err := c.Connect(addr)
 	if err != nil {
 		log.Fatalf("Setup: Connection Error: %v", err)
 	}
@@ -45,17 +99,381 @@ func TestTransfer(t *testing.T) {
 	fmt.Printf("Got answer: %v\n", answerMsg)
 }
 
+func TestTransferErrors(t *testing.T) {
+
+	_, err := c.Transfer(esbbridge.EsbMessage{Address: []byte{111, 111, 111, 111, 1}, Cmd: 0x10, Payload: make([]byte, 40)})
+	if !errors.Is(err, esbbridge.ErrPayloadTooLarge) {
+		t.Fatalf("Expected ErrPayloadTooLarge, got: %v", err)
+	}
+
+	_, err = c.Transfer(esbbridge.EsbMessage{Address: []byte{9, 9, 9, 9, 9}, Cmd: 0x10})
+	if !errors.Is(err, esbbridge.ErrNoAck) {
+		t.Fatalf("Expected ErrNoAck for a transfer to an unknown device, got: %v", err)
+	}
+	var fwErr *esbbridge.FirmwareError
+	if !errors.As(err, &fwErr) || fwErr.Cmd != byte(esbbridge.UsbCmdTransfer) {
+		t.Fatalf("Expected a FirmwareError of the transfer command, got: %v", err)
+	}
+
+	var notConnected EsbClient
+	if _, err := notConnected.Transfer(esbbridge.EsbMessage{}); err != ErrNotConnected {
+		t.Fatalf("Expected ErrNotConnected, got: %v", err)
+	}
+}
+
+func TestTransferContext(t *testing.T) {
+	if *serverAddr != "" {
+		t.Skip("the emulator is needed to delay the answer")
+	}
+
+	testEmulator.DropAnswers(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.TransferContext(ctx, esbbridge.EsbMessage{Address: []byte{111, 111, 111, 111, 1}, Cmd: 0x10})
+	if !errors.Is(err, esbbridge.ErrTimeout) {
+		t.Fatalf("Expected ErrTimeout, got: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Transfer returned after %v, the deadline of the context should be used", d)
+	}
+}
+
+func TestSend(t *testing.T) {
+
+	err := c.Send(esbbridge.EsbMessage{Address: []byte{111, 111, 111, 111, 1}, Cmd: 0x10, Payload: []byte{1}})
+
+	if err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+}
+
+func TestGetBridgeInfo(t *testing.T) {
+
+	info, err := c.GetBridgeInfo()
+
+	if err != nil {
+		t.Fatalf("GetBridgeInfo returned error: %v", err)
+	}
+	if info.State != esbbridge.StateConnected {
+		t.Fatalf("Bridge should be connected, got state %v", info.State)
+	}
+	if !info.HasCapability(esbbridge.CapTransfer) || !info.HasCapability(server.CapSubscribe) ||
+		info.MaxPayloadSize != esbbridge.MaxPayloadSize {
+		t.Fatalf("Unexpected bridge info: %+v", info)
+	}
+	if *serverAddr == "" && info.FwVersion != (esbbridge.FwVersion{Major: 1}) {
+		t.Fatalf("Unexpected firmware version of the emulator: %v", info.FwVersion)
+	}
+
+	fmt.Printf("Bridge info: %+v\n", info)
+}
+
+func TestTLS(t *testing.T) {
+	if *serverAddr != "" {
+		t.Skip("an in-process server is needed to configure TLS")
+	}
+
+	ca, err := testcert.NewCA(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, serverKey, err := ca.Issue("localhost", "localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, clientKey, err := ca.Issue("test-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	go testEmulator.ServeListener(device)
+
+	s, err := server.New(server.Config{
+		Device:      "tcp://" + device.Addr().String(),
+		Listen:      []string{"127.0.0.1:0"},
+		TLSCert:     serverCert,
+		TLSKey:      serverKey,
+		TLSClientCA: ca.CertFile,
+	})
+	if err != nil {
+		t.Fatalf("Could not start TLS server: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	addr := s.Addrs()[0].String()
+
+	tlsClient := EsbClient{TLSCA: ca.CertFile, TLSCert: clientCert, TLSKey: clientKey}
+	if err := tlsClient.Connect(addr); err != nil {
+		t.Fatalf("Connect with client certificate failed: %v", err)
+	}
+	if _, err := tlsClient.GetBridgeInfo(); err != nil {
+		t.Fatalf("GetBridgeInfo over TLS failed: %v", err)
+	}
+	tlsClient.Disconnect()
+
+	// the server requires a client certificate
+	noCertClient := EsbClient{TLSCA: ca.CertFile}
+	err = noCertClient.Connect(addr)
+	if err == nil {
+		_, err = noCertClient.GetBridgeInfo()
+		noCertClient.Disconnect()
+	}
+	if err == nil {
+		t.Fatalf("Connection without client certificate should be rejected")
+	}
+
+	// tokens are never sent unencrypted
+	insecureClient := EsbClient{Token: "secret"}
+	if err := insecureClient.Connect(addr); err == nil {
+		insecureClient.Disconnect()
+		t.Fatalf("Connect with token but without TLS should fail")
+	}
+}
+
 func TestListen(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
-	rxChan, _ := c.Listen(ctx, []byte{12, 13, 14, 15, 16}, 0xFF)
+	rxChan, err := c.Listen(ctx, []byte{12, 13, 14, 15, 16}, 0xFF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendTestMessages(ctx, [5]byte{12, 13, 14, 15, 16})
 
 	for i := 0; i < 4; i++ {
 		msg := <-rxChan
 		log.Printf("Incoming Message: %v", msg)
 	}
 	cancel()
+
+	// skip messages which were still in flight, the channel is closed when the stream ended
+	for range rxChan {
+	}
+}
+
+// TestListenEnd tests that a ListenStream ended by the server closes the channel and reports the reason
+func TestListenEnd(t *testing.T) {
+	if *serverAddr != "" {
+		t.Skip("an in-process server is needed to end the stream")
+	}
+
+	device, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	go testEmulator.ServeListener(device)
+
+	s, err := server.New(server.Config{Device: "tcp://" + device.Addr().String(), Listen: []string{"127.0.0.1:0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run(context.Background())
+
+	client := EsbClient{}
+	if err := client.Connect(s.Addrs()[0].String()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+	stream, err := client.ListenStream(context.Background(), []byte{12, 13, 14, 15, 16}, 0xFF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// make sure the stream is running before the shutdown
+	if _, err := client.GetBridgeInfo(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	s.Shutdown(context.Background())
+
+	select {
+	case _, ok := <-stream.Messages():
+		if ok {
+			t.Fatalf("No message expected")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout, channel was not closed")
+	}
+	if !errors.Is(stream.Err(), esbbridge.ErrUnavailable) {
+		t.Fatalf("Expected ErrUnavailable, got %v", stream.Err())
+	}
+
+	// a client which does not keep up is disconnected with status RESOURCE_EXHAUSTED
+	err = rpcError("Listen", status.Error(codes.ResourceExhausted, "listener queue overflow"))
+	if !errors.Is(err, esbbridge.ErrDisconnected) {
+		t.Fatalf("Expected ErrDisconnected, got %v", err)
+	}
+}
+
+// TestListenFilter tests that only the messages matching a filter are received
+func TestListenFilter(t *testing.T) {
+	if *serverAddr != "" {
+		t.Skip("incoming messages can only be simulated with the emulator")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	filter := esbbridge.Filter{
+		Address:     [5]byte{12, 13, 14, 15, 0},
+		AddressMask: [5]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00},
+		Exclude:     []esbbridge.Filter{{Cmds: []esbbridge.CmdRange{{First: 0x01, Last: 0x01}}}},
+	}
+	stream, err := c.ListenFilter(ctx, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the listener is attached asynchronously, repeat the messages until one arrives
+	timeout := time.After(5 * time.Second)
+	for {
+		testEmulator.Receive([5]byte{12, 13, 14, 15, 17}, emulator.Message{Cmd: 0x01})
+		testEmulator.Receive([5]byte{12, 13, 14, 16, 17}, emulator.Message{Cmd: 0x02})
+		testEmulator.Receive([5]byte{12, 13, 14, 15, 17}, emulator.Message{Cmd: 0x02})
+		select {
+		case msg := <-stream.Messages():
+			if msg.Cmd != 0x02 || msg.Address[3] != 15 {
+				t.Fatalf("Unexpected message %+v", msg)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("Timeout, no message received")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// TestSubscribe tests that the messages of a subscription are tagged with the matching filters
+func TestSubscribe(t *testing.T) {
+	if *serverAddr != "" {
+		t.Skip("incoming messages can only be simulated with the emulator")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := c.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd50, err := sub.Add(esbbridge.Filter{Cmds: []esbbridge.CmdRange{{First: 0x50, Last: 0x50}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensors, err := sub.Add(esbbridge.Filter{
+		Address:     [5]byte{12, 13, 14, 15, 0},
+		AddressMask: [5]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00},
+		Cmds:        []esbbridge.CmdRange{{First: 0x50, Last: 0x51}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the subscriptions are added asynchronously, repeat the messages until the expected tags arrive
+	expectIDs := func(expected ...uint32) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			testEmulator.Receive([5]byte{12, 13, 14, 15, 17}, emulator.Message{Cmd: 0x50})
+			select {
+			case msg := <-sub.Messages():
+				if fmt.Sprint(msg.IDs) == fmt.Sprint(expected) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("Timeout, no message with subscriptions %v received", expected)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	expectIDs(cmd50, sensors)
+	if err := sub.Remove(cmd50); err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(sensors)
+
+	if _, err := sub.Add(esbbridge.Filter{Cmds: []esbbridge.CmdRange{{First: 0x51, Last: 0x50}}}); err == nil {
+		t.Fatalf("Adding an invalid filter should fail")
+	}
+	if err := sub.Err(); err != nil {
+		t.Fatalf("Subscription should still be running, got %v", err)
+	}
+	cancel()
+	for range sub.Messages() {
+	}
+}
+
+// TestSession tests transfers, sends and incoming messages on one session stream
+func TestSession(t *testing.T) {
+	if *serverAddr != "" {
+		t.Skip("incoming messages can only be simulated with the emulator")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session, err := c.Session(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.SetFilters(esbbridge.Filter{Cmds: []esbbridge.CmdRange{{First: 0x52, Last: 0x52}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := []byte{111, 111, 111, 111, 1}
+	transferID, err := session.Transfer(esbbridge.EsbMessage{Address: addr, Cmd: 0x10, Payload: []byte{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendID, err := session.Send(esbbridge.EsbMessage{Address: addr, Cmd: 0x11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failedID, err := session.Transfer(esbbridge.EsbMessage{Address: []byte{9, 9, 9, 9, 9}, Cmd: 0x10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the filters are set asynchronously, repeat the message until it arrives
+	received := false
+	results := map[uint64]esbbridge.SessionEvent{}
+	timeout := time.After(5 * time.Second)
+	for !received || len(results) < 3 {
+		testEmulator.ReceiveRadio([5]byte{111, 111, 111, 111, 1}, emulator.Message{Cmd: 0x52, Error: 0x07},
+			emulator.RadioInfo{Pipe: 2, RSSI: -70, Retransmits: 1})
+		select {
+		case event := <-session.Events():
+			if event.Type == esbbridge.EventReceived {
+				msg := event.Message
+				received = msg.Cmd == 0x52 && msg.Error == 0x07 && msg.Seq > 0 && !msg.Timestamp.IsZero() &&
+					msg.Radio != nil && *msg.Radio == esbbridge.RadioInfo{Pipe: 2, RSSI: -70, Retransmits: 1}
+			} else {
+				results[event.ID] = event
+			}
+		case <-timeout:
+			t.Fatalf("Timeout, received %v, results %v", received, results)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if e := results[transferID]; e.Type != esbbridge.EventAnswer || e.Message.Cmd != 0x10 || e.Message.Seq == 0 {
+		t.Fatalf("Unexpected answer %+v", e)
+	}
+	if e := results[sendID]; e.Type != esbbridge.EventSent || e.Message.Cmd != 0x11 || e.Message.Timestamp.IsZero() {
+		t.Fatalf("Unexpected send result %+v", e)
+	}
+	if e := results[failedID]; e.Type != esbbridge.EventFailed || !errors.Is(e.Err, esbbridge.ErrNoAck) {
+		t.Fatalf("Unexpected failed transfer %+v", e)
+	}
+	if err := session.Err(); err != nil {
+		t.Fatalf("Session should still be running, got %v", err)
+	}
+	cancel()
+	for range session.Events() {
+	}
 }
+
 func TestMain(m *testing.M) {
+	flag.Parse()
 	setup()
 	code := m.Run()
 	teardown()
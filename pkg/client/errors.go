@@ -0,0 +1,96 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// ErrNotConnected is returned if Connect() was not called or the client was disconnected
+var ErrNotConnected = errors.New("Not connected to server")
+
+// ErrUnauthenticated is returned if the server does not know the client, e.g. because of a wrong token
+var ErrUnauthenticated = errors.New("Client not authenticated")
+
+// ErrPermissionDenied is returned if the access policy of the server does not allow the call
+var ErrPermissionDenied = errors.New("Permission denied")
+
+// ErrSubscriptionEnded is returned if a filter is added to or removed from a Subscription whose stream ended,
+// see Subscription.Err()
+var ErrSubscriptionEnded = errors.New("Subscription stream ended")
+
+// ErrSessionEnded is returned if a request is sent on a Session whose stream ended, see Session.Err()
+var ErrSessionEnded = errors.New("Session stream ended")
+
+// reasonErrors maps the error reasons sent by the server to the errors of esbbridge
+var reasonErrors = map[pb.ErrorReason]error{
+	pb.ErrorReason_ERR_NOT_CONNECTED:     esbbridge.ErrNotConnected,
+	pb.ErrorReason_ERR_UNAVAILABLE:       esbbridge.ErrUnavailable,
+	pb.ErrorReason_ERR_TIMEOUT:           esbbridge.ErrTimeout,
+	pb.ErrorReason_ERR_PAYLOAD_TOO_LARGE: esbbridge.ErrPayloadTooLarge,
+	pb.ErrorReason_ERR_INVALID_PARAM:     esbbridge.ErrInvalidParam,
+	pb.ErrorReason_ERR_PROTOCOL:          esbbridge.ErrProtocol,
+}
+
+// rpcError converts the error of a remote procedure call back into the error of esbbridge which caused it on the
+// server, so callers can check it with errors.Is() and errors.As(). The original error is kept as message
+func rpcError(procedure string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("Error calling remote procedure `%v()`: %v", procedure, err)
+	}
+
+	var cause error
+	for _, d := range st.Details() {
+		detail, ok := d.(*pb.ErrorDetail)
+		if !ok {
+			continue
+		}
+		if detail.Reason == pb.ErrorReason_ERR_FIRMWARE {
+			cause = &esbbridge.FirmwareError{Cmd: byte(detail.FwCmd), Code: byte(detail.FwCode)}
+		} else {
+			cause = reasonErrors[detail.Reason]
+		}
+	}
+
+	if cause == nil {
+		// errors without detail, e.g. the deadline of the call expired or the server is not reachable
+		switch st.Code() {
+		case codes.DeadlineExceeded:
+			cause = esbbridge.ErrTimeout
+		case codes.Unavailable:
+			cause = esbbridge.ErrUnavailable
+		case codes.Unauthenticated:
+			cause = ErrUnauthenticated
+		case codes.PermissionDenied:
+			cause = ErrPermissionDenied
+		case codes.ResourceExhausted:
+			// the server ends the streams of clients which do not keep up
+			cause = esbbridge.ErrDisconnected
+		default:
+			return fmt.Errorf("Error calling remote procedure `%v()`: %v", procedure, err)
+		}
+	}
+
+	return &remoteError{procedure: procedure, msg: st.Message(), cause: cause}
+}
+
+// remoteError is an error returned by the server, it unwraps to the esbbridge error which caused it
+type remoteError struct {
+	procedure string
+	msg       string
+	cause     error
+}
+
+func (e *remoteError) Error() string {
+	return fmt.Sprintf("Error calling remote procedure `%v()`: %v", e.procedure, e.msg)
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.cause
+}
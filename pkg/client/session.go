@@ -0,0 +1,206 @@
+package client
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+//////////////////////////////////////////////////////////
+// Types and interfaces
+//////////////////////////////////////////////////////////
+
+// Session transfers and sends messages and receives incoming messages over one stream. The events are delivered in
+// the order the esb-bridge device received the answers, acknowledgements and incoming messages, see
+// EsbClient.Session()
+type Session struct {
+	stream pb.EsbBridge_SessionClient
+	mu     sync.Mutex // serializes the requests
+	nextID uint64
+	events chan esbbridge.SessionEvent
+
+	pendingMu sync.Mutex
+	pending   map[uint64]esbbridge.EsbMessage // messages of the running transfers and sends by ID
+
+	done chan struct{} // closed when the stream ended, see err
+	err  error
+}
+
+//////////////////////////////////////////////////////////
+// Public members
+//////////////////////////////////////////////////////////
+
+// Session starts a stream for transfers, sends and incoming messages. No incoming messages are received until
+// filters are set with SetFilters(). The stream keeps running until the context is cancelled or it fails, then the
+// channel returned by Events() is closed
+func (c *EsbClient) Session(ctx context.Context) (*Session, error) {
+	if !c.connected {
+		return nil, ErrNotConnected
+	}
+
+	stream, err := c.client.Session(ctx)
+	if err != nil {
+		return nil, rpcError("Session", err)
+	}
+
+	s := &Session{stream: stream, events: make(chan esbbridge.SessionEvent, 1), done: make(chan struct{}),
+		pending: make(map[uint64]esbbridge.EsbMessage)}
+	go s.receive(ctx)
+	return s, nil
+}
+
+// Transfer starts a transfer and returns its ID. The answer is delivered as esbbridge.EventAnswer with the ID, or
+// esbbridge.EventFailed if the transfer failed
+func (s *Session) Transfer(msg esbbridge.EsbMessage) (uint64, error) {
+	return s.request(&pb.SessionRequest{Request: &pb.SessionRequest_Transfer{Transfer: &pb.EsbMessage{
+		Addr: msg.Address, Cmd: []byte{msg.Cmd}, Payload: msg.Payload}}}, &msg)
+}
+
+// Send starts a send and returns its ID. The acknowledgement is delivered as esbbridge.EventSent with the ID, or
+// esbbridge.EventFailed if the send failed
+func (s *Session) Send(msg esbbridge.EsbMessage) (uint64, error) {
+	return s.request(&pb.SessionRequest{Request: &pb.SessionRequest_Send{Send: &pb.EsbMessage{
+		Addr: msg.Address, Cmd: []byte{msg.Cmd}, Payload: msg.Payload}}}, &msg)
+}
+
+// SetFilters replaces the filters of the incoming messages. Without filters, no incoming messages are received
+func (s *Session) SetFilters(filters ...esbbridge.Filter) error {
+	listen := &pb.SessionFilters{}
+	for _, f := range filters {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+		listen.Filters = append(listen.Filters, filterToProto(f))
+	}
+
+	_, err := s.request(&pb.SessionRequest{Request: &pb.SessionRequest_Listen{Listen: listen}}, nil)
+	return err
+}
+
+// Events returns the channel of the events. It is closed when the stream ended, see Err()
+func (s *Session) Events() <-chan esbbridge.SessionEvent {
+	return s.events
+}
+
+// Err returns the reason the stream ended, e.g. because a request was not allowed by the server. It is nil while
+// the stream is running and after the context was cancelled
+func (s *Session) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+//////////////////////////////////////////////////////////
+// Private functions
+//////////////////////////////////////////////////////////
+
+// request sends a request with the next ID and returns the ID. msg is the message of a transfer or send, it is
+// returned with the sent and failed events. If the stream ended, the reason is returned if it is known already
+func (s *Session) request(req *pb.SessionRequest, msg *esbbridge.EsbMessage) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	req.Id = s.nextID
+	if msg != nil {
+		s.pendingMu.Lock()
+		s.pending[req.Id] = *msg
+		s.pendingMu.Unlock()
+	}
+	err := s.stream.Send(req)
+	if err != nil && msg != nil {
+		s.pendingMu.Lock()
+		delete(s.pending, req.Id)
+		s.pendingMu.Unlock()
+	}
+	if err == io.EOF {
+		// the status of the stream is received by receive(), which may still deliver events
+		if err := s.Err(); err != nil {
+			return 0, err
+		}
+		return 0, ErrSessionEnded
+	}
+	if err != nil {
+		return 0, rpcError("Session", err)
+	}
+	return req.Id, nil
+}
+
+// receive passes the events on to the events channel until the stream ends
+func (s *Session) receive(ctx context.Context) {
+	defer close(s.events)
+	defer close(s.done)
+
+	for {
+		in, err := s.stream.Recv()
+		if err != nil {
+			if ctx.Err() == nil && err != io.EOF {
+				s.err = rpcError("Session", err)
+			}
+			return
+		}
+		event, ok := sessionEventFromProto(in)
+		if !ok {
+			continue
+		}
+		if event.Type != esbbridge.EventReceived {
+			s.pendingMu.Lock()
+			if msg, ok := s.pending[event.ID]; ok && event.Type != esbbridge.EventAnswer {
+				msg.Seq = event.Message.Seq
+				msg.Timestamp = event.Message.Timestamp
+				event.Message = msg
+			}
+			delete(s.pending, event.ID)
+			s.pendingMu.Unlock()
+		}
+		select {
+		case s.events <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sessionEventFromProto converts an event of a Session stream. Returns false for unknown events
+func sessionEventFromProto(in *pb.SessionEvent) (esbbridge.SessionEvent, bool) {
+	event := esbbridge.SessionEvent{ID: in.Id}
+	ok := true
+	switch e := in.Event.(type) {
+	case *pb.SessionEvent_Received:
+		event.Type = esbbridge.EventReceived
+		event.Message, ok = messageFromProto(e.Received)
+	case *pb.SessionEvent_Answer:
+		event.Type = esbbridge.EventAnswer
+		event.Message, ok = messageFromProto(e.Answer)
+	case *pb.SessionEvent_Sent:
+		event.Type = esbbridge.EventSent
+	case *pb.SessionEvent_Error:
+		event.Type = esbbridge.EventFailed
+		st := status.New(codes.Code(e.Error.GetCode()), e.Error.GetMessage())
+		if e.Error.GetDetail() != nil {
+			if withDetail, err := st.WithDetails(e.Error.Detail); err == nil {
+				st = withDetail
+			}
+		}
+		event.Err = rpcError("Session", st.Err())
+	default:
+		return event, false
+	}
+
+	// the sequence number and time of the event also order the sent and failed events, which carry no message
+	event.Message.Seq = in.Seq
+	if in.TimeUnixNano != 0 {
+		event.Message.Timestamp = time.Unix(0, in.TimeUnixNano)
+	}
+	return event, ok
+}
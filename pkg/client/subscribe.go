@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+//////////////////////////////////////////////////////////
+// Types and interfaces
+//////////////////////////////////////////////////////////
+
+// SubscribedMessage is an incoming message of a Subscription and the IDs of the filters it matches
+type SubscribedMessage struct {
+	esbbridge.EsbMessage
+	IDs []uint32
+}
+
+// Subscription receives incoming messages matching any of its filters over one stream. Filters can be added and
+// removed while the stream is running, see EsbClient.Subscribe()
+type Subscription struct {
+	stream   pb.EsbBridge_SubscribeClient
+	mu       sync.Mutex // serializes the requests
+	nextID   uint32
+	messages chan SubscribedMessage
+	done     chan struct{} // closed when the stream ended, see err
+	err      error
+}
+
+//////////////////////////////////////////////////////////
+// Public members
+//////////////////////////////////////////////////////////
+
+// Subscribe starts a stream for incoming messages, its filters are added with Add(). The stream keeps running until
+// the context is cancelled or it fails, then the channel returned by Messages() is closed
+func (c *EsbClient) Subscribe(ctx context.Context) (*Subscription, error) {
+	if !c.connected {
+		return nil, ErrNotConnected
+	}
+
+	stream, err := c.client.Subscribe(ctx)
+	if err != nil {
+		return nil, rpcError("Subscribe", err)
+	}
+
+	s := &Subscription{stream: stream, messages: make(chan SubscribedMessage, 1), done: make(chan struct{})}
+	go s.receive(ctx)
+	return s, nil
+}
+
+// Add adds a filter and returns its ID. Messages arriving right after Add() returned may still be missed
+func (s *Subscription) Add(filter esbbridge.Filter) (uint32, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	id := s.nextID
+	err := s.send(&pb.SubscribeRequest{Request: &pb.SubscribeRequest_Add{
+		Add: &pb.Subscription{Id: id, Filter: filterToProto(filter)}}})
+	return id, err
+}
+
+// Remove removes the filter with the ID returned by Add(). Messages arriving right after Remove() returned may still
+// be tagged with it
+func (s *Subscription) Remove(id uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.send(&pb.SubscribeRequest{Request: &pb.SubscribeRequest_Remove{Remove: id}})
+}
+
+// Messages returns the channel of the incoming messages. It is closed when the stream ended, see Err()
+func (s *Subscription) Messages() <-chan SubscribedMessage {
+	return s.messages
+}
+
+// Err returns the reason the stream ended, e.g. because a filter was not allowed by the server. It is nil while
+// the stream is running and after the context was cancelled
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+//////////////////////////////////////////////////////////
+// Private functions
+//////////////////////////////////////////////////////////
+
+// send sends a request. If the stream ended, the reason is returned if it is known already
+func (s *Subscription) send(req *pb.SubscribeRequest) error {
+	err := s.stream.Send(req)
+	if err == io.EOF {
+		// the status of the stream is received by receive(), which may still deliver messages
+		if err := s.Err(); err != nil {
+			return err
+		}
+		return ErrSubscriptionEnded
+	}
+	if err != nil {
+		return rpcError("Subscribe", err)
+	}
+	return nil
+}
+
+// receive passes the incoming messages on to the messages channel until the stream ends
+func (s *Subscription) receive(ctx context.Context) {
+	defer close(s.messages)
+	defer close(s.done)
+
+	for {
+		in, err := s.stream.Recv()
+		if err != nil {
+			if ctx.Err() == nil && err != io.EOF {
+				s.err = rpcError("Subscribe", err)
+			}
+			return
+		}
+		msg, ok := messageFromProto(in.GetMessage())
+		if !ok {
+			continue
+		}
+		subscribed := SubscribedMessage{EsbMessage: msg, IDs: in.SubscriptionIds}
+		select {
+		case s.messages <- subscribed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,490 @@
+// Package emulator implements a software model of the esb-bridge firmware. It speaks the USB framing of the real
+// device over any byte stream (an in-memory pipe, a pty, ...) and simulates ESB peripherals behind the bridge, so
+// the host side packages can be used and tested without hardware.
+package emulator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sigurn/crc16"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// Types and constants
+///////////////////////////////////////////////////////////////////////////////
+
+// AddressSize is the size of the Pipeline addresses (only 5 byte addresses are supported)
+const AddressSize int = 5
+
+// packetSize is the fixed size of transmitted USB packages
+const packetSize = 64
+
+// maxPayloadLen - maximum length of a USB packet payload (64 byte packet - 4 bytes header - 2 bytes crc)
+const maxPayloadLen = packetSize - 4 - 2
+
+// sync byte, marks the beginning of a new packet
+const syncByte = 0x69
+
+const idxSync = 0
+const idxCmd = 1
+const idxErr = 2
+const idxLen = 3
+const idxPayload = 4
+
+// USB command IDs understood by the emulated firmware
+const (
+	// CmdVersion - Get firmware version
+	CmdVersion byte = 0x10
+	// CmdTransfer - Send a message, wait for reply
+	CmdTransfer byte = 0x30
+	// CmdSend - Send a message without reply
+	CmdSend byte = 0x31
+	// CmdTest - test command, echoes the request
+	CmdTest byte = 0x61
+	// CmdIrq - interrupt callback (button press), only from device to host
+	CmdIrq byte = 0x80
+	// CmdRx - Rx callback, for async messages from peripheral -> central
+	CmdRx byte = 0x81
+	// CmdRxRadio - Rx callback with radio metadata, sent by ReceiveRadio() like newer firmware does
+	CmdRxRadio byte = 0x82
+)
+
+// Error codes returned by the emulated firmware in the error byte of the USB packet
+const (
+	// ErrNone - command executed successfully
+	ErrNone byte = 0x00
+	// ErrNoCmd - unknown command ID
+	ErrNoCmd byte = 0x10
+	// ErrParam - malformed request (e.g. payload too short)
+	ErrParam byte = 0x11
+	// ErrNoAck - the peripheral did not acknowledge the ESB message
+	ErrNoAck byte = 0x20
+)
+
+// Message is an ESB message exchanged between the emulated bridge and a simulated peripheral
+type Message struct {
+	Cmd     byte
+	Error   byte
+	Payload []byte
+}
+
+// RadioInfo is the radio metadata of an incoming message, see ReceiveRadio()
+type RadioInfo struct {
+	Pipe        uint8
+	RSSI        int8 // dBm
+	Retransmits uint8
+}
+
+// HandlerFunc computes the answer of a peripheral to an incoming message
+type HandlerFunc func(req Message) Message
+
+// Peripheral simulates an ESB device which can be reached by the emulated bridge.
+// A peripheral must not be modified after it was added to the emulator, use the methods of Emulator instead
+type Peripheral struct {
+	Address [AddressSize]byte
+	// Handler computes the answer to a transfer. If nil, the request is echoed back
+	Handler HandlerFunc
+	// AckLoss is the probability (0.0 - 1.0) that a message to this peripheral is not acknowledged
+	AckLoss float64
+	// Silent peripherals neither acknowledge messages nor send periodic messages, like a node out of range
+	Silent bool
+	// Periodic messages are sent unsolicited by the peripheral as long as it is added to the emulator
+	Periodic []PeriodicMessage
+
+	stop chan struct{} // stops the periodic messages
+}
+
+// PeriodicMessage is sent by a peripheral in a fixed interval
+type PeriodicMessage struct {
+	Interval time.Duration
+	Message  Message
+}
+
+// Emulator emulates the esb-bridge firmware. Create it with New(), add peripherals and connect the host side
+// with Pipe(), Serve() or OpenPty()
+type Emulator struct {
+	// FwVersion is the firmware version (major, minor, patch) reported to the host
+	FwVersion [3]byte
+	// Latency delays every answer sent to the host
+	Latency time.Duration
+
+	mu          sync.Mutex
+	peripherals map[[AddressSize]byte]*Peripheral
+	cmdErrors   map[byte]byte        // forced error codes per USB command ID
+	dropAnswers int                  // number of upcoming answers which are not sent to the host
+	streams     map[*stream]struct{} // connected hosts, unsolicited messages are sent to all of them
+	rnd         *rand.Rand
+}
+
+// stream is a connection to a host, writes are serialized because answers and unsolicited messages may interleave
+type stream struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private variables
+///////////////////////////////////////////////////////////////////////////////
+
+var crcTable = crc16.MakeTable(crc16.CRC16_CCITT_FALSE)
+
+///////////////////////////////////////////////////////////////////////////////
+// Public API
+///////////////////////////////////////////////////////////////////////////////
+
+// New creates an emulator without peripherals reporting firmware version 1.0.0
+func New() *Emulator {
+	return &Emulator{
+		FwVersion:   [3]byte{1, 0, 0},
+		peripherals: make(map[[AddressSize]byte]*Peripheral),
+		cmdErrors:   make(map[byte]byte),
+		streams:     make(map[*stream]struct{}),
+		rnd:         rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// AddPeripheral makes a peripheral reachable by the emulated bridge and starts sending its periodic messages.
+// An existing peripheral with the same address is replaced
+func (e *Emulator) AddPeripheral(p *Peripheral) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.removePeripheral(p.Address)
+
+	p.stop = make(chan struct{})
+	for _, m := range p.Periodic {
+		if m.Interval > 0 {
+			go e.sendPeriodic(p, m, p.stop)
+		}
+	}
+	e.peripherals[p.Address] = p
+}
+
+// RemovePeripheral removes the peripheral with the given address, messages to it will no longer be acknowledged
+func (e *Emulator) RemovePeripheral(addr [AddressSize]byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.removePeripheral(addr)
+}
+
+// SetSilent switches a peripheral to silent (out of range) or back to normal operation
+func (e *Emulator) SetSilent(addr [AddressSize]byte, silent bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	p, ok := e.peripherals[addr]
+	if !ok {
+		return fmt.Errorf("no peripheral with address %v", addr)
+	}
+	p.Silent = silent
+
+	return nil
+}
+
+// Close removes all peripherals and stops their periodic messages
+func (e *Emulator) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for addr := range e.peripherals {
+		e.removePeripheral(addr)
+	}
+}
+
+// SetError forces the emulated firmware to answer every request with USB command ID cmd with the given error code.
+// Pass ErrNone to restore the normal behaviour
+func (e *Emulator) SetError(cmd byte, errCode byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if errCode == ErrNone {
+		delete(e.cmdErrors, cmd)
+		return
+	}
+	e.cmdErrors[cmd] = errCode
+}
+
+// DropAnswers discards the next n answers to the host, the host will run into a timeout waiting for them
+func (e *Emulator) DropAnswers(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.dropAnswers = n
+}
+
+// Receive simulates an incoming ESB message from a peripheral, which is forwarded to the host as CmdRx packet
+func (e *Emulator) Receive(addr [AddressSize]byte, msg Message) error {
+	if len(msg.Payload) > maxPayloadLen-2-AddressSize {
+		return errors.New("payload too long")
+	}
+
+	pl := []byte{msg.Cmd, msg.Error}
+	pl = append(pl, addr[:]...)
+	pl = append(pl, msg.Payload...)
+
+	e.broadcast(CmdRx, ErrNone, pl)
+	return nil
+}
+
+// ReceiveRadio simulates an incoming ESB message like Receive(), but forwards it to the host as CmdRxRadio packet
+// with radio metadata, like firmware which reports it
+func (e *Emulator) ReceiveRadio(addr [AddressSize]byte, msg Message, info RadioInfo) error {
+	radio := []byte{info.Pipe, byte(info.RSSI), info.Retransmits}
+	if len(msg.Payload) > maxPayloadLen-2-AddressSize-1-len(radio) {
+		return errors.New("payload too long")
+	}
+
+	pl := []byte{msg.Cmd, msg.Error}
+	pl = append(pl, addr[:]...)
+	pl = append(pl, byte(len(radio)))
+	pl = append(pl, radio...)
+	pl = append(pl, msg.Payload...)
+
+	e.broadcast(CmdRxRadio, ErrNone, pl)
+	return nil
+}
+
+// Interrupt simulates a press of the button on the bridge, which sends a CmdIrq packet to the host
+func (e *Emulator) Interrupt(payload []byte) {
+	e.broadcast(CmdIrq, ErrNone, payload)
+}
+
+// Serve runs the emulated firmware on a byte stream until reading from it fails. The host is expected on the other end
+func (e *Emulator) Serve(rw io.ReadWriter) error {
+	s := &stream{w: rw}
+
+	e.mu.Lock()
+	e.streams[s] = struct{}{}
+	e.mu.Unlock()
+
+	defer func() {
+		e.mu.Lock()
+		delete(e.streams, s)
+		e.mu.Unlock()
+	}()
+
+	rxBuf := make([]byte, packetSize)
+	for {
+		_, err := io.ReadFull(rw, rxBuf)
+		if err != nil {
+			return err
+		}
+
+		cmd, pl, ok := decodePacket(rxBuf)
+		if !ok {
+			// the real firmware silently discards invalid packets as well
+			continue
+		}
+
+		errCode, answer := e.handle(cmd, pl)
+
+		if e.Latency > 0 {
+			time.Sleep(e.Latency)
+		}
+
+		e.mu.Lock()
+		drop := e.dropAnswers > 0
+		if drop {
+			e.dropAnswers--
+		}
+		e.mu.Unlock()
+
+		if !drop {
+			s.write(encodePacket(cmd, errCode, answer))
+		}
+	}
+}
+
+// ServeListener serves every host connecting to the listener, e.g. a TCP listener to emulate a serial-over-TCP
+// server. Returns when the listener is closed
+func (e *Emulator) ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			e.Serve(conn)
+			conn.Close()
+		}()
+	}
+}
+
+// Unplug simulates the loss of the device by closing the connections to all hosts (if they can be closed)
+func (e *Emulator) Unplug() {
+	e.mu.Lock()
+	streams := make([]*stream, 0, len(e.streams))
+	for s := range e.streams {
+		streams = append(streams, s)
+	}
+	e.mu.Unlock()
+
+	for _, s := range streams {
+		if c, ok := s.w.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// Pipe connects a new host to the emulator over an in-memory pipe and returns the host end of it. Closing the
+// returned connection stops serving it
+func (e *Emulator) Pipe() io.ReadWriteCloser {
+	host, dev := net.Pipe()
+
+	go func() {
+		e.Serve(dev)
+		dev.Close()
+	}()
+
+	return host
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private functions
+///////////////////////////////////////////////////////////////////////////////
+
+// handle executes a USB command and returns error code and payload of the answer
+func (e *Emulator) handle(cmd byte, pl []byte) (byte, []byte) {
+	e.mu.Lock()
+	errCode, forced := e.cmdErrors[cmd]
+	e.mu.Unlock()
+
+	if forced {
+		return errCode, nil
+	}
+
+	switch cmd {
+	case CmdVersion:
+		return ErrNone, e.FwVersion[:]
+	case CmdTest:
+		return ErrNone, pl
+	case CmdTransfer, CmdSend:
+		// payload: address, ESB cmd, ESB payload
+		if len(pl) < AddressSize+1 {
+			return ErrParam, nil
+		}
+		var addr [AddressSize]byte
+		copy(addr[:], pl[:AddressSize])
+		req := Message{Cmd: pl[AddressSize], Payload: pl[AddressSize+1:]}
+
+		answer, ok := e.transmit(addr, req)
+		if !ok {
+			return ErrNoAck, nil
+		}
+		if cmd == CmdSend {
+			return ErrNone, nil
+		}
+		if len(answer.Payload) > maxPayloadLen-2 {
+			answer.Payload = answer.Payload[:maxPayloadLen-2]
+		}
+		return ErrNone, append([]byte{answer.Cmd, answer.Error}, answer.Payload...)
+	default:
+		return ErrNoCmd, nil
+	}
+}
+
+// removePeripheral removes a peripheral and stops its periodic messages, e.mu must be held
+func (e *Emulator) removePeripheral(addr [AddressSize]byte) {
+	if p, ok := e.peripherals[addr]; ok {
+		close(p.stop)
+		delete(e.peripherals, addr)
+	}
+}
+
+// sendPeriodic sends a periodic message of a peripheral until stop is closed
+func (e *Emulator) sendPeriodic(p *Peripheral, m PeriodicMessage, stop <-chan struct{}) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.mu.Lock()
+			silent := p.Silent
+			e.mu.Unlock()
+			if !silent {
+				e.Receive(p.Address, m.Message)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// transmit delivers a message to a peripheral and returns its answer. Returns false if the message was not acknowledged
+func (e *Emulator) transmit(addr [AddressSize]byte, req Message) (Message, bool) {
+	e.mu.Lock()
+	p, ok := e.peripherals[addr]
+	lost := ok && (p.Silent || (p.AckLoss > 0 && e.rnd.Float64() < p.AckLoss))
+	e.mu.Unlock()
+
+	if !ok || lost {
+		return Message{}, false
+	}
+
+	if p.Handler == nil {
+		return req, true
+	}
+	return p.Handler(req), true
+}
+
+// broadcast sends an unsolicited packet to all connected hosts
+func (e *Emulator) broadcast(cmd byte, errCode byte, pl []byte) {
+	e.mu.Lock()
+	streams := make([]*stream, 0, len(e.streams))
+	for s := range e.streams {
+		streams = append(streams, s)
+	}
+	e.mu.Unlock()
+
+	packet := encodePacket(cmd, errCode, pl)
+	for _, s := range streams {
+		s.write(packet)
+	}
+}
+
+func (s *stream) write(packet []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.w.Write(packet)
+}
+
+// encodePacket builds the 64 byte USB packet (sync, header, payload, crc)
+func encodePacket(cmd byte, errCode byte, pl []byte) []byte {
+	buf := make([]byte, packetSize)
+
+	buf[idxSync] = syncByte
+	buf[idxCmd] = cmd
+	buf[idxErr] = errCode
+	buf[idxLen] = byte(len(pl))
+	copy(buf[idxPayload:], pl)
+
+	binary.LittleEndian.PutUint16(buf[packetSize-2:], crc16.Checksum(buf[:packetSize-2], crcTable))
+
+	return buf
+}
+
+// decodePacket checks a received 64 byte USB packet and returns command ID and payload
+func decodePacket(buf []byte) (byte, []byte, bool) {
+	if buf[idxSync] != syncByte || int(buf[idxLen]) > maxPayloadLen {
+		return 0, nil, false
+	}
+	if crc16.Checksum(buf[:packetSize-2], crcTable) != binary.LittleEndian.Uint16(buf[packetSize-2:]) {
+		return 0, nil, false
+	}
+
+	pl := make([]byte, buf[idxLen])
+	copy(pl, buf[idxPayload:])
+
+	return buf[idxCmd], pl, true
+}
@@ -0,0 +1,194 @@
+package emulator
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/spritkopf/esb-bridge/internal/usbprotocol"
+)
+
+var testAddress = [AddressSize]byte{111, 111, 111, 111, 1}
+
+func open(t *testing.T, e *Emulator) *usbprotocol.Conn {
+	c := &usbprotocol.Conn{TimeoutMillis: 200}
+	if err := c.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// TestVersion tests that the configured firmware version is reported
+func TestVersion(t *testing.T) {
+	e := New()
+	e.FwVersion = [3]byte{2, 1, 7}
+	c := open(t, e)
+
+	answer, err := c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdVersion)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(answer.Payload, []byte{2, 1, 7}) {
+		t.Fatalf("Unexpected version: %v", answer.Payload)
+	}
+}
+
+// TestTransfer tests transfers to echoing and custom peripherals as well as unknown addresses
+func TestTransfer(t *testing.T) {
+	e := New()
+	e.AddPeripheral(&Peripheral{Address: testAddress})
+	e.AddPeripheral(&Peripheral{Address: [AddressSize]byte{1, 2, 3, 4, 5}, Handler: func(req Message) Message {
+		return Message{Cmd: req.Cmd, Error: 0x42, Payload: []byte{9}}
+	}})
+	c := open(t, e)
+
+	req := append(testAddress[:], 0x10, 1, 2)
+	answer, err := c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdTransfer), Payload: req})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Err != ErrNone || !bytes.Equal(answer.Payload, []byte{0x10, 0, 1, 2}) {
+		t.Fatalf("Unexpected answer from echo peripheral: %v", answer)
+	}
+
+	req = []byte{1, 2, 3, 4, 5, 0x20}
+	answer, err = c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdTransfer), Payload: req})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Err != ErrNone || !bytes.Equal(answer.Payload, []byte{0x20, 0x42, 9}) {
+		t.Fatalf("Unexpected answer from custom peripheral: %v", answer)
+	}
+
+	req = []byte{9, 9, 9, 9, 9, 0x20}
+	answer, err = c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdTransfer), Payload: req})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Err != ErrNoAck {
+		t.Fatalf("Transfer to unknown address should fail with ErrNoAck, got: %v", answer)
+	}
+}
+
+// TestAckLoss tests that a peripheral with AckLoss 1 never acknowledges
+func TestAckLoss(t *testing.T) {
+	e := New()
+	e.AddPeripheral(&Peripheral{Address: testAddress, AckLoss: 1})
+	c := open(t, e)
+
+	answer, err := c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdSend), Payload: append(testAddress[:], 0x10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Err != ErrNoAck {
+		t.Fatalf("Send should fail with ErrNoAck, got: %v", answer)
+	}
+}
+
+// TestErrorsAndDrops tests forced error codes, unknown commands and dropped answers
+func TestErrorsAndDrops(t *testing.T) {
+	e := New()
+	c := open(t, e)
+
+	answer, err := c.Transfer(usbprotocol.Message{Cmd: 0xFE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Err != ErrNoCmd {
+		t.Fatalf("Unknown command should be answered with ErrNoCmd, got %v", answer)
+	}
+
+	e.SetError(CmdVersion, 0x55)
+	answer, err = c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdVersion)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Err != 0x55 {
+		t.Fatalf("Expected forced error code 0x55, got %v", answer)
+	}
+	e.SetError(CmdVersion, ErrNone)
+
+	e.DropAnswers(1)
+	_, err = c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdTest)})
+	if err != usbprotocol.ErrTimeout {
+		t.Fatalf("Expected timeout for dropped answer, got %v", err)
+	}
+}
+
+// TestLatency tests that answers are delayed by the configured latency
+func TestLatency(t *testing.T) {
+	e := New()
+	e.Latency = 50 * time.Millisecond
+	c := open(t, e)
+
+	start := time.Now()
+	if _, err := c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdTest)}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < e.Latency {
+		t.Fatalf("Answer arrived after %v, expected at least %v", d, e.Latency)
+	}
+}
+
+// TestReceive tests that injected messages from peripherals reach the host as CmdRx and CmdRxRadio packets
+func TestReceive(t *testing.T) {
+	e := New()
+	c := open(t, e)
+
+	lc := make(chan usbprotocol.Message, 1)
+	c.AddListener(usbprotocol.CmdRx, lc)
+	// make sure the pipe is served before injecting
+	if _, err := c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdTest)}); err != nil {
+		t.Fatal(err)
+	}
+
+	e.Receive(testAddress, Message{Cmd: 0x01, Payload: []byte{7, 8}})
+
+	select {
+	case msg := <-lc:
+		expected := append([]byte{0x01, 0}, append(testAddress[:], 7, 8)...)
+		if !bytes.Equal(msg.Payload, expected) {
+			t.Fatalf("Unexpected CmdRx payload: %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout, no message was received")
+	}
+
+	c.AddListener(usbprotocol.CmdRxRadio, lc)
+	e.ReceiveRadio(testAddress, Message{Cmd: 0x01, Payload: []byte{7}}, RadioInfo{Pipe: 1, RSSI: -60, Retransmits: 2})
+
+	select {
+	case msg := <-lc:
+		expected := append([]byte{0x01, 0}, append(testAddress[:], 3, 1, 0xC4, 2, 7)...)
+		if msg.Cmd != usbprotocol.CommandID(CmdRxRadio) || !bytes.Equal(msg.Payload, expected) {
+			t.Fatalf("Unexpected CmdRxRadio packet: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout, no message was received")
+	}
+}
+
+// TestPty tests that the emulator can be opened like a serial device
+func TestPty(t *testing.T) {
+	e := New()
+	pty, err := e.OpenPty()
+	if err != nil {
+		t.Skipf("pseudo terminals not available: %v", err)
+	}
+	defer pty.Close()
+
+	c := &usbprotocol.Conn{}
+	if err := c.Open(pty.Path); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	answer, err := c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdTest), Payload: []byte{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(answer.Payload, []byte{1, 2, 3}) {
+		t.Fatalf("Unexpected answer: %v", answer.Payload)
+	}
+}
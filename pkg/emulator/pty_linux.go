@@ -0,0 +1,91 @@
+//go:build linux
+// +build linux
+
+package emulator
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Pty is a pseudo terminal served by the emulator. Programs can open its Path like the serial port of a real device
+type Pty struct {
+	// Path is the name of the terminal device, e.g. /dev/pts/3
+	Path string
+
+	master *os.File
+	slave  *os.File
+}
+
+// OpenPty creates a pseudo terminal and serves the emulated firmware on it until Close() is called
+func (e *Emulator) OpenPty() (*Pty, error) {
+	// The master is opened non-blocking, so os.File uses the runtime poller and Close() interrupts pending reads
+	fd, err := syscall.Open("/dev/ptmx", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var unlock int32
+	if err := ioctl(uintptr(fd), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("could not unlock pty: %v", err)
+	}
+	var n uint32
+	if err := ioctl(uintptr(fd), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("could not get pty number: %v", err)
+	}
+	master := os.NewFile(uintptr(fd), "/dev/ptmx")
+	path := fmt.Sprintf("/dev/pts/%d", n)
+
+	// Keep the slave side open, so the master does not see a hangup between host connections. It is also switched to
+	// raw mode, otherwise the line discipline would echo packets sent before the host configured the port
+	slave, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	if err := makeRaw(slave.Fd()); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, fmt.Errorf("could not set pty to raw mode: %v", err)
+	}
+
+	go e.Serve(master)
+
+	return &Pty{Path: path, master: master, slave: slave}, nil
+}
+
+// Close removes the pseudo terminal and stops serving it
+func (p *Pty) Close() error {
+	p.slave.Close()
+	return p.master.Close()
+}
+
+func makeRaw(fd uintptr) error {
+	var t syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&t))); err != nil {
+		return err
+	}
+
+	// equivalent of cfmakeraw()
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+
+	return ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package emulator
+
+import "errors"
+
+// Pty is a pseudo terminal served by the emulator. Programs can open its Path like the serial port of a real device
+type Pty struct {
+	// Path is the name of the terminal device, e.g. /dev/pts/3
+	Path string
+}
+
+// OpenPty creates a pseudo terminal and serves the emulated firmware on it until Close() is called.
+// Pseudo terminals are only supported on linux
+func (e *Emulator) OpenPty() (*Pty, error) {
+	return nil, errors.New("pseudo terminals are not supported on this platform")
+}
+
+// Close removes the pseudo terminal and stops serving it
+func (p *Pty) Close() error {
+	return nil
+}
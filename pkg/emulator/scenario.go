@@ -0,0 +1,240 @@
+package emulator
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// Types
+///////////////////////////////////////////////////////////////////////////////
+
+// Responder is a scripted peripheral behaviour. Requests are dispatched to a handler by their command byte
+type Responder struct {
+	// Handlers holds the handler for each command byte
+	Handlers map[byte]HandlerFunc
+	// Default handles requests without a matching entry in Handlers. If nil, these requests are echoed back
+	Default HandlerFunc
+}
+
+// Scenario describes an emulated bridge and the peripherals around it, e.g. a house of sensors and switches.
+// Scenarios are usually loaded from a JSON file, see LoadScenario()
+type Scenario struct {
+	// FwVersion is the firmware version reported by the bridge, e.g. "1.2.0"
+	FwVersion string `json:"fw_version"`
+	// Latency delays every answer of the bridge, e.g. "5ms"
+	Latency     string               `json:"latency"`
+	Peripherals []ScenarioPeripheral `json:"peripherals"`
+}
+
+// ScenarioPeripheral describes a peripheral of a scenario
+type ScenarioPeripheral struct {
+	// Name is for documentation only
+	Name string `json:"name"`
+	// Address in dotted decimal notation, e.g. "111.111.111.111.1"
+	Address   string             `json:"address"`
+	AckLoss   float64            `json:"ack_loss"`
+	Silent    bool               `json:"silent"`
+	Responses []ScenarioResponse `json:"responses"`
+	Periodic  []ScenarioPeriodic `json:"periodic"`
+}
+
+// ScenarioResponse is the answer of a peripheral to requests with command byte Cmd. Requests without a response are
+// echoed back
+type ScenarioResponse struct {
+	Cmd ScenarioByte `json:"cmd"`
+	// AnswerCmd is the command byte of the answer, defaults to Cmd
+	AnswerCmd *ScenarioByte `json:"answer_cmd"`
+	Error     ScenarioByte  `json:"error"`
+	// Payload of the answer as hex string, e.g. "01ff"
+	Payload string `json:"payload"`
+	// Echo answers with the payload of the request instead of Payload
+	Echo bool `json:"echo"`
+}
+
+// ScenarioPeriodic is a message sent by a peripheral in a fixed interval
+type ScenarioPeriodic struct {
+	// Interval between two messages, e.g. "10s"
+	Interval string       `json:"interval"`
+	Cmd      ScenarioByte `json:"cmd"`
+	// Payload of the message as hex string, e.g. "01ff"
+	Payload string `json:"payload"`
+}
+
+// ScenarioByte is a byte in a scenario file, given either as number (16) or as string ("0x10")
+type ScenarioByte byte
+
+///////////////////////////////////////////////////////////////////////////////
+// Public API
+///////////////////////////////////////////////////////////////////////////////
+
+// Handle answers a request with the matching handler, it can be used as Handler of a Peripheral
+func (r *Responder) Handle(req Message) Message {
+	if h, ok := r.Handlers[req.Cmd]; ok {
+		return h(req)
+	}
+	if r.Default != nil {
+		return r.Default(req)
+	}
+	return Echo(req)
+}
+
+// Echo is a HandlerFunc which answers with the request
+func Echo(req Message) Message {
+	return req
+}
+
+// Reply returns a HandlerFunc which always answers with the same message
+func Reply(answer Message) HandlerFunc {
+	return func(req Message) Message {
+		return answer
+	}
+}
+
+// LoadScenario reads a scenario from a JSON file
+func LoadScenario(path string) (*Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseScenario(f)
+}
+
+// ParseScenario reads a scenario in JSON format
+func ParseScenario(r io.Reader) (*Scenario, error) {
+	s := &Scenario{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %v", err)
+	}
+	return s, nil
+}
+
+// Apply configures the emulator as described by the scenario and adds its peripherals
+func (s *Scenario) Apply(e *Emulator) error {
+	if s.FwVersion != "" {
+		var fw [3]byte
+		if _, err := fmt.Sscanf(s.FwVersion, "%d.%d.%d", &fw[0], &fw[1], &fw[2]); err != nil {
+			return fmt.Errorf("invalid firmware version %q: %v", s.FwVersion, err)
+		}
+		e.FwVersion = fw
+	}
+	if s.Latency != "" {
+		latency, err := time.ParseDuration(s.Latency)
+		if err != nil {
+			return fmt.Errorf("invalid latency: %v", err)
+		}
+		e.Latency = latency
+	}
+
+	peripherals := make([]*Peripheral, 0, len(s.Peripherals))
+	for _, sp := range s.Peripherals {
+		p, err := sp.peripheral()
+		if err != nil {
+			return fmt.Errorf("peripheral %q (%v): %v", sp.Name, sp.Address, err)
+		}
+		peripherals = append(peripherals, p)
+	}
+
+	for _, p := range peripherals {
+		e.AddPeripheral(p)
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (b *ScenarioByte) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+
+	v, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return fmt.Errorf("invalid byte value %v", string(data))
+	}
+	*b = ScenarioByte(v)
+
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private functions
+///////////////////////////////////////////////////////////////////////////////
+
+// peripheral creates the peripheral described in the scenario
+func (sp *ScenarioPeripheral) peripheral() (*Peripheral, error) {
+	addr, err := parseAddress(sp.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Responder{Handlers: make(map[byte]HandlerFunc)}
+	for _, sr := range sp.Responses {
+		h, err := sr.handler()
+		if err != nil {
+			return nil, fmt.Errorf("response to cmd 0x%02X: %v", byte(sr.Cmd), err)
+		}
+		r.Handlers[byte(sr.Cmd)] = h
+	}
+
+	p := &Peripheral{Address: addr, Handler: r.Handle, AckLoss: sp.AckLoss, Silent: sp.Silent}
+
+	for _, spm := range sp.Periodic {
+		interval, err := time.ParseDuration(spm.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval %q of periodic message", spm.Interval)
+		}
+		pl, err := hex.DecodeString(spm.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload of periodic message: %v", err)
+		}
+		p.Periodic = append(p.Periodic, PeriodicMessage{Interval: interval, Message: Message{Cmd: byte(spm.Cmd), Payload: pl}})
+	}
+
+	return p, nil
+}
+
+// handler creates the HandlerFunc described by the response
+func (sr *ScenarioResponse) handler() (HandlerFunc, error) {
+	pl, err := hex.DecodeString(sr.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload: %v", err)
+	}
+
+	answer := Message{Cmd: byte(sr.Cmd), Error: byte(sr.Error), Payload: pl}
+	if sr.AnswerCmd != nil {
+		answer.Cmd = byte(*sr.AnswerCmd)
+	}
+
+	if sr.Echo {
+		return func(req Message) Message {
+			return Message{Cmd: answer.Cmd, Error: answer.Error, Payload: req.Payload}
+		}, nil
+	}
+	return Reply(answer), nil
+}
+
+// parseAddress parses a pipeline address in dotted decimal notation, e.g. "111.111.111.111.1". The emulator can not
+// use esbbridge.ParseAddress(), because the tests of esbbridge import the emulator
+func parseAddress(s string) ([AddressSize]byte, error) {
+	var addr [AddressSize]byte
+
+	parts := strings.Split(s, ".")
+	if len(parts) != AddressSize {
+		return addr, fmt.Errorf("invalid address %q, expected %v dot separated bytes", s, AddressSize)
+	}
+	for i, p := range parts {
+		b, err := strconv.ParseUint(p, 10, 8)
+		if err != nil {
+			return addr, fmt.Errorf("invalid address %q: %v", s, err)
+		}
+		addr[i] = byte(b)
+	}
+
+	return addr, nil
+}
@@ -0,0 +1,119 @@
+package emulator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spritkopf/esb-bridge/internal/usbprotocol"
+)
+
+func transfer(t *testing.T, c *usbprotocol.Conn, addr [AddressSize]byte, cmd byte, pl []byte) usbprotocol.Message {
+	req := append(append(addr[:], cmd), pl...)
+	answer, err := c.Transfer(usbprotocol.Message{Cmd: usbprotocol.CommandID(CmdTransfer), Payload: req})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return answer
+}
+
+// TestResponder tests dispatching of requests to handlers by command byte
+func TestResponder(t *testing.T) {
+	r := &Responder{Handlers: map[byte]HandlerFunc{0x10: Reply(Message{Cmd: 0x10, Payload: []byte{1}})}}
+
+	if answer := r.Handle(Message{Cmd: 0x10}); !bytes.Equal(answer.Payload, []byte{1}) {
+		t.Fatalf("Unexpected answer: %v", answer)
+	}
+	if answer := r.Handle(Message{Cmd: 0x11, Payload: []byte{2}}); !bytes.Equal(answer.Payload, []byte{2}) {
+		t.Fatalf("Requests without handler should be echoed, got: %v", answer)
+	}
+
+	r.Default = Reply(Message{Error: 0x05})
+	if answer := r.Handle(Message{Cmd: 0x11}); answer.Error != 0x05 {
+		t.Fatalf("Requests without handler should be answered by Default, got: %v", answer)
+	}
+}
+
+// TestScenario tests the example scenario file
+func TestScenario(t *testing.T) {
+	s, err := LoadScenario("testdata/house.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := New()
+	defer e.Close()
+	if err := s.Apply(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.FwVersion != [3]byte{1, 2, 0} || e.Latency != 2*time.Millisecond {
+		t.Fatalf("Unexpected emulator configuration: %v, %v", e.FwVersion, e.Latency)
+	}
+
+	c := open(t, e)
+	lc := make(chan usbprotocol.Message, 10)
+	c.AddListener(usbprotocol.CmdRx, lc)
+
+	sensor := [AddressSize]byte{111, 111, 111, 111, 1}
+	light := [AddressSize]byte{111, 111, 111, 111, 2}
+	garden := [AddressSize]byte{111, 111, 111, 111, 3}
+
+	if answer := transfer(t, c, sensor, 0x20, nil); !bytes.Equal(answer.Payload, []byte{0x20, 0, 0xd7, 0}) {
+		t.Fatalf("Unexpected canned answer: %v", answer)
+	}
+	if answer := transfer(t, c, light, 0x30, []byte{1}); !bytes.Equal(answer.Payload, []byte{0x30, 0, 1}) {
+		t.Fatalf("Unexpected echo answer: %v", answer)
+	}
+	if answer := transfer(t, c, light, 0x31, nil); !bytes.Equal(answer.Payload, []byte{0x31, 1}) {
+		t.Fatalf("Unexpected error answer: %v", answer)
+	}
+	if answer := transfer(t, c, light, 0x77, []byte{3}); !bytes.Equal(answer.Payload, []byte{0x77, 0, 3}) {
+		t.Fatalf("Requests without response should be echoed, got: %v", answer)
+	}
+	if answer := transfer(t, c, garden, 0x10, nil); answer.Err != ErrNoAck {
+		t.Fatalf("Silent peripheral should not acknowledge, got: %v", answer)
+	}
+
+	// only the sensor sends its periodic message, the garden sensor is silent
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-lc:
+			if !bytes.Equal(msg.Payload[2:7], sensor[:]) {
+				t.Fatalf("Unexpected periodic message: %v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout, no periodic message was received")
+		}
+	}
+
+	// out of range sensor comes back
+	if err := e.SetSilent(garden, false); err != nil {
+		t.Fatal(err)
+	}
+	if answer := transfer(t, c, garden, 0x10, []byte{4}); answer.Err != ErrNone {
+		t.Fatalf("Peripheral should acknowledge after leaving silent mode, got: %v", answer)
+	}
+}
+
+// TestScenarioInvalid tests the error handling of invalid scenarios
+func TestScenarioInvalid(t *testing.T) {
+	scenarios := []string{
+		`{"fw_version": "one"}`,
+		`{"latency": "fast"}`,
+		`{"peripherals": [{"address": "1.2.3"}]}`,
+		`{"peripherals": [{"address": "1.2.3.4.5", "responses": [{"cmd": "0x100"}]}]}`,
+		`{"peripherals": [{"address": "1.2.3.4.5", "responses": [{"cmd": 1, "payload": "xyz"}]}]}`,
+		`{"peripherals": [{"address": "1.2.3.4.5", "periodic": [{"interval": "0s"}]}]}`,
+	}
+
+	for _, js := range scenarios {
+		s, err := ParseScenario(strings.NewReader(js))
+		if err == nil {
+			err = s.Apply(New())
+		}
+		if err == nil {
+			t.Fatalf("Scenario %v should be rejected", js)
+		}
+	}
+}
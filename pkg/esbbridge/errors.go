@@ -0,0 +1,135 @@
+package esbbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spritkopf/esb-bridge/internal/usbprotocol"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// Types and constants
+///////////////////////////////////////////////////////////////////////////////
+
+// Error codes of the esb-bridge firmware, see FirmwareError
+const (
+	// FwErrNoCmd - the firmware does not know the USB command
+	FwErrNoCmd byte = 0x10
+	// FwErrParam - invalid parameters of the USB command
+	FwErrParam byte = 0x11
+	// FwErrNoAck - the ESB peripheral did not acknowledge the message
+	FwErrNoAck byte = 0x20
+)
+
+// FirmwareError is returned if the firmware answered a USB command with an error code.
+// errors.Is(err, ErrNoAck) is true for a FirmwareError with Code FwErrNoAck
+type FirmwareError struct {
+	// Cmd is the USB command ID, e.g. UsbCmdTransfer
+	Cmd byte
+	// Code is the error code returned by the firmware, e.g. FwErrNoAck
+	Code byte
+}
+
+// ProtocolError is returned if the device sent an answer which does not match the USB protocol, e.g. a payload too
+// short for the command. errors.Is(err, ErrProtocol) is true for a ProtocolError
+type ProtocolError struct {
+	// Cmd is the USB command ID of the answer, e.g. UsbCmdTransfer
+	Cmd byte
+	// Payload is the invalid payload of the answer
+	Payload []byte
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Public API
+///////////////////////////////////////////////////////////////////////////////
+
+// ErrNotConnected is returned if the bridge was not opened or was closed
+var ErrNotConnected = errors.New("Device is not connected, call Open() first")
+
+// ErrUnavailable is returned while the connection to the device is lost and the bridge tries to reconnect
+var ErrUnavailable = errors.New("esb-bridge device temporarily unavailable, reconnecting")
+
+// ErrTimeout is returned if the device did not answer in time
+var ErrTimeout = usbprotocol.ErrTimeout
+
+// ErrPayloadTooLarge is returned if the payload of a message exceeds MaxPayloadSize
+var ErrPayloadTooLarge = errors.New("Payload too long")
+
+// ErrInvalidParam is returned for invalid parameters, e.g. a nil listener channel
+var ErrInvalidParam = errors.New("invalid parameter")
+
+// ErrDisconnected is returned by Subscription.Err() if the listener was disconnected by the Disconnect overflow
+// policy, because it did not keep up with the incoming messages
+var ErrDisconnected = errors.New("listener disconnected, it did not keep up with the incoming messages")
+
+// ErrNoAck is matched by a FirmwareError if the ESB peripheral did not acknowledge a message
+var ErrNoAck = errors.New("ESB peripheral did not acknowledge the message")
+
+// ErrProtocol is matched by a ProtocolError if the device sent an invalid answer
+var ErrProtocol = errors.New("invalid answer of the esb-bridge device")
+
+func (e *FirmwareError) Error() string {
+	if e.Code == FwErrNoAck {
+		return fmt.Sprintf("USB command 0x%02X failed: %v", e.Cmd, ErrNoAck)
+	}
+	return fmt.Sprintf("USB command 0x%02X returned with error code: 0x%02X", e.Cmd, e.Code)
+}
+
+// Is reports whether the error matches target, a FirmwareError with the same Cmd and Code or ErrNoAck
+func (e *FirmwareError) Is(target error) bool {
+	if target == ErrNoAck {
+		return e.Code == FwErrNoAck
+	}
+	t, ok := target.(*FirmwareError)
+	return ok && *t == *e
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%v: USB command 0x%02X, payload %v", ErrProtocol, e.Cmd, e.Payload)
+}
+
+// Is reports whether the error matches target, which is true for ErrProtocol
+func (e *ProtocolError) Is(target error) bool {
+	return target == ErrProtocol
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private functions
+///////////////////////////////////////////////////////////////////////////////
+
+// checkAnswer converts the errors of a USB transfer into the errors of this package, so no error of usbprotocol or of
+// the port reaches the callers
+func checkAnswer(answer usbprotocol.Message, err error) error {
+	switch {
+	case err == nil:
+	case errors.Is(err, usbprotocol.ErrDeviceLost):
+		return ErrUnavailable
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, usbprotocol.ErrSize):
+		return payloadTooLarge()
+	case errors.Is(err, usbprotocol.ErrCmdMismatch):
+		return fmt.Errorf("%w: %v", ErrProtocol, err)
+	case errors.Is(err, usbprotocol.ErrParam):
+		return fmt.Errorf("%w: %v", ErrInvalidParam, err)
+	default:
+		// ErrSerial or an error of the port, the connection to the device is about to be reopened
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if answer.Err != 0 {
+		return &FirmwareError{Cmd: byte(answer.Cmd), Code: answer.Err}
+	}
+	return nil
+}
+
+// invalidAddress returns an error for a message address which is not AddressSize bytes long. The firmware would read
+// the bytes after the first AddressSize bytes as command and payload
+func invalidAddress(address []byte) error {
+	return fmt.Errorf("%w: address %v, expected %v bytes", ErrInvalidParam, address, AddressSize)
+}
+
+// payloadTooLarge returns an error for a message payload exceeding MaxPayloadSize
+func payloadTooLarge() error {
+	return fmt.Errorf("%w, maximum is %v", ErrPayloadTooLarge, MaxPayloadSize)
+}
@@ -1,9 +1,14 @@
 package esbbridge
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/spritkopf/esb-bridge/internal/usbprotocol"
 )
@@ -28,14 +33,41 @@ const (
 	UsbCmdSend usbprotocol.CommandID = 0x31
 	// UsbCmdRx - callback from incoming ESB message
 	UsbCmdRx usbprotocol.CommandID = 0x81
+	// UsbCmdRxRadio - callback from incoming ESB message with radio metadata, sent instead of UsbCmdRx by firmware
+	// which reports it. Payload: ESB cmd, status, address, length of the metadata, metadata, ESB payload
+	UsbCmdRxRadio usbprotocol.CommandID = 0x82
 )
 
+// radioInfoSize is the size of the radio metadata decoded into RadioInfo. Firmware may send more metadata, which is
+// skipped
+const radioInfoSize = 3
+
 // EsbMessage is the data type representing a message sent between esb devices
 type EsbMessage struct {
 	Address []byte
 	Cmd     byte
+	// Error is the error or status byte reported by the firmware for answers and incoming messages
 	Error   byte
 	Payload []byte
+	// Dropped is the number of messages dropped for a listener before this message, because the listener did not
+	// keep up, see OverflowPolicy. Only set for messages delivered to listeners
+	Dropped uint64
+	// Seq and Timestamp are set for answers and incoming messages: Seq numbers all messages received by the bridge
+	// in the order of their arrival, Timestamp is the time of arrival
+	Seq       uint64
+	Timestamp time.Time
+	// Radio is the radio metadata of an incoming message, nil if the firmware does not report it
+	Radio *RadioInfo
+}
+
+// RadioInfo is the radio metadata of an incoming message, reported by firmware which sends UsbCmdRxRadio
+type RadioInfo struct {
+	// Pipe is the ESB pipe the message was received on
+	Pipe uint8
+	// RSSI is the signal strength of the message in dBm
+	RSSI int8
+	// Retransmits is the number of retransmissions the peripheral needed to deliver the message
+	Retransmits uint8
 }
 
 // ListenerChannel is used to notify a subscriber about a incoming message it was listening for
@@ -48,6 +80,45 @@ type Listener struct {
 	Channel    ListenerChannel
 }
 
+// LinkStats holds counters about the health of the USB link to the bridge device (received and sent packets,
+// resynchronisations of the packet stream, CRC errors, dropped bytes)
+type LinkStats = usbprotocol.Stats
+
+// Bridge is a connection to an esb bridge device. It owns the underlying usb connection and the registered listeners.
+// The zero value is a disconnected bridge, call Open() or OpenTransport() before transferring messages.
+// A bridge opened with Open() reopens the device automatically if the connection is lost, see ConnectionState
+type Bridge struct {
+	seq usbprotocol.Sequence // first member, must be 64 bit aligned. Numbers the received messages of all connections
+
+	// ReconnectDelay is the delay before the first attempt to reopen a lost device, it is doubled after every
+	// failed attempt. If set to 0, DefaultReconnectDelay is used
+	ReconnectDelay time.Duration
+	// ReconnectMaxDelay limits the delay between two attempts to reopen a lost device.
+	// If set to 0, DefaultReconnectMaxDelay is used
+	ReconnectMaxDelay time.Duration
+
+	// mu protects conn, requests, state, stop, stateListeners, device, openedAt, fwVersion and radioInfo
+	mu             sync.Mutex
+	conn           *usbprotocol.Conn
+	requests       *sync.WaitGroup // requests running on conn, see acquire()
+	state          ConnectionState
+	device         string        // device path passed to Open(), empty if opened over a transport
+	openedAt       time.Time     // time of the last Open() or OpenTransport() call
+	fwVersion      FwVersion     // firmware version read when the device was connected, or read last
+	radioInfo      bool          // the device sent radio metadata since it was connected, see CapRadioInfo
+	stop           chan struct{} // closed by Close(), stops the reconnect goroutine
+	stateListeners []StateChannel
+
+	listenersMutex sync.RWMutex // protects listeners and sessions
+	listeners      []*listener  // Stores callback channels associated to commandIDs and addresses to listen for
+	sessions       []*Session
+	stats          trafficStats
+
+	dispatchMutex sync.Mutex    // protects dispatched and dispatchWake
+	dispatched    uint64        // sequence number of the last dispatched incoming message
+	dispatchWake  chan struct{} // closed when a message was dispatched, created by waitDispatched()
+}
+
 func (m EsbMessage) String() string {
 	return fmt.Sprintf("Addr: %v Cmd: %v, Error: %v, Payload: %v", m.Address, m.Cmd, m.Error, m.Payload)
 }
@@ -56,164 +127,519 @@ func (m EsbMessage) String() string {
 // Private variables
 ///////////////////////////////////////////////////////////////////////////////
 
-var connected bool = false
-var listeners []Listener // Stores callback channels associated to commandIDs and addresses to listen for
+var defaultBridge Bridge // bridge used by the package level API
 
 ///////////////////////////////////////////////////////////////////////////////
 // Public API
 ///////////////////////////////////////////////////////////////////////////////
 
+// Open opens the connection of the default bridge, see Bridge.Open()
+func Open(device string) error {
+	return defaultBridge.Open(device)
+}
+
+// OpenTransport opens the connection of the default bridge over an already opened transport, see Bridge.OpenTransport()
+func OpenTransport(t io.ReadWriteCloser) error {
+	return defaultBridge.OpenTransport(t)
+}
+
+// Close closes the connection of the default bridge
+func Close() {
+	defaultBridge.Close()
+}
+
+// GetFwVersion reads the firmware version of the default bridge, see Bridge.GetFwVersion()
+func GetFwVersion() (string, error) {
+	return defaultBridge.GetFwVersion()
+}
+
+// Transfer sends a message to an ESB device using the default bridge, see Bridge.Transfer()
+func Transfer(message EsbMessage) (EsbMessage, error) {
+	return defaultBridge.Transfer(message)
+}
+
+// TransferContext sends a message to an ESB device using the default bridge, see Bridge.TransferContext()
+func TransferContext(ctx context.Context, message EsbMessage) (EsbMessage, error) {
+	return defaultBridge.TransferContext(ctx, message)
+}
+
+// Send sends a message to an ESB device using the default bridge without waiting for a reply, see Bridge.Send()
+func Send(message EsbMessage) error {
+	return defaultBridge.Send(message)
+}
+
+// SendContext sends a message to an ESB device using the default bridge without waiting for a reply,
+// see Bridge.SendContext()
+func SendContext(ctx context.Context, message EsbMessage) error {
+	return defaultBridge.SendContext(ctx, message)
+}
+
+// AddListener adds a listenener to the default bridge, see Bridge.AddListener()
+func AddListener(sourceAddr [AddressSize]byte, cmd byte, c ListenerChannel) error {
+	return defaultBridge.AddListener(sourceAddr, cmd, c)
+}
+
+// RemoveListener removes a listenener from the default bridge, see Bridge.RemoveListener()
+func RemoveListener(c ListenerChannel) int {
+	return defaultBridge.RemoveListener(c)
+}
+
+// GetLinkStats returns the USB link counters of the default bridge, see Bridge.LinkStats()
+func GetLinkStats() LinkStats {
+	return defaultBridge.LinkStats()
+}
+
+// ParseAddress parses a pipeline address in dotted decimal notation, e.g. "111.111.111.111.1"
+func ParseAddress(s string) ([AddressSize]byte, error) {
+	var addr [AddressSize]byte
+
+	parts := strings.Split(s, ".")
+	if len(parts) != AddressSize {
+		return addr, fmt.Errorf("%w: address %q, expected %v dot separated bytes", ErrInvalidParam, s, AddressSize)
+	}
+	for i, p := range parts {
+		b, err := strconv.ParseUint(p, 10, 8)
+		if err != nil {
+			return addr, fmt.Errorf("%w: address %q: %v", ErrInvalidParam, s, err)
+		}
+		addr[i] = byte(b)
+	}
+
+	return addr, nil
+}
+
 // Open opens the connection to the esb bridge device
 // Parameters:
-//   device	- device string , e.g. "/dev/ttyACM0"
-func Open(device string) error {
-	err := usbprotocol.Open(device)
+//   device	- device string , e.g. "/dev/ttyACM0" or "tcp://localhost:3333" for a serial-over-TCP server
+//
+// If the connection to the device is lost, it is reopened in the background. The same device path or a udev
+// by-id path (/dev/serial/by-id/...) of the same device is tried, so a dongle which re-enumerates under a different
+// name is found again
+func (b *Bridge) Open(device string) error {
+	conn := &usbprotocol.Conn{Sequence: &b.seq}
+	err := conn.Open(device)
 
 	if err != nil {
 		return fmt.Errorf("Could not connect to device %v: %v", device, err)
 	}
-	connected = true
 
-	rxChannel := make(chan usbprotocol.Message, 5)
-	// start listening for all incoming messages with Command ID "CmdRx"
-	err = usbprotocol.AddListener(usbprotocol.CmdRx, rxChannel)
+	return b.start(conn, device)
+}
 
-	go rxCallbackThread(rxChannel)
+// OpenTransport opens the connection to the esb bridge device over an already opened transport
+// (e.g. a pty, a TCP socket or an in-memory pipe). The transport is closed by Close(). A lost transport can not
+// be reopened, the bridge changes to StateDisconnected
+func (b *Bridge) OpenTransport(t io.ReadWriteCloser) error {
+	conn := &usbprotocol.Conn{Sequence: &b.seq}
+	err := conn.OpenTransport(t)
 
-	return err
+	if err != nil {
+		return fmt.Errorf("Could not connect to device over transport: %v", err)
+	}
+
+	return b.start(conn, "")
 }
 
 // Close closes the connection to the esb bridge device
-func Close() {
-	usbprotocol.Close()
+func (b *Bridge) Close() {
+	b.mu.Lock()
+	conn, requests := b.detach()
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+	b.mu.Unlock()
+
+	if conn != nil {
+		// running requests fail when the connection is closed
+		conn.Close()
+		requests.Wait()
+	}
+	b.setState(StateDisconnected, nil)
+}
+
+// LinkStats returns the USB link counters of the current connection to the device. Returns zero counters if the
+// bridge is not connected
+func (b *Bridge) LinkStats() LinkStats {
+	conn, err := b.connection()
+	if err != nil {
+		return LinkStats{}
+	}
+	return conn.Stats()
 }
 
 // GetFwVersion reads the firmware version of the conected esb-bridge
 // Returns the firmware version as string in format "maj.min.patch"
-func GetFwVersion() (string, error) {
-	if !connected {
-		return "", errors.New("Device is not connected, call Open() first")
+func (b *Bridge) GetFwVersion() (string, error) {
+	v, err := b.FwVersion()
+	if err != nil {
+		return "", err
 	}
 
-	txMsg := usbprotocol.Message{}
-	txMsg.Cmd = UsbCmdVersion
-	answerMessage, err := usbprotocol.Transfer(txMsg)
+	return v.String(), nil
+}
 
-	if answerMessage.Err != 0x00 {
-		return "", fmt.Errorf("Command CmdVersion (0x%02X) returned Error 0x%02X", UsbCmdVersion, answerMessage.Err)
+// FwVersion reads the firmware version of the connected esb-bridge
+func (b *Bridge) FwVersion() (FwVersion, error) {
+	conn, release, err := b.acquire()
+	if err != nil {
+		return FwVersion{}, err
 	}
 
+	v, err := readFwVersion(conn)
+	release()
 	if err != nil {
-		return "", err
+		return FwVersion{}, err
 	}
-	versionStr := fmt.Sprintf("%v.%v.%v", answerMessage.Payload[0], answerMessage.Payload[1], answerMessage.Payload[2])
-	return versionStr, nil
+
+	b.mu.Lock()
+	b.fwVersion = v
+	b.mu.Unlock()
+
+	return v, nil
 }
 
 // Transfer sends a message to an ESB device and returns the answer
-func Transfer(message EsbMessage) (EsbMessage, error) {
-	if !connected {
-		return EsbMessage{}, errors.New("Device is not connected, call Open() first")
+func (b *Bridge) Transfer(message EsbMessage) (EsbMessage, error) {
+	return b.TransferContext(context.Background(), message)
+}
+
+// TransferContext sends a message to an ESB device and returns the answer. The answer is awaited until the deadline
+// of ctx or the timeout of the USB connection, whichever expires first. If ctx is canceled, ctx.Err() is returned
+func (b *Bridge) TransferContext(ctx context.Context, message EsbMessage) (EsbMessage, error) {
+	conn, release, err := b.acquire()
+	if err != nil {
+		return EsbMessage{}, err
 	}
+	defer release()
 
+	if len(message.Address) != AddressSize {
+		return EsbMessage{}, invalidAddress(message.Address)
+	}
 	if len(message.Payload) > int(MaxPayloadSize) {
-		return EsbMessage{}, fmt.Errorf("Payload too long, maximum is %v", MaxPayloadSize)
+		return EsbMessage{}, payloadTooLarge()
 	}
 
 	if message.Payload == nil {
 		message.Payload = []byte{}
 	}
 
-	txMsg := usbprotocol.Message{}
-	txMsg.Cmd = UsbCmdTransfer
-	txMsg.Payload = append(txMsg.Payload, message.Address...)
-	txMsg.Payload = append(txMsg.Payload, message.Cmd)
-	txMsg.Payload = append(txMsg.Payload, message.Payload...)
-
-	answerMessage, err := usbprotocol.Transfer(txMsg)
+	answerMessage, err := conn.TransferContext(ctx, esbRequest(UsbCmdTransfer, message))
 
+	err = checkAnswer(answerMessage, err)
+	b.stats.countSent(message.Address, true, err)
 	if err != nil {
 		return EsbMessage{}, err
 	}
 
-	if answerMessage.Err != 0 {
-		return EsbMessage{}, fmt.Errorf("ESB Transfer command returned with error code: 0x%02X", answerMessage.Err)
-	}
+	return decodeAnswer(message, answerMessage)
+}
 
-	message.Cmd = answerMessage.Payload[0]
-	message.Error = answerMessage.Payload[1]
-	message.Payload = answerMessage.Payload[2:]
-	return message, nil
+// Send sends a message to an ESB device without waiting for a reply, e.g. to devices which never answer.
+// Returns as soon as the peripheral acknowledged the message, an error is returned if it did not
+func (b *Bridge) Send(message EsbMessage) error {
+	return b.SendContext(context.Background(), message)
+}
+
+// SendContext sends a message to an ESB device without waiting for a reply, like Send(). The acknowledgement is
+// awaited until the deadline of ctx or the timeout of the USB connection, whichever expires first
+func (b *Bridge) SendContext(ctx context.Context, message EsbMessage) error {
+	_, err := b.send(ctx, message)
+	return err
 }
 
-// AddListener adds a listenener. Any incoming message with this CommandID and/or address will be redirected to c
+// AddListener adds a listenener. Any incoming message with this CommandID and/or address will be redirected to c.
+// Up to DefaultListenerQueueSize messages are queued for c, then the oldest ones are dropped, see
+// AddListenerWithOptions()
 // Params:
 //   sourceAddr - only messages from this sender will be evaluated, an empty array is used to ignore this filter (all senders will be evaluated)
 //   cmd        - only messages with a specific cmd byte (the 1st payload byte) will be evaluated, set to 0xFF to ignore the filter (all message IDs will be evaluated)
-func AddListener(sourceAddr [AddressSize]byte, cmd byte, c ListenerChannel) error {
+func (b *Bridge) AddListener(sourceAddr [AddressSize]byte, cmd byte, c ListenerChannel) error {
+	return b.AddListenerWithOptions(sourceAddr, cmd, c, ListenerOptions{})
+}
+
+// RemoveListener removes a listenener. Any listener which was registered for the specified channel will be deleted.
+// No more messages are delivered to the channel after RemoveListener() returned.
+// Returns the number of deleted listeners
+func (b *Bridge) RemoveListener(c ListenerChannel) int {
+	return b.removeListeners(func(l *listener) bool { return l.Channel == c })
+}
 
-	if c == nil {
-		return errors.New("invalid parameter passed for listener channel (nil)")
+///////////////////////////////////////////////////////////////////////////////
+// Private functions
+///////////////////////////////////////////////////////////////////////////////
+
+// start takes over the opened usb connection and starts listening for incoming ESB messages. If device is not
+// empty, the connection is reopened when it gets lost. Fails if the device does not answer with its firmware version
+func (b *Bridge) start(conn *usbprotocol.Conn, device string) error {
+	v, err := readFwVersion(conn)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Could not read firmware version: %w", err)
 	}
 
-	listeners = append(listeners, Listener{SourceAddr: sourceAddr, Cmd: cmd, Channel: c})
+	b.Close()
+
+	stop := make(chan struct{})
+	b.mu.Lock()
+	b.stop = stop
+	b.device = device
+	b.openedAt = time.Now()
+	b.fwVersion = v
+	b.radioInfo = false
+	b.mu.Unlock()
+
+	err = b.attach(conn, stop)
+	if err != nil {
+		return err
+	}
+
+	go b.supervise(conn, device, stop)
 
 	return nil
 }
 
-// RemoveListener removes a listenener. Any listener which was registered for the specified channel will be deleted.
-// Returns the number of deleted listeners
-func RemoveListener(c ListenerChannel) int {
+// attach makes conn the current connection of the bridge and starts dispatching its incoming messages.
+// Fails if the bridge was closed meanwhile
+func (b *Bridge) attach(conn *usbprotocol.Conn, stop <-chan struct{}) error {
+	rxChannel := make(chan usbprotocol.Message, 5)
+	// start listening for all incoming messages with Command ID "CmdRx", or "CmdRxRadio" of newer firmware
+	for _, cmd := range []usbprotocol.CommandID{usbprotocol.CmdRx, usbprotocol.CmdRxRadio} {
+		if err := conn.AddListener(cmd, rxChannel); err != nil {
+			conn.Close()
+			return err
+		}
+	}
 
-	var itemsDeleted int = 0
-searchLoop:
-	for {
-		for i, l := range listeners {
-			if l.Channel == c {
-				// listener channel matches, remove item
-				listeners = append(listeners[:i], listeners[i+1:]...)
-				itemsDeleted++
-				// restart search since the listeners slice is shorter now
-				continue searchLoop
-			}
+	b.mu.Lock()
+	select {
+	case <-stop:
+		b.mu.Unlock()
+		conn.Close()
+		return errors.New("bridge was closed")
+	default:
+	}
+	b.conn = conn
+	b.requests = &sync.WaitGroup{}
+	b.mu.Unlock()
+
+	go b.rxCallbackThread(rxChannel, conn.Done())
+
+	b.setState(StateConnected, nil)
+
+	return nil
+}
+
+// send sends a message like SendContext(). Returns the message with Seq and Timestamp of the acknowledgement
+func (b *Bridge) send(ctx context.Context, message EsbMessage) (EsbMessage, error) {
+	conn, release, err := b.acquire()
+	if err != nil {
+		return EsbMessage{}, err
+	}
+	defer release()
+
+	if len(message.Address) != AddressSize {
+		return EsbMessage{}, invalidAddress(message.Address)
+	}
+	if len(message.Payload) > int(MaxPayloadSize) {
+		return EsbMessage{}, payloadTooLarge()
+	}
+
+	answerMessage, err := conn.TransferContext(ctx, esbRequest(UsbCmdSend, message))
+
+	err = checkAnswer(answerMessage, err)
+	b.stats.countSent(message.Address, false, err)
+	if err != nil {
+		return EsbMessage{}, err
+	}
+
+	message.Seq = answerMessage.Seq
+	message.Timestamp = answerMessage.Time
+	return message, nil
+}
+
+// decodeAnswer fills the answer of a UsbCmdTransfer request into message. Payload: ESB cmd, status, ESB payload
+func decodeAnswer(message EsbMessage, answer usbprotocol.Message) (EsbMessage, error) {
+	if len(answer.Payload) < 2 {
+		return EsbMessage{}, &ProtocolError{Cmd: byte(answer.Cmd), Payload: answer.Payload}
+	}
+
+	message.Cmd = answer.Payload[0]
+	message.Error = answer.Payload[1]
+	message.Payload = answer.Payload[2:]
+	message.Seq = answer.Seq
+	message.Timestamp = answer.Time
+	return message, nil
+}
+
+// esbRequest builds the USB request for the ESB commands UsbCmdTransfer and UsbCmdSend
+func esbRequest(cmd usbprotocol.CommandID, message EsbMessage) usbprotocol.Message {
+	txMsg := usbprotocol.Message{}
+	txMsg.Cmd = cmd
+	txMsg.Payload = append(txMsg.Payload, message.Address...)
+	txMsg.Payload = append(txMsg.Payload, message.Cmd)
+	txMsg.Payload = append(txMsg.Payload, message.Payload...)
+
+	return txMsg
+}
+
+// connection returns the current connection to the device
+func (b *Bridge) connection() (*usbprotocol.Conn, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		if b.state == StateReconnecting {
+			return nil, ErrUnavailable
 		}
-		// if no more occurences are found, we are finished
-		break searchLoop
+		return nil, ErrNotConnected
 	}
+	return b.conn, nil
+}
 
-	return itemsDeleted
+// acquire returns the current connection to the device for a request. release must be called when the request
+// is done, the connection is not closed by the bridge before
+func (b *Bridge) acquire() (conn *usbprotocol.Conn, release func(), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		if b.state == StateReconnecting {
+			return nil, nil, ErrUnavailable
+		}
+		return nil, nil, ErrNotConnected
+	}
+	b.requests.Add(1)
+	return b.conn, b.requests.Done, nil
 }
 
-///////////////////////////////////////////////////////////////////////////////
-// Private functions
-///////////////////////////////////////////////////////////////////////////////
+// detach removes the current connection from the bridge, so no more requests are started on it. Returns the
+// connection and its running requests, nil if there is none. b.mu must be held
+func (b *Bridge) detach() (*usbprotocol.Conn, *sync.WaitGroup) {
+	conn, requests := b.conn, b.requests
+	b.conn = nil
+	b.requests = nil
+	return conn, requests
+}
 
-func rxCallbackThread(ch chan usbprotocol.Message) {
+// readFwVersion reads the firmware version over the connection
+func readFwVersion(conn *usbprotocol.Conn) (FwVersion, error) {
+	txMsg := usbprotocol.Message{}
+	txMsg.Cmd = UsbCmdVersion
+	answerMessage, err := conn.Transfer(txMsg)
 
-	for {
-		usbMsg := <-ch
+	if err := checkAnswer(answerMessage, err); err != nil {
+		return FwVersion{}, err
+	}
+
+	if len(answerMessage.Payload) < 3 {
+		return FwVersion{}, &ProtocolError{Cmd: byte(answerMessage.Cmd), Payload: answerMessage.Payload}
+	}
+	return FwVersion{Major: answerMessage.Payload[0], Minor: answerMessage.Payload[1], Patch: answerMessage.Payload[2]}, nil
+}
+
+func (b *Bridge) rxCallbackThread(ch chan usbprotocol.Message, done <-chan struct{}) {
 
-		// check payload size, must at least contain a source address (5 bytes), error, and a cmd ID
-		if len(usbMsg.Payload) < 7 {
+	for {
+		var usbMsg usbprotocol.Message
+		select {
+		case usbMsg = <-ch:
+		case <-done:
 			return
 		}
 
-		message := EsbMessage{}
+		message, ok := decodeRx(usbMsg)
+		if !ok {
+			b.setDispatched(usbMsg.Seq)
+			continue
+		}
+		b.stats.countReceived(message)
+		if message.Radio != nil {
+			b.setRadioInfo()
+		}
+
+		// queue message for all registered and matching listeners
+		b.dispatch(message)
+		b.setDispatched(message.Seq)
+	}
+}
+
+// setRadioInfo records that the device sends radio metadata
+func (b *Bridge) setRadioInfo() {
+	b.mu.Lock()
+	b.radioInfo = true
+	b.mu.Unlock()
+}
+
+// decodeRx decodes an incoming message sent with UsbCmdRx or UsbCmdRxRadio. Returns false if the message is too short
+func decodeRx(usbMsg usbprotocol.Message) (EsbMessage, bool) {
+	// payload must at least contain a cmd ID, the status and a source address (5 bytes)
+	pl := usbMsg.Payload
+	if len(pl) < 2+AddressSize {
+		return EsbMessage{}, false
+	}
+
+	message := EsbMessage{Seq: usbMsg.Seq, Timestamp: usbMsg.Time}
+	message.Cmd = pl[0]
+	message.Error = pl[1]
+	message.Address = pl[2 : 2+AddressSize]
+	pl = pl[2+AddressSize:]
+
+	if usbMsg.Cmd == UsbCmdRxRadio {
+		if len(pl) < 1 || len(pl) < 1+int(pl[0]) {
+			return EsbMessage{}, false
+		}
+		radio := pl[1 : 1+int(pl[0])]
+		if len(radio) >= radioInfoSize {
+			message.Radio = &RadioInfo{Pipe: radio[0], RSSI: int8(radio[1]), Retransmits: radio[2]}
+		}
+		pl = pl[1+len(radio):]
+	}
+
+	if len(pl) > 0 {
+		message.Payload = pl
+	}
+	return message, true
+}
+
+// setDispatched records the sequence number of the last dispatched incoming message and wakes waitDispatched()
+func (b *Bridge) setDispatched(seq uint64) {
+	b.dispatchMutex.Lock()
+	defer b.dispatchMutex.Unlock()
 
-		message.Cmd = usbMsg.Payload[0]
-		// message error (usbMsg.Payload[1]) is discarded for CmdRx, should always be OK
-		message.Address = usbMsg.Payload[2:7]
+	b.dispatched = seq
+	if b.dispatchWake != nil {
+		close(b.dispatchWake)
+		b.dispatchWake = nil
+	}
+}
 
-		if len(usbMsg.Payload) > 7 {
-			message.Payload = usbMsg.Payload[7:]
+// waitDispatched waits until the incoming messages passed on by the current connection were dispatched to the
+// listeners and sessions. Called after a transfer returned, all incoming messages received before its answer are
+// dispatched then
+func (b *Bridge) waitDispatched() {
+	conn, err := b.connection()
+	if err != nil {
+		return
+	}
+	seq := conn.ListenerSeq()
+
+	for {
+		b.dispatchMutex.Lock()
+		if b.dispatched >= seq {
+			b.dispatchMutex.Unlock()
+			return
 		}
+		if b.dispatchWake == nil {
+			b.dispatchWake = make(chan struct{})
+		}
+		wake := b.dispatchWake
+		b.dispatchMutex.Unlock()
 
-		// send message to all registered and matching listeners
-		for _, l := range listeners {
-			if ((l.Cmd == 0xFF) || (l.Cmd == message.Cmd)) &&
-				((bytes.Compare(l.SourceAddr[:], message.Address) == 0) || (bytes.Compare(l.SourceAddr[:], make([]byte, 5)) == 0)) {
-				l.Channel <- message
-			}
+		select {
+		case <-wake:
+		case <-conn.Done():
+			return
 		}
 	}
 }
@@ -1,17 +1,69 @@
 package esbbridge
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"os"
 	"testing"
 	"time"
+
+	"github.com/spritkopf/esb-bridge/internal/usbprotocol"
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
 )
 
 var testPipelineAddress = [5]byte{111, 111, 111, 111, 1}
-var testDevice string = "/dev/ttyACM0"
+var testDevice = flag.String("device", "", "Serial port of a real esb-bridge device (e.g. /dev/ttyACM0), the emulator is used if empty")
+var testEmulator = emulator.New()
+
+// openTestDevice opens the default bridge to the real test device or to the emulator
+func openTestDevice() error {
+	if *testDevice != "" {
+		return Open(*testDevice)
+	}
+	return OpenTransport(testEmulator.Pipe())
+}
+
+// sendTestMessage simulates an incoming message from the test peripheral when running on the emulator. On a real
+// device the peripheral has to send the message itself
+func sendTestMessage(msg emulator.Message) {
+	if *testDevice == "" {
+		time.AfterFunc(100*time.Millisecond, func() { testEmulator.Receive(testPipelineAddress, msg) })
+	}
+}
+
+// TestParseAddress tests parsing of dotted pipeline addresses
+func TestParseAddress(t *testing.T) {
+	addr, err := ParseAddress("111.111.111.111.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != testPipelineAddress {
+		t.Fatalf("Unexpected address: %v", addr)
+	}
+
+	for _, s := range []string{"", "1.2.3.4", "1.2.3.4.5.6", "1.2.3.4.256", "a.b.c.d.e"} {
+		if _, err := ParseAddress(s); !errors.Is(err, ErrInvalidParam) {
+			t.Fatalf("ParseAddress(%q) should return ErrInvalidParam, got %v", s, err)
+		}
+	}
+}
 
 //TestOpenSuccess tests that the virtual COM port can be opened
 func TestOpenSuccess(t *testing.T) {
-	err := Open("/dev/ttyACM0")
+	device := *testDevice
+	if device == "" {
+		pty, err := testEmulator.OpenPty()
+		if err != nil {
+			t.Skipf("Emulator pty not available: %v", err)
+		}
+		defer pty.Close()
+		device = pty.Path
+	}
+
+	err := Open(device)
 
 	if err != nil {
 		t.Fatalf(err.Error())
@@ -36,7 +88,7 @@ func TestGetFwVersionNotOpen(t *testing.T) {
 // TestGetFwVersion tests correct read of firmware version
 func TestGetFwVersion(t *testing.T) {
 
-	err := Open(testDevice)
+	err := openTestDevice()
 	defer Close()
 	if err != nil {
 		t.Fatalf(err.Error())
@@ -67,7 +119,7 @@ func TestTransferNotOpen(t *testing.T) {
 func TestTransferPayloadSize(t *testing.T) {
 	var veryLongPayload [64]byte
 
-	Open(testDevice)
+	openTestDevice()
 
 	_, err := Transfer(EsbMessage{Address: testPipelineAddress[:], Payload: veryLongPayload[:]})
 
@@ -78,11 +130,28 @@ func TestTransferPayloadSize(t *testing.T) {
 	Close()
 }
 
+// TestAddressSize tests that transfers and sends to addresses which are not AddressSize bytes long are rejected
+func TestAddressSize(t *testing.T) {
+	if err := openTestDevice(); err != nil {
+		t.Fatalf("Open() failed with error %v", err)
+	}
+	defer Close()
+
+	for _, addr := range [][]byte{testPipelineAddress[:4], append(testPipelineAddress[:], 0x99)} {
+		if _, err := Transfer(EsbMessage{Address: addr, Cmd: 0x10}); !errors.Is(err, ErrInvalidParam) {
+			t.Fatalf("Transfer to address %v should return ErrInvalidParam, got %v", addr, err)
+		}
+		if err := Send(EsbMessage{Address: addr, Cmd: 0x10}); !errors.Is(err, ErrInvalidParam) {
+			t.Fatalf("Send to address %v should return ErrInvalidParam, got %v", addr, err)
+		}
+	}
+}
+
 // TestTransfer tests the transfer of ESB packages by requesting the firware version of a supported device
 // Note: the ESB command ID ESB_CMD_VERSION (0x10) should be common to all the custom esb compatible devices
 func TestTransfer(t *testing.T) {
 
-	errOpen := Open(testDevice)
+	errOpen := openTestDevice()
 
 	if errOpen != nil {
 		t.Fatalf("Open() failed with error %v", errOpen)
@@ -101,6 +170,159 @@ func TestTransfer(t *testing.T) {
 	Close()
 }
 
+// TestInfo tests the bridge information and the firmware version comparison
+func TestInfo(t *testing.T) {
+	if _, err := (&Bridge{}).Info(); err == nil {
+		t.Fatalf("Info should return an error when the bridge was never opened")
+	}
+
+	if err := openTestDevice(); err != nil {
+		t.Fatalf("Open() failed with error %v", err)
+	}
+	defer Close()
+
+	info, err := Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State != StateConnected || info.Device != *testDevice || !info.HasCapability(CapSend) {
+		t.Fatalf("Unexpected bridge info: %+v", info)
+	}
+	if !info.FwVersion.AtLeast(info.FwVersion.Major, info.FwVersion.Minor, info.FwVersion.Patch) {
+		t.Fatalf("Firmware version %v should be at least itself", info.FwVersion)
+	}
+
+	v := FwVersion{Major: 1, Minor: 2, Patch: 3}
+	if !v.AtLeast(1, 1, 9) || !v.AtLeast(0, 9, 9) || v.AtLeast(1, 2, 4) || v.AtLeast(2, 0, 0) {
+		t.Fatalf("Wrong version comparison for %v", v)
+	}
+}
+
+// TestInfoCapabilities tests that Info() reports the firmware version read when the device was connected and the
+// capabilities of the firmware, without communicating with the device again
+func TestInfoCapabilities(t *testing.T) {
+	e := emulator.New()
+	e.FwVersion = [3]byte{0, 9, 0}
+
+	b := &Bridge{}
+	if err := b.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// a device which does not answer does not fail Info()
+	e.DropAnswers(1)
+	info, err := b.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.FwVersion != (FwVersion{Major: 0, Minor: 9, Patch: 0}) {
+		t.Fatalf("Expected firmware version 0.9.0, got %v", info.FwVersion)
+	}
+	if !info.HasCapability(CapTransfer) || !info.HasCapability(CapSend) || !info.HasCapability(CapListen) {
+		t.Fatalf("Unexpected capabilities of firmware 0.9.0: %v", info.Capabilities)
+	}
+}
+
+// TestErrors tests that the errors of a transfer can be identified with errors.Is() and errors.As()
+func TestErrors(t *testing.T) {
+	if _, err := (&Bridge{}).Transfer(EsbMessage{}); err != ErrNotConnected {
+		t.Fatalf("Expected ErrNotConnected, got %v", err)
+	}
+
+	if err := openTestDevice(); err != nil {
+		t.Fatalf("Open() failed with error %v", err)
+	}
+	defer Close()
+
+	_, err := Transfer(EsbMessage{Address: testPipelineAddress[:], Payload: make([]byte, 33)})
+	if !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("Expected ErrPayloadTooLarge, got %v", err)
+	}
+
+	_, err = Transfer(EsbMessage{Address: []byte{9, 9, 9, 9, 9}, Cmd: 0x10})
+	if !errors.Is(err, ErrNoAck) {
+		t.Fatalf("Expected ErrNoAck, got %v", err)
+	}
+	var fwErr *FirmwareError
+	if !errors.As(err, &fwErr) || *fwErr != (FirmwareError{Cmd: byte(UsbCmdTransfer), Code: FwErrNoAck}) {
+		t.Fatalf("Expected FirmwareError, got %v", err)
+	}
+	if errors.Is(&FirmwareError{Cmd: byte(UsbCmdTransfer), Code: FwErrParam}, ErrNoAck) {
+		t.Fatalf("FirmwareError with code FwErrParam should not match ErrNoAck")
+	}
+
+	// an answer without ESB cmd and status is rejected
+	_, err = decodeAnswer(EsbMessage{}, usbprotocol.Message{Cmd: UsbCmdTransfer, Payload: []byte{0x01}})
+	var protoErr *ProtocolError
+	if !errors.Is(err, ErrProtocol) || !errors.As(err, &protoErr) || protoErr.Cmd != byte(UsbCmdTransfer) {
+		t.Fatalf("Expected ProtocolError, got %v", err)
+	}
+
+	// the errors of usbprotocol are converted into the errors of this package
+	for usbErr, expected := range map[error]error{
+		usbprotocol.ErrDeviceLost:  ErrUnavailable,
+		usbprotocol.ErrSerial:      ErrUnavailable,
+		io.ErrClosedPipe:           ErrUnavailable,
+		usbprotocol.ErrCmdMismatch: ErrProtocol,
+		usbprotocol.ErrSize:        ErrPayloadTooLarge,
+		usbprotocol.ErrTimeout:     ErrTimeout,
+		context.Canceled:           context.Canceled,
+	} {
+		if err := checkAnswer(usbprotocol.Message{}, usbErr); !errors.Is(err, expected) {
+			t.Fatalf("Expected %v for %v, got %v", expected, usbErr, err)
+		}
+	}
+}
+
+// TestTransferContext tests that a transfer returns when its context is canceled
+func TestTransferContext(t *testing.T) {
+	if err := openTestDevice(); err != nil {
+		t.Fatalf("Open() failed with error %v", err)
+	}
+	defer Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := TransferContext(ctx, EsbMessage{Address: testPipelineAddress[:], Cmd: 0x10})
+	if err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	answer, err := TransferContext(context.Background(), EsbMessage{Address: testPipelineAddress[:], Cmd: 0x10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Error != 0 {
+		t.Fatalf("Answer Message has error code %v", answer.Error)
+	}
+}
+
+// TestSend tests sending messages without reply to an acknowledging and an unknown device
+func TestSend(t *testing.T) {
+	if err := openTestDevice(); err != nil {
+		t.Fatalf("Open() failed with error %v", err)
+	}
+	defer Close()
+
+	if err := Send(EsbMessage{Address: testPipelineAddress[:], Cmd: 0x10, Payload: []byte{1, 2}}); err != nil {
+		t.Fatalf("Send() failed with error %v", err)
+	}
+
+	var veryLongPayload [64]byte
+	if err := Send(EsbMessage{Address: testPipelineAddress[:], Payload: veryLongPayload[:]}); err == nil {
+		t.Fatalf("Send should return an error when Payload is longer than 32 bytes")
+	}
+
+	if *testDevice != "" {
+		// unknown addresses can only be simulated with the emulator
+		return
+	}
+	if err := Send(EsbMessage{Address: []byte{9, 9, 9, 9, 9}, Cmd: 0x10}); err == nil {
+		t.Fatalf("Send to a device which does not acknowledge should return an error")
+	}
+}
+
 // TestListenerInvalidParam tests that Addlistener will return an error if an invalid channel parameter (nil) is passed
 func TestListenerInvalidParam(t *testing.T) {
 
@@ -116,12 +338,13 @@ func TestListenerInvalidParam(t *testing.T) {
 func TestListener(t *testing.T) {
 	messageReceived := false
 
-	Open("/dev/ttyACM0")
+	openTestDevice()
 	defer Close()
 
 	lc := make(chan EsbMessage, 1)
 
 	AddListener([5]byte{111, 111, 111, 111, 1}, 0xFF, lc)
+	sendTestMessage(emulator.Message{Cmd: 0x01, Payload: []byte{1}})
 
 timeoutLoop:
 	for i := 10; i > 0; i-- {
@@ -156,6 +379,174 @@ func TestRemoveListener(t *testing.T) {
 	}
 }
 
+// TestLinkStats tests that the USB link counters are available
+func TestLinkStats(t *testing.T) {
+	if s := GetLinkStats(); s != (LinkStats{}) {
+		t.Fatalf("Link counters should be zero when not connected, got %+v", s)
+	}
+
+	openTestDevice()
+	defer Close()
+
+	_, err := GetFwVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the firmware version is also read when the device is connected
+	s := GetLinkStats()
+	if s.FramesOut != 2 || s.FramesIn != 2 {
+		t.Fatalf("Expected two packets in each direction, got %+v", s)
+	}
+}
+
+// TestAddressStats tests the message counters by address
+func TestAddressStats(t *testing.T) {
+	if *testDevice != "" {
+		t.Skip("unknown addresses can only be simulated with the emulator")
+	}
+	b := &Bridge{}
+	if err := b.OpenTransport(testEmulator.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	unknownAddress := [5]byte{9, 9, 9, 9, 9}
+	b.Transfer(EsbMessage{Address: testPipelineAddress[:], Cmd: 0x10})
+	b.Transfer(EsbMessage{Address: unknownAddress[:], Cmd: 0x10})
+	b.Send(EsbMessage{Address: testPipelineAddress[:], Cmd: 0x10})
+
+	lc := make(chan EsbMessage, 1)
+	b.AddListener(testPipelineAddress, 0xFF, lc)
+	testEmulator.Receive(testPipelineAddress, emulator.Message{Cmd: 0x01, Payload: []byte{1}})
+	select {
+	case <-lc:
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout, no message was received")
+	}
+
+	stats := b.AddressStats()
+	s := stats[testPipelineAddress]
+	if s.Transfers != 1 || s.Sends != 1 || s.PeerErrors != 0 || s.Received[0x01] != 1 {
+		t.Fatalf("Unexpected counters of %v: %+v", testPipelineAddress, s)
+	}
+	s = stats[unknownAddress]
+	if s.Transfers != 1 || s.PeerErrors != 1 || s.Timeouts != 0 {
+		t.Fatalf("Unexpected counters of %v: %+v", unknownAddress, s)
+	}
+}
+
+// TestAddressStatsLimit tests that the messages of the addresses beyond MaxAddressStats are counted together, apart
+// from the counters of the address 0.0.0.0.0
+func TestAddressStatsLimit(t *testing.T) {
+	var s trafficStats
+	if _, ok := s.loadOthers(); ok {
+		t.Fatalf("There should be no other addresses before the limit is reached")
+	}
+	s.countSent([]byte{0, 0, 0, 0, 0}, true, nil)
+	for i := 1; i < MaxAddressStats+10; i++ {
+		s.countSent([]byte{1, 2, 3, 4, byte(i)}, true, nil)
+	}
+	s.countSent([]byte{1, 2, 3, 4, 1}, false, nil)
+
+	stats := s.load()
+	if len(stats) != MaxAddressStats {
+		t.Fatalf("Expected counters of %v addresses, got %v", MaxAddressStats, len(stats))
+	}
+	if a := stats[[AddressSize]byte{1, 2, 3, 4, 1}]; a.Transfers != 1 || a.Sends != 1 {
+		t.Fatalf("Unexpected counters of a known address: %+v", a)
+	}
+	if a := stats[[AddressSize]byte{}]; a.Transfers != 1 {
+		t.Fatalf("Unexpected counters of the address 0.0.0.0.0: %+v", a)
+	}
+	if a, ok := s.loadOthers(); !ok || a.Transfers != 10 {
+		t.Fatalf("Expected 10 transfers of other addresses, got %+v", a)
+	}
+}
+
+// TestReceiveRadio tests the decoding of incoming messages with and without radio metadata
+func TestReceiveRadio(t *testing.T) {
+	if *testDevice != "" {
+		t.Skip("incoming messages can only be simulated with the emulator")
+	}
+	b := &Bridge{}
+	if err := b.OpenTransport(testEmulator.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := b.GetFwVersion(); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, _ := b.Info(); info.HasCapability(CapRadioInfo) {
+		t.Fatalf("Radio metadata should not be reported before the device sent it: %v", info.Capabilities)
+	}
+
+	lc := make(chan EsbMessage, 2)
+	b.AddListener(testPipelineAddress, 0xFF, lc)
+	before := time.Now()
+	testEmulator.Receive(testPipelineAddress, emulator.Message{Cmd: 0x01, Error: 0x05, Payload: []byte{1}})
+	testEmulator.ReceiveRadio(testPipelineAddress, emulator.Message{Cmd: 0x02, Payload: []byte{2}},
+		emulator.RadioInfo{Pipe: 1, RSSI: -60, Retransmits: 3})
+
+	var messages []EsbMessage
+	for len(messages) < 2 {
+		select {
+		case m := <-lc:
+			messages = append(messages, m)
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout, %v of 2 messages received", len(messages))
+		}
+	}
+	if m := messages[0]; m.Cmd != 0x01 || m.Error != 0x05 || m.Radio != nil || m.Timestamp.Before(before) {
+		t.Fatalf("Unexpected message without radio metadata %+v", m)
+	}
+	m := messages[1]
+	if m.Cmd != 0x02 || m.Radio == nil || *m.Radio != (RadioInfo{Pipe: 1, RSSI: -60, Retransmits: 3}) ||
+		len(m.Payload) != 1 || m.Payload[0] != 2 || m.Seq <= messages[0].Seq {
+		t.Fatalf("Unexpected message with radio metadata %+v", m)
+	}
+	if info, _ := b.Info(); !info.HasCapability(CapRadioInfo) {
+		t.Fatalf("Radio metadata should be reported after the device sent it: %v", info.Capabilities)
+	}
+
+	// longer metadata of newer firmware is skipped, shorter or truncated metadata is not decoded
+	header := append([]byte{0x03, 0}, testPipelineAddress[:]...)
+	cases := []struct {
+		metadata []byte
+		radio    *RadioInfo
+		ok       bool
+	}{
+		{[]byte{5, 1, 0xC4, 3, 0xFF, 0xFF}, &RadioInfo{Pipe: 1, RSSI: -60, Retransmits: 3}, true},
+		{[]byte{1, 1}, nil, true},
+		{[]byte{4, 1, 0xC4}, nil, false},
+		{nil, nil, false},
+	}
+	for i, c := range cases {
+		pl := append(append(append([]byte(nil), header...), c.metadata...), 0xAB)
+		if c.metadata == nil {
+			pl = header
+		}
+		m, ok := decodeRx(usbprotocol.Message{Cmd: UsbCmdRxRadio, Payload: pl})
+		if ok != c.ok {
+			t.Fatalf("Case %v: expected %v, got %v", i, c.ok, ok)
+		}
+		if !ok {
+			continue
+		}
+		if fmt.Sprint(m.Radio) != fmt.Sprint(c.radio) || len(m.Payload) != 1 || m.Payload[0] != 0xAB {
+			t.Fatalf("Case %v: unexpected message %+v", i, m)
+		}
+	}
+}
+
 func TestTemp(t *testing.T) {
 
 }
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	// the test peripheral echoes all requests
+	testEmulator.AddPeripheral(&emulator.Peripheral{Address: testPipelineAddress})
+	os.Exit(m.Run())
+}
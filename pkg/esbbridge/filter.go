@@ -0,0 +1,205 @@
+package esbbridge
+
+import (
+	"fmt"
+	"strings"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// Types and constants
+///////////////////////////////////////////////////////////////////////////////
+
+// Filter selects incoming messages by address, command and payload. A message matches if it matches all criteria
+// of the filter and none of its Exclude filters. The zero value matches all messages
+//
+// Example, all messages of the pipelines 111.111.111.111.x except the heartbeats with command 0x01:
+//   Filter{
+//     Address:     [AddressSize]byte{111, 111, 111, 111, 0},
+//     AddressMask: [AddressSize]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00},
+//     Exclude:     []Filter{{Cmds: []CmdRange{{First: 0x01, Last: 0x01}}}},
+//   }
+type Filter struct {
+	// Address and AddressMask: the address bits set in AddressMask must be equal to the bits of Address.
+	// All addresses match if AddressMask is zero
+	Address     [AddressSize]byte
+	AddressMask [AddressSize]byte
+	// Cmds are the matching command IDs. All commands match if empty
+	Cmds []CmdRange
+	// Payload are patterns which must all match the payload
+	Payload []PayloadMatch
+	// Exclude filters, a message matching one of them does not match the filter
+	Exclude []Filter
+}
+
+// CmdRange is a range of command IDs, First and Last are included
+type CmdRange struct {
+	First byte
+	Last  byte
+}
+
+// PayloadMatch is a byte pattern in the payload of a message (the bytes following the command ID). The bytes at
+// Offset must be equal to Value for all bits set in Mask. All bits are compared if Mask is empty. A payload too short
+// for the pattern does not match
+type PayloadMatch struct {
+	Offset int
+	Value  []byte
+	Mask   []byte
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Public API
+///////////////////////////////////////////////////////////////////////////////
+
+// ListenerFilter returns the filter of a listener added with AddListener(): messages from sourceAddr (all addresses
+// if it is all zero) with the command ID cmd (all commands if 0xFF)
+func ListenerFilter(sourceAddr [AddressSize]byte, cmd byte) Filter {
+	var f Filter
+	if sourceAddr != [AddressSize]byte{} {
+		f.Address = sourceAddr
+		f.AddressMask = [AddressSize]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	}
+	if cmd != 0xFF {
+		f.Cmds = []CmdRange{{First: cmd, Last: cmd}}
+	}
+	return f
+}
+
+// Match returns true if the message matches the filter
+func (f Filter) Match(message EsbMessage) bool {
+	for i := range f.AddressMask {
+		var b byte
+		if i < len(message.Address) {
+			b = message.Address[i]
+		}
+		if (b^f.Address[i])&f.AddressMask[i] != 0 {
+			return false
+		}
+	}
+
+	if len(f.Cmds) > 0 {
+		found := false
+		for _, r := range f.Cmds {
+			if message.Cmd >= r.First && message.Cmd <= r.Last {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, p := range f.Payload {
+		if !p.match(message.Payload) {
+			return false
+		}
+	}
+
+	for _, e := range f.Exclude {
+		if e.Match(message) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks the command ranges and payload patterns of the filter and its Exclude filters
+func (f Filter) Validate() error {
+	for _, r := range f.Cmds {
+		if r.First > r.Last {
+			return fmt.Errorf("%w: empty command range 0x%02x-0x%02x", ErrInvalidParam, r.First, r.Last)
+		}
+	}
+	for _, p := range f.Payload {
+		if p.Offset < 0 || len(p.Value) == 0 {
+			return fmt.Errorf("%w: invalid payload pattern at offset %v", ErrInvalidParam, p.Offset)
+		}
+		if len(p.Mask) > 0 && len(p.Mask) != len(p.Value) {
+			return fmt.Errorf("%w: payload mask and value differ in length", ErrInvalidParam)
+		}
+	}
+	for _, e := range f.Exclude {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns a short description of the filter for logging, e.g. "addr 111.111.111.111.* cmd 0x10-0x1f
+// payload[2]=01/ff !(cmd 0x01)"
+func (f Filter) String() string {
+	var parts []string
+	if f.AddressMask != [AddressSize]byte{} {
+		addr := make([]string, AddressSize)
+		for i := range addr {
+			switch f.AddressMask[i] {
+			case 0x00:
+				addr[i] = "*"
+			case 0xFF:
+				addr[i] = fmt.Sprint(f.Address[i])
+			default:
+				addr[i] = fmt.Sprintf("%v/%02x", f.Address[i]&f.AddressMask[i], f.AddressMask[i])
+			}
+		}
+		parts = append(parts, "addr "+strings.Join(addr, "."))
+	}
+	if len(f.Cmds) > 0 {
+		cmds := make([]string, len(f.Cmds))
+		for i, r := range f.Cmds {
+			cmds[i] = fmt.Sprintf("0x%02x", r.First)
+			if r.Last != r.First {
+				cmds[i] += fmt.Sprintf("-0x%02x", r.Last)
+			}
+		}
+		parts = append(parts, "cmd "+strings.Join(cmds, ","))
+	}
+	for _, p := range f.Payload {
+		s := fmt.Sprintf("payload[%v]=%x", p.Offset, p.Value)
+		if len(p.Mask) > 0 {
+			s += fmt.Sprintf("/%x", p.Mask)
+		}
+		parts = append(parts, s)
+	}
+	for _, e := range f.Exclude {
+		parts = append(parts, "!("+e.String()+")")
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+	return strings.Join(parts, " ")
+}
+
+// SubscribeFilter adds a listenener with a filter to the default bridge, see Bridge.SubscribeFilter()
+func SubscribeFilter(filter Filter, c ListenerChannel, opts ListenerOptions) (*Subscription, error) {
+	return defaultBridge.SubscribeFilter(filter, c, opts)
+}
+
+// SubscribeFilter adds a listener like Subscribe(), which receives the incoming messages matching the filter
+func (b *Bridge) SubscribeFilter(filter Filter, c ListenerChannel, opts ListenerOptions) (*Subscription, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return b.subscribe(Listener{Channel: c}, filter, opts)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private functions
+///////////////////////////////////////////////////////////////////////////////
+
+// match returns true if the pattern matches the payload
+func (p PayloadMatch) match(payload []byte) bool {
+	if p.Offset < 0 || p.Offset+len(p.Value) > len(payload) {
+		return false
+	}
+	for i, v := range p.Value {
+		mask := byte(0xFF)
+		if i < len(p.Mask) {
+			mask = p.Mask[i]
+		}
+		if (payload[p.Offset+i]^v)&mask != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package esbbridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+)
+
+// TestFilterMatch tests matching messages against filters
+func TestFilterMatch(t *testing.T) {
+	sensors := Filter{
+		Address:     [AddressSize]byte{111, 111, 111, 111, 0},
+		AddressMask: [AddressSize]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00},
+		Exclude:     []Filter{{Cmds: []CmdRange{{First: 0x01, Last: 0x01}}}},
+	}
+	payload := Filter{Payload: []PayloadMatch{{Offset: 1, Value: []byte{0x20, 0x03}, Mask: []byte{0xF0, 0xFF}}}}
+
+	cases := []struct {
+		filter  Filter
+		message EsbMessage
+		match   bool
+	}{
+		{Filter{}, EsbMessage{Address: []byte{1, 2, 3, 4, 5}, Cmd: 0x01}, true},
+		{sensors, EsbMessage{Address: []byte{111, 111, 111, 111, 7}, Cmd: 0x10}, true},
+		{sensors, EsbMessage{Address: []byte{111, 111, 111, 111, 7}, Cmd: 0x01}, false},
+		{sensors, EsbMessage{Address: []byte{111, 111, 111, 112, 7}, Cmd: 0x10}, false},
+		{ListenerFilter([AddressSize]byte{1, 2, 3, 4, 5}, 0x10), EsbMessage{Address: []byte{1, 2, 3, 4, 5}, Cmd: 0x10}, true},
+		{ListenerFilter([AddressSize]byte{1, 2, 3, 4, 5}, 0x10), EsbMessage{Address: []byte{1, 2, 3, 4, 5}, Cmd: 0x11}, false},
+		{ListenerFilter([AddressSize]byte{1, 2, 3, 4, 5}, 0xFF), EsbMessage{Address: []byte{1, 2, 3, 4, 6}, Cmd: 0x11}, false},
+		{ListenerFilter([AddressSize]byte{}, 0xFF), EsbMessage{Address: []byte{1, 2, 3, 4, 6}, Cmd: 0x11}, true},
+		{Filter{Cmds: []CmdRange{{0x10, 0x1F}, {0x30, 0x30}}}, EsbMessage{Cmd: 0x1F}, true},
+		{Filter{Cmds: []CmdRange{{0x10, 0x1F}, {0x30, 0x30}}}, EsbMessage{Cmd: 0x20}, false},
+		{payload, EsbMessage{Payload: []byte{0xAA, 0x2B, 0x03}}, true},
+		{payload, EsbMessage{Payload: []byte{0xAA, 0x3B, 0x03}}, false},
+		{payload, EsbMessage{Payload: []byte{0xAA, 0x2B}}, false},
+		{Filter{Exclude: []Filter{payload}}, EsbMessage{Payload: []byte{0xAA, 0x2B}}, true},
+	}
+	for i, c := range cases {
+		if match := c.filter.Match(c.message); match != c.match {
+			t.Fatalf("Case %v: filter %v, message %+v: expected %v, got %v", i, c.filter, c.message, c.match, match)
+		}
+	}
+
+	if s := sensors.String(); s != "addr 111.111.111.111.* !(cmd 0x01)" {
+		t.Fatalf("Unexpected description %q", s)
+	}
+}
+
+// TestFilterValidate tests that invalid filters are rejected
+func TestFilterValidate(t *testing.T) {
+	invalid := []Filter{
+		{Cmds: []CmdRange{{First: 0x20, Last: 0x10}}},
+		{Payload: []PayloadMatch{{Offset: -1, Value: []byte{1}}}},
+		{Payload: []PayloadMatch{{Offset: 0}}},
+		{Payload: []PayloadMatch{{Offset: 0, Value: []byte{1, 2}, Mask: []byte{0xFF}}}},
+		{Exclude: []Filter{{Cmds: []CmdRange{{First: 0x20, Last: 0x10}}}}},
+	}
+	b := &Bridge{}
+	for _, f := range invalid {
+		if _, err := b.SubscribeFilter(f, make(chan EsbMessage), ListenerOptions{}); err == nil {
+			t.Fatalf("SubscribeFilter() should fail for %+v", f)
+		}
+	}
+}
+
+// TestSubscribeFilter tests that a listener with a filter receives only the matching messages
+func TestSubscribeFilter(t *testing.T) {
+	if *testDevice != "" {
+		t.Skip("incoming messages can only be simulated with the emulator")
+	}
+	b := &Bridge{}
+	if err := b.OpenTransport(testEmulator.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := b.GetFwVersion(); err != nil {
+		t.Fatal(err)
+	}
+
+	lc := make(chan EsbMessage, 10)
+	filter := Filter{Cmds: []CmdRange{{First: 0x30, Last: 0x3F}}, Exclude: []Filter{{Cmds: []CmdRange{{0x31, 0x31}}}}}
+	s, err := b.SubscribeFilter(filter, lc, ListenerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Unsubscribe()
+
+	for _, cmd := range []byte{0x29, 0x30, 0x31, 0x3F, 0x40} {
+		testEmulator.Receive(testPipelineAddress, emulator.Message{Cmd: cmd})
+	}
+	for _, cmd := range []byte{0x30, 0x3F} {
+		select {
+		case m := <-lc:
+			if m.Cmd != cmd {
+				t.Fatalf("Expected message 0x%02x, got %+v", cmd, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout, message 0x%02x was not received", cmd)
+		}
+	}
+	select {
+	case m := <-lc:
+		t.Fatalf("Unexpected message %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// replace the filters
+	if err := s.SetFilters(Filter{Cmds: []CmdRange{{0x40, 0x40}}}, Filter{Cmds: []CmdRange{{0x42, 0x42}}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []byte{0x30, 0x40, 0x41, 0x42} {
+		testEmulator.Receive(testPipelineAddress, emulator.Message{Cmd: cmd})
+	}
+	for _, cmd := range []byte{0x40, 0x42} {
+		select {
+		case m := <-lc:
+			if m.Cmd != cmd {
+				t.Fatalf("Expected message 0x%02x, got %+v", cmd, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout, message 0x%02x was not received", cmd)
+		}
+	}
+	if err := s.SetFilters(Filter{Cmds: []CmdRange{{0x42, 0x40}}}); err == nil {
+		t.Fatalf("SetFilters() should fail for an invalid filter")
+	}
+
+	// without filters no messages are received
+	if err := s.SetFilters(); err != nil {
+		t.Fatal(err)
+	}
+	testEmulator.Receive(testPipelineAddress, emulator.Message{Cmd: 0x40})
+	select {
+	case m := <-lc:
+		t.Fatalf("Unexpected message %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,135 @@
+package esbbridge
+
+import (
+	"fmt"
+	"time"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// Types and constants
+///////////////////////////////////////////////////////////////////////////////
+
+// FwVersion is the firmware version of an esb-bridge device
+type FwVersion struct {
+	Major uint8
+	Minor uint8
+	Patch uint8
+}
+
+// BridgeInfo describes an esb-bridge device and its connection
+type BridgeInfo struct {
+	// FwVersion is the firmware version of the device, read when it was connected. If the device is not connected,
+	// it is the version read last
+	FwVersion FwVersion
+	// Device is the device path passed to Open(), empty if the bridge was opened over a transport
+	Device string
+	// Uptime is the time since the bridge was opened
+	Uptime time.Duration
+	// State is the state of the connection to the device
+	State ConnectionState
+	// Capabilities lists the features offered by the bridge with the firmware of the device, see the Cap... constants
+	Capabilities []string
+	// MaxPayloadSize is the maximum payload size of ESB messages
+	MaxPayloadSize uint8
+}
+
+// Capabilities of the bridge, see BridgeInfo
+const (
+	// CapTransfer - messages can be sent to a peripheral which replies, see Transfer()
+	CapTransfer = "transfer"
+	// CapSend - messages can be sent to a peripheral without waiting for a reply, see Send()
+	CapSend = "send"
+	// CapListen - messages sent by peripherals on their own can be received, see AddListener()
+	CapListen = "listen"
+	// CapRadioInfo - incoming messages carry radio metadata, see EsbMessage.Radio. The firmware version does not tell
+	// whether the device sends it, the capability is reported once the device sent an incoming message with it
+	CapRadioInfo = "radio-info"
+)
+
+func (v FwVersion) String() string {
+	return fmt.Sprintf("%v.%v.%v", v.Major, v.Minor, v.Patch)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private variables
+///////////////////////////////////////////////////////////////////////////////
+
+// capabilities are the features of the bridge with the minimum firmware version they require. The USB commands of
+// transfer, listen and send are part of every firmware version
+var capabilities = []struct {
+	name      string
+	fwVersion FwVersion
+}{
+	{CapTransfer, FwVersion{}},
+	{CapListen, FwVersion{}},
+	{CapSend, FwVersion{}},
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Public API
+///////////////////////////////////////////////////////////////////////////////
+
+// Info returns information about the default bridge, see Bridge.Info()
+func Info() (BridgeInfo, error) {
+	return defaultBridge.Info()
+}
+
+// AtLeast returns true if the version is equal to or newer than major.minor.patch
+func (v FwVersion) AtLeast(major, minor, patch uint8) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// HasCapability returns true if the bridge offers the capability
+func (i BridgeInfo) HasCapability(capability string) bool {
+	for _, c := range i.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Info returns information about the bridge and its device. The firmware version is the one read when the device
+// was connected or reconnected, Info does not communicate with the device
+func (b *Bridge) Info() (BridgeInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return BridgeInfo{}, ErrNotConnected
+	}
+
+	info := BridgeInfo{
+		FwVersion:      b.fwVersion,
+		Device:         b.device,
+		Uptime:         time.Since(b.openedAt),
+		State:          b.state,
+		Capabilities:   capabilitiesOf(b.fwVersion),
+		MaxPayloadSize: MaxPayloadSize,
+	}
+	if b.radioInfo {
+		info.Capabilities = append(info.Capabilities, CapRadioInfo)
+	}
+	return info, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private functions
+///////////////////////////////////////////////////////////////////////////////
+
+// capabilitiesOf returns the capabilities of the bridge with the firmware version v
+func capabilitiesOf(v FwVersion) []string {
+	var list []string
+	for _, c := range capabilities {
+		if v.AtLeast(c.fwVersion.Major, c.fwVersion.Minor, c.fwVersion.Patch) {
+			list = append(list, c.name)
+		}
+	}
+	return list
+}
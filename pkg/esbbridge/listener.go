@@ -0,0 +1,330 @@
+package esbbridge
+
+import (
+	"fmt"
+	"sync"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// Types and constants
+///////////////////////////////////////////////////////////////////////////////
+
+// DefaultListenerQueueSize is the number of incoming messages queued for a listener, if no other size is configured
+const DefaultListenerQueueSize = 16
+
+// OverflowPolicy decides what happens to an incoming message for a listener whose queue is full
+type OverflowPolicy int
+
+const (
+	// DropOldest drops the oldest queued message to make room for the incoming message
+	DropOldest OverflowPolicy = iota
+	// DropNewest drops the incoming message
+	DropNewest
+	// Disconnect drops all queued messages and stops the delivery to the listener, see Subscription.Err(). The
+	// channel is not closed, it belongs to the caller. The listener still has to be removed with RemoveListener()
+	Disconnect
+)
+
+// ListenerOptions configures the queue of a listener, see AddListenerWithOptions()
+type ListenerOptions struct {
+	// QueueSize is the number of incoming messages queued for the listener, DefaultListenerQueueSize if 0
+	QueueSize int
+	// Overflow decides what happens to incoming messages while the queue is full, DropOldest by default
+	Overflow OverflowPolicy
+}
+
+// Subscription is the handle of a registered listener, see Subscribe()
+type Subscription struct {
+	b *Bridge
+	l *listener
+}
+
+// listener is a registered Listener with its message queue. Incoming messages are queued without blocking and
+// delivered to the channel by a goroutine per listener, so a slow listener does not stall the other listeners
+// and the usb connection
+type listener struct {
+	Listener
+	opts ListenerOptions
+
+	mu      sync.Mutex
+	filters []Filter // a message matching one of the filters is queued
+	queue   []EsbMessage
+	dropped uint64 // messages dropped since the last delivered message
+
+	wake         chan struct{} // signals queued messages to the delivery goroutine, capacity 1
+	disconnected chan struct{} // closed when the Disconnect policy was applied
+	stop         chan struct{} // closed when the listener is removed
+	done         chan struct{} // closed when the delivery goroutine stopped
+}
+
+var overflowPolicyNames = []string{"drop-oldest", "drop-newest", "disconnect"}
+
+func (p OverflowPolicy) String() string {
+	if p < 0 || int(p) >= len(overflowPolicyNames) {
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+	return overflowPolicyNames[p]
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Public API
+///////////////////////////////////////////////////////////////////////////////
+
+// ParseOverflowPolicy parses the name of an overflow policy: "drop-oldest", "drop-newest" or "disconnect"
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for i, name := range overflowPolicyNames {
+		if s == name {
+			return OverflowPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown overflow policy %q", ErrInvalidParam, s)
+}
+
+// AddListenerWithOptions adds a listenener to the default bridge, see Bridge.AddListenerWithOptions()
+func AddListenerWithOptions(sourceAddr [AddressSize]byte, cmd byte, c ListenerChannel, opts ListenerOptions) error {
+	return defaultBridge.AddListenerWithOptions(sourceAddr, cmd, c, opts)
+}
+
+// Subscribe adds a listenener to the default bridge, see Bridge.Subscribe()
+func Subscribe(sourceAddr [AddressSize]byte, cmd byte, c ListenerChannel, opts ListenerOptions) (*Subscription, error) {
+	return defaultBridge.Subscribe(sourceAddr, cmd, c, opts)
+}
+
+// AddListenerWithOptions adds a listener like AddListener(), with a custom queue size and overflow policy.
+// The Dropped field of a delivered message is the number of messages dropped for the listener since the previous
+// delivered message
+func (b *Bridge) AddListenerWithOptions(sourceAddr [AddressSize]byte, cmd byte, c ListenerChannel,
+	opts ListenerOptions) error {
+
+	_, err := b.Subscribe(sourceAddr, cmd, c, opts)
+	return err
+}
+
+// Subscribe adds a listener like AddListenerWithOptions() and returns its handle. Unlike RemoveListener(), which
+// removes all listeners of a channel, Unsubscribe() removes exactly this listener. Listeners can be added and
+// removed concurrently while messages are received
+func (b *Bridge) Subscribe(sourceAddr [AddressSize]byte, cmd byte, c ListenerChannel,
+	opts ListenerOptions) (*Subscription, error) {
+
+	return b.subscribe(Listener{SourceAddr: sourceAddr, Cmd: cmd, Channel: c}, ListenerFilter(sourceAddr, cmd), opts)
+}
+
+// SetFilters replaces the filters of the listener, it receives the incoming messages matching one of them. Without
+// filters, no more messages are queued. Messages queued before are still delivered
+func (s *Subscription) SetFilters(filters ...Filter) error {
+	for _, f := range filters {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+
+	s.l.filters = append([]Filter(nil), filters...)
+	return nil
+}
+
+// Done returns a channel which is closed when no more messages are delivered to the listener, because it was
+// disconnected by the Disconnect overflow policy or removed
+func (s *Subscription) Done() <-chan struct{} {
+	return s.l.done
+}
+
+// Err returns ErrDisconnected if the listener was disconnected by the Disconnect overflow policy, nil otherwise
+func (s *Subscription) Err() error {
+	select {
+	case <-s.l.disconnected:
+		return ErrDisconnected
+	default:
+		return nil
+	}
+}
+
+// Unsubscribe removes the listener. No more messages are delivered to its channel after Unsubscribe() returned.
+// Calling it again has no effect
+func (s *Subscription) Unsubscribe() {
+	s.b.removeListeners(func(l *listener) bool { return l == s.l })
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private functions
+///////////////////////////////////////////////////////////////////////////////
+
+// subscribe registers a listener for the messages matching filter and starts its delivery
+func (b *Bridge) subscribe(listen Listener, filter Filter, opts ListenerOptions) (*Subscription, error) {
+	if listen.Channel == nil {
+		return nil, fmt.Errorf("%w passed for listener channel (nil)", ErrInvalidParam)
+	}
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &listener{
+		Listener:     listen,
+		filters:      []Filter{filter},
+		opts:         opts,
+		wake:         make(chan struct{}, 1),
+		disconnected: make(chan struct{}),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	b.listenersMutex.Lock()
+	b.listeners = append(b.listeners, l)
+	b.listenersMutex.Unlock()
+	go l.deliver()
+
+	return &Subscription{b: b, l: l}, nil
+}
+
+// withDefaults checks the options and returns them with the default queue size if none is set
+func (opts ListenerOptions) withDefaults() (ListenerOptions, error) {
+	if opts.QueueSize < 0 {
+		return opts, fmt.Errorf("%w: negative queue size %v", ErrInvalidParam, opts.QueueSize)
+	}
+	if opts.Overflow < DropOldest || opts.Overflow > Disconnect {
+		return opts, fmt.Errorf("%w: unknown overflow policy %v", ErrInvalidParam, opts.Overflow)
+	}
+	if opts.QueueSize == 0 {
+		opts.QueueSize = DefaultListenerQueueSize
+	}
+	return opts, nil
+}
+
+// removeListeners removes all listeners for which remove returns true and stops their delivery.
+// Returns the number of removed listeners
+func (b *Bridge) removeListeners(remove func(l *listener) bool) int {
+	b.listenersMutex.Lock()
+	var removed []*listener
+	kept := b.listeners[:0]
+	for _, l := range b.listeners {
+		if remove(l) {
+			l.close()
+			removed = append(removed, l)
+		} else {
+			kept = append(kept, l)
+		}
+	}
+	// release the removed listeners, they may remain in the unused part of the slice otherwise
+	for i := len(kept); i < len(b.listeners); i++ {
+		b.listeners[i] = nil
+	}
+	b.listeners = kept
+	b.listenersMutex.Unlock()
+
+	// a message being delivered right now is either received or discarded before the delivery stops
+	for _, l := range removed {
+		<-l.done
+	}
+	return len(removed)
+}
+
+// dispatch queues an incoming message for all listeners and sessions, see push()
+func (b *Bridge) dispatch(message EsbMessage) {
+	b.listenersMutex.RLock()
+	defer b.listenersMutex.RUnlock()
+
+	for _, l := range b.listeners {
+		for _, d := range l.push(message) {
+			b.stats.countDropped(d)
+		}
+	}
+	for _, s := range b.sessions {
+		for _, d := range s.push(message) {
+			b.stats.countDropped(d)
+		}
+	}
+}
+
+// push queues a message without blocking if it matches one of the filters, and applies the overflow policy if the
+// queue is full. Returns the dropped messages
+func (l *listener) push(message EsbMessage) []EsbMessage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.disconnected:
+		return nil
+	case <-l.stop:
+		return nil
+	default:
+	}
+
+	matching := false
+	for _, f := range l.filters {
+		if f.Match(message) {
+			matching = true
+			break
+		}
+	}
+	if !matching {
+		return nil
+	}
+
+	var dropped []EsbMessage
+	if len(l.queue) >= l.opts.QueueSize {
+		switch l.opts.Overflow {
+		case DropNewest:
+			l.dropped++
+			return []EsbMessage{message}
+		case Disconnect:
+			dropped = append(l.queue, message)
+			l.dropped += uint64(len(dropped))
+			l.queue = nil
+			close(l.disconnected)
+			return dropped
+		default:
+			dropped = []EsbMessage{l.queue[0]}
+			l.dropped++
+			l.queue = l.queue[:copy(l.queue, l.queue[1:])]
+		}
+	}
+	l.queue = append(l.queue, message)
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// close stops the delivery of the listener. Messages are neither queued nor delivered afterwards
+func (l *listener) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	close(l.stop)
+	l.queue = nil
+}
+
+// deliver sends the queued messages to the channel of the listener until it is removed or disconnected
+func (l *listener) deliver() {
+	defer close(l.done)
+	for {
+		l.mu.Lock()
+		if len(l.queue) == 0 {
+			l.mu.Unlock()
+			select {
+			case <-l.wake:
+				continue
+			case <-l.disconnected:
+				return
+			case <-l.stop:
+				return
+			}
+		}
+		message := l.queue[0]
+		message.Dropped = l.dropped
+		l.dropped = 0
+		l.queue = l.queue[:copy(l.queue, l.queue[1:])]
+		l.mu.Unlock()
+
+		select {
+		case l.Channel <- message:
+		case <-l.disconnected:
+			return
+		case <-l.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package esbbridge
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+)
+
+// newTestListener creates a listener without starting its delivery goroutine
+func newTestListener(c ListenerChannel, opts ListenerOptions) *listener {
+	return &listener{
+		Listener:     Listener{SourceAddr: testPipelineAddress, Cmd: 0xFF, Channel: c},
+		opts:         opts,
+		filters:      []Filter{{}},
+		wake:         make(chan struct{}, 1),
+		disconnected: make(chan struct{}),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// TestListenerQueue tests the overflow policies of the listener queue
+func TestListenerQueue(t *testing.T) {
+	cases := []struct {
+		overflow  OverflowPolicy
+		dropped   []byte // cmd of the messages dropped by the pushes of the messages 1 to 4
+		delivered []byte // cmd of the delivered messages
+		counts    []uint64
+	}{
+		{DropOldest, []byte{1, 2}, []byte{3, 4}, []uint64{2, 0}},
+		{DropNewest, []byte{3, 4}, []byte{1, 2}, []uint64{2, 0}},
+		{Disconnect, []byte{1, 2, 3}, nil, nil},
+	}
+	for _, c := range cases {
+		lc := make(chan EsbMessage)
+		l := newTestListener(lc, ListenerOptions{QueueSize: 2, Overflow: c.overflow})
+
+		var dropped []byte
+		for cmd := byte(1); cmd <= 4; cmd++ {
+			for _, m := range l.push(EsbMessage{Address: testPipelineAddress[:], Cmd: cmd}) {
+				dropped = append(dropped, m.Cmd)
+			}
+		}
+		if string(dropped) != string(c.dropped) {
+			t.Fatalf("%v: expected dropped messages %v, got %v", c.overflow, c.dropped, dropped)
+		}
+
+		go l.deliver()
+		for i, cmd := range c.delivered {
+			m := <-lc
+			if m.Cmd != cmd || m.Dropped != c.counts[i] {
+				t.Fatalf("%v: expected message %v with %v dropped, got %+v", c.overflow, cmd, c.counts[i], m)
+			}
+		}
+		if c.overflow == Disconnect {
+			<-l.done
+			select {
+			case _, ok := <-lc:
+				t.Fatalf("No message should be delivered after the Disconnect policy, channel open: %v", ok)
+			default:
+			}
+		}
+		close(l.stop)
+	}
+}
+
+// TestSubscriptionDisconnect tests that a disconnected listener reports it by its subscription and does not close
+// the channel shared with other listeners
+func TestSubscriptionDisconnect(t *testing.T) {
+	b := &Bridge{}
+	lc := make(chan EsbMessage)
+	disconnecting, err := b.Subscribe(testPipelineAddress, 0xFF, lc, ListenerOptions{QueueSize: 1, Overflow: Disconnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := b.Subscribe(testPipelineAddress, 0xFF, lc, ListenerOptions{QueueSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.RemoveListener(lc)
+
+	for cmd := byte(1); cmd <= 3; cmd++ {
+		b.dispatch(EsbMessage{Address: testPipelineAddress[:], Cmd: cmd})
+	}
+	select {
+	case <-disconnecting.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout, listener was not disconnected")
+	}
+	if disconnecting.Err() != ErrDisconnected || other.Err() != nil {
+		t.Fatalf("Expected ErrDisconnected and nil, got %v and %v", disconnecting.Err(), other.Err())
+	}
+
+	// the other listener still delivers to the channel
+	for cmd := byte(1); cmd <= 3; cmd++ {
+		if m, ok := <-lc; !ok || m.Cmd != cmd {
+			t.Fatalf("Expected message %v, got %+v (open: %v)", cmd, m, ok)
+		}
+	}
+}
+
+// TestSlowListener tests that a listener which does not receive does not block the other listeners and transfers
+func TestSlowListener(t *testing.T) {
+	if *testDevice != "" {
+		t.Skip("incoming messages can only be simulated with the emulator")
+	}
+	b := &Bridge{}
+	if err := b.OpenTransport(testEmulator.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	// make sure the emulator serves the pipe before messages are sent
+	if _, err := b.GetFwVersion(); err != nil {
+		t.Fatal(err)
+	}
+
+	slow := make(chan EsbMessage)
+	b.AddListenerWithOptions(testPipelineAddress, 0xFF, slow, ListenerOptions{QueueSize: 2, Overflow: DropNewest})
+	defer b.RemoveListener(slow)
+	fast := make(chan EsbMessage)
+	b.AddListenerWithOptions(testPipelineAddress, 0xFF, fast, ListenerOptions{QueueSize: 100})
+	defer b.RemoveListener(fast)
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		testEmulator.Receive(testPipelineAddress, emulator.Message{Cmd: byte(i)})
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case m := <-fast:
+			if m.Cmd != byte(i) || m.Dropped != 0 {
+				t.Fatalf("Expected message %v without drops, got %+v", i, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout, message %v was not received", i)
+		}
+	}
+
+	if _, err := b.Transfer(EsbMessage{Address: testPipelineAddress[:], Cmd: 0x10}); err != nil {
+		t.Fatalf("Transfer failed while a listener is stalled: %v", err)
+	}
+	// one message is held by the delivery goroutine, two are queued
+	if s := b.AddressStats()[testPipelineAddress]; s.Dropped != n-3 {
+		t.Fatalf("Expected %v dropped messages, got %+v", n-3, s)
+	}
+}
+
+// TestConcurrentListeners tests subscribing and unsubscribing concurrently while messages are received.
+// No message may be delivered after the listener was removed. Run with -race
+func TestConcurrentListeners(t *testing.T) {
+	if *testDevice != "" {
+		t.Skip("incoming messages can only be simulated with the emulator")
+	}
+	b := &Bridge{}
+	if err := b.OpenTransport(testEmulator.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := b.GetFwVersion(); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				testEmulator.Receive(testPipelineAddress, emulator.Message{Cmd: 0x20})
+			}
+		}
+	}()
+
+	const workers, cycles = 8, 250
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < cycles; i++ {
+				lc := make(chan EsbMessage)
+				opts := ListenerOptions{QueueSize: 1 + i%4, Overflow: OverflowPolicy(i % 2)}
+				var remove func()
+				if w%2 == 0 {
+					s, err := b.Subscribe(testPipelineAddress, 0xFF, lc, opts)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					remove = s.Unsubscribe
+				} else {
+					if err := b.AddListenerWithOptions(testPipelineAddress, 0xFF, lc, opts); err != nil {
+						t.Error(err)
+						return
+					}
+					remove = func() { b.RemoveListener(lc) }
+				}
+				if i%2 == 0 {
+					select {
+					case <-lc:
+					case <-time.After(time.Millisecond):
+					}
+				}
+				remove()
+				select {
+				case m := <-lc:
+					t.Errorf("Message delivered after the listener was removed: %+v", m)
+					return
+				default:
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	<-received
+
+	b.listenersMutex.RLock()
+	n := len(b.listeners)
+	b.listenersMutex.RUnlock()
+	if n != 0 {
+		t.Fatalf("Expected no remaining listeners, got %v", n)
+	}
+	if _, err := b.Transfer(EsbMessage{Address: testPipelineAddress[:], Cmd: 0x10}); err != nil {
+		t.Fatalf("Transfer after removing the listeners failed: %v", err)
+	}
+}
+
+// TestParseOverflowPolicy tests the names of the overflow policies
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, p := range []OverflowPolicy{DropOldest, DropNewest, Disconnect} {
+		parsed, err := ParseOverflowPolicy(p.String())
+		if err != nil || parsed != p {
+			t.Fatalf("Parsing %v failed: %v %v", p, parsed, err)
+		}
+	}
+	if _, err := ParseOverflowPolicy("block"); err == nil {
+		t.Fatalf("Parsing an unknown policy should fail")
+	}
+}
@@ -0,0 +1,254 @@
+package esbbridge
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spritkopf/esb-bridge/internal/usbprotocol"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// Types and constants
+///////////////////////////////////////////////////////////////////////////////
+
+// ConnectionState is the state of the connection between a Bridge and the esb-bridge device
+type ConnectionState int
+
+const (
+	// StateDisconnected - the bridge is closed, or its transport was lost and can not be reopened
+	StateDisconnected ConnectionState = iota
+	// StateConnected - the device is connected and ready
+	StateConnected
+	// StateReconnecting - the connection to the device was lost, the bridge tries to reopen it. Requests fail
+	// with ErrUnavailable meanwhile
+	StateReconnecting
+)
+
+// DefaultReconnectDelay is the default delay before the first attempt to reopen a lost device
+const DefaultReconnectDelay = 100 * time.Millisecond
+
+// DefaultReconnectMaxDelay is the default maximum delay between two attempts to reopen a lost device
+const DefaultReconnectMaxDelay = 5 * time.Second
+
+// byIDDir holds the udev symlinks which name serial devices by vendor, product and serial number
+const byIDDir = "/dev/serial/by-id"
+
+// StateEvent notifies about a change of the connection state
+type StateEvent struct {
+	State ConnectionState
+	// Err is the reason why the connection was lost, nil for StateConnected or if the bridge was closed
+	Err error
+}
+
+// StateChannel is used to notify a subscriber about changes of the connection state
+type StateChannel chan<- StateEvent // StateChannel is send-only
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	}
+	return "unknown"
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Public API
+///////////////////////////////////////////////////////////////////////////////
+
+// State returns the connection state of the default bridge, see Bridge.State()
+func State() ConnectionState {
+	return defaultBridge.State()
+}
+
+// AddStateListener adds a listener for connection state changes to the default bridge, see Bridge.AddStateListener()
+func AddStateListener(c StateChannel) {
+	defaultBridge.AddStateListener(c)
+}
+
+// RemoveStateListener removes a listener for connection state changes from the default bridge,
+// see Bridge.RemoveStateListener()
+func RemoveStateListener(c StateChannel) int {
+	return defaultBridge.RemoveStateListener(c)
+}
+
+// State returns the current connection state of the bridge
+func (b *Bridge) State() ConnectionState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// AddStateListener adds a listener which is notified about every change of the connection state. Events are
+// dropped if the channel is not ready to receive, use a buffered channel
+func (b *Bridge) AddStateListener(c StateChannel) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stateListeners = append(b.stateListeners, c)
+}
+
+// RemoveStateListener removes all state listeners registered for the channel.
+// Returns the number of deleted listeners
+func (b *Bridge) RemoveStateListener(c StateChannel) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	kept := b.stateListeners[:0]
+	for _, l := range b.stateListeners {
+		if l != c {
+			kept = append(kept, l)
+		}
+	}
+	itemsDeleted := len(b.stateListeners) - len(kept)
+	b.stateListeners = kept
+
+	return itemsDeleted
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private functions
+///////////////////////////////////////////////////////////////////////////////
+
+// setState changes the connection state and notifies the state listeners
+func (b *Bridge) setState(state ConnectionState, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == state {
+		return
+	}
+	b.state = state
+
+	for _, l := range b.stateListeners {
+		select {
+		case l <- StateEvent{State: state, Err: err}:
+		default:
+		}
+	}
+}
+
+// supervise waits until the connection is lost and reopens the device. Stops when the bridge is closed or the
+// lost connection can not be reopened (device is empty)
+func (b *Bridge) supervise(conn *usbprotocol.Conn, device string, stop <-chan struct{}) {
+	// prefer the by-id path, the device may come back with a different name
+	paths := []string{device}
+	if byID := byIDPath(device); byID != "" && byID != device {
+		paths = []string{byID, device}
+	}
+
+	for {
+		select {
+		case <-conn.Done():
+		case <-stop:
+			return
+		}
+
+		err := conn.Err()
+		if err == nil {
+			// closed by Close()
+			return
+		}
+
+		// the requests running on the lost connection fail, wait for them before closing it. If the bridge was
+		// closed meanwhile, Close() waits for them
+		b.mu.Lock()
+		var requests *sync.WaitGroup
+		if b.conn == conn {
+			_, requests = b.detach()
+		}
+		b.mu.Unlock()
+		if requests != nil {
+			requests.Wait()
+		}
+		conn.Close()
+
+		if device == "" {
+			b.setState(StateDisconnected, err)
+			return
+		}
+		b.setState(StateReconnecting, err)
+
+		conn = b.reconnect(paths, stop)
+		if conn == nil {
+			return
+		}
+		if b.attach(conn, stop) != nil {
+			return
+		}
+	}
+}
+
+// reconnect tries to reopen one of the device paths with exponential backoff, until a device answers with its
+// firmware version. Returns nil if the bridge was closed meanwhile
+func (b *Bridge) reconnect(paths []string, stop <-chan struct{}) *usbprotocol.Conn {
+	delay := b.ReconnectDelay
+	if delay <= 0 {
+		delay = DefaultReconnectDelay
+	}
+	maxDelay := b.ReconnectMaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultReconnectMaxDelay
+	}
+
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return nil
+		}
+
+		for _, path := range paths {
+			conn := &usbprotocol.Conn{Sequence: &b.seq}
+			if err := conn.Open(path); err != nil {
+				continue
+			}
+			// make sure the device is ready and actually an esb-bridge
+			v, err := readFwVersion(conn)
+			if err != nil {
+				// the connection was not handed out to requests yet
+				conn.Close()
+				continue
+			}
+
+			b.mu.Lock()
+			b.fwVersion = v
+			b.radioInfo = false
+			b.mu.Unlock()
+
+			return conn
+		}
+
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// byIDPath returns the udev by-id path of a serial device, which does not change when the device re-enumerates
+// under a different name (e.g. /dev/ttyACM1 instead of /dev/ttyACM0). Returns an empty string if there is none
+func byIDPath(device string) string {
+	target, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return ""
+	}
+
+	links, _ := filepath.Glob(filepath.Join(byIDDir, "*"))
+	for _, link := range links {
+		if link == device {
+			return link
+		}
+		if t, err := filepath.EvalSymlinks(link); err == nil && t == target {
+			return link
+		}
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+package esbbridge
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+)
+
+// waitForState waits for the next state event and checks its state
+func waitForState(t *testing.T, states <-chan StateEvent, expected ConnectionState) StateEvent {
+	t.Helper()
+
+	select {
+	case ev := <-states:
+		if ev.State != expected {
+			t.Fatalf("Expected state %v, got %v (%v)", expected, ev.State, ev.Err)
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for state %v", expected)
+	}
+	return StateEvent{}
+}
+
+// TestReconnect tests that a lost device is reopened and requests fail with ErrUnavailable meanwhile
+func TestReconnect(t *testing.T) {
+	e := emulator.New()
+	e.AddPeripheral(&emulator.Peripheral{Address: testPipelineAddress})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go e.ServeListener(l)
+
+	b := &Bridge{ReconnectDelay: 10 * time.Millisecond}
+	states := make(chan StateEvent, 10)
+	b.AddStateListener(states)
+
+	if err := b.Open("tcp://" + l.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	waitForState(t, states, StateConnected)
+
+	lc := make(chan EsbMessage, 1)
+	b.AddListener(testPipelineAddress, 0xFF, lc)
+
+	// the reconnected device does not answer until the answers are enabled again
+	e.DropAnswers(1000)
+	e.Unplug()
+
+	ev := waitForState(t, states, StateReconnecting)
+	if ev.Err == nil {
+		t.Fatalf("Reconnecting state should report the reason of the connection loss")
+	}
+	if _, err := b.Transfer(EsbMessage{Address: testPipelineAddress[:], Cmd: 0x10}); err != ErrUnavailable {
+		t.Fatalf("Transfer while reconnecting should fail with ErrUnavailable, got %v", err)
+	}
+
+	e.DropAnswers(0)
+	waitForState(t, states, StateConnected)
+
+	answer, err := b.Transfer(EsbMessage{Address: testPipelineAddress[:], Cmd: 0x10, Payload: []byte{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Cmd != 0x10 {
+		t.Fatalf("Unexpected answer: %v", answer)
+	}
+
+	// listeners are kept across reconnects
+	e.Receive(testPipelineAddress, emulator.Message{Cmd: 0x20})
+	select {
+	case msg := <-lc:
+		if msg.Cmd != 0x20 {
+			t.Fatalf("Unexpected message: %v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout, no message was received after reconnect")
+	}
+
+	b.Close()
+	waitForState(t, states, StateDisconnected)
+}
+
+// TestTransportLost tests that a bridge opened over a transport changes to StateDisconnected when it gets lost
+func TestTransportLost(t *testing.T) {
+	e := emulator.New()
+
+	b := &Bridge{}
+	states := make(chan StateEvent, 10)
+	b.AddStateListener(states)
+
+	if err := b.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	waitForState(t, states, StateConnected)
+
+	if _, err := b.GetFwVersion(); err != nil {
+		t.Fatal(err)
+	}
+	e.Unplug()
+
+	ev := waitForState(t, states, StateDisconnected)
+	if ev.Err == nil {
+		t.Fatalf("Disconnected state should report the reason of the connection loss")
+	}
+	if _, err := b.GetFwVersion(); err == nil {
+		t.Fatalf("Request to lost device should fail")
+	}
+	if n := b.RemoveStateListener(states); n != 1 {
+		t.Fatalf("Expected 1 removed state listener, got %v", n)
+	}
+}
+
+// TestTransportLostDuringTransfers tests that transfers running when the connection is lost fail and the connection
+// is closed after them
+func TestTransportLostDuringTransfers(t *testing.T) {
+	e := emulator.New()
+	e.Latency = 10 * time.Millisecond
+
+	b := &Bridge{}
+	states := make(chan StateEvent, 10)
+	b.AddStateListener(states)
+	if err := b.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	waitForState(t, states, StateConnected)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := b.GetFwVersion(); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	e.Unplug()
+
+	waitForState(t, states, StateDisconnected)
+	wg.Wait()
+}
@@ -0,0 +1,351 @@
+package esbbridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// Types and constants
+///////////////////////////////////////////////////////////////////////////////
+
+// SessionEventType is the type of a SessionEvent
+type SessionEventType int
+
+const (
+	// EventReceived - an incoming message matching the filters of the session
+	EventReceived SessionEventType = iota
+	// EventAnswer - the answer to a transfer
+	EventAnswer
+	// EventSent - a send was acknowledged by the peripheral
+	EventSent
+	// EventFailed - a transfer or send failed, see SessionEvent.Err
+	EventFailed
+)
+
+// SessionEvent is the result of a transfer or send of a session, or an incoming message
+type SessionEvent struct {
+	Type SessionEventType
+	// ID is the ID passed to Session.Transfer() or Session.Send(), 0 for incoming messages
+	ID uint64
+	// Message is the answer or the incoming message. For sends and failed requests it is the sent message.
+	// Message.Seq and Message.Timestamp order the events: they belong to the answer, the acknowledgement or the
+	// incoming message. A failed request has the sequence number of the last message received before it failed
+	Message EsbMessage
+	// Err is the reason of a failed transfer or send
+	Err error
+}
+
+// Session transfers and sends messages and receives the incoming messages matching its filters. Its events are
+// delivered in the order the bridge received the answers, acknowledgements and incoming messages, so a client can
+// tell whether an incoming message arrived before or after an answer. Create it with OpenSession()
+type Session struct {
+	b      *Bridge
+	opts   ListenerOptions
+	events chan SessionEvent
+
+	mu       sync.Mutex
+	filters  []Filter
+	queue    []SessionEvent    // sorted by sequence number
+	received int               // number of incoming messages in queue
+	dropped  uint64            // incoming messages dropped since the last delivered one
+	requests map[uint64]uint64 // running requests, mapped to the last sequence number when they started
+	nextReq  uint64
+
+	wake         chan struct{} // signals queued events to the delivery goroutine, capacity 1
+	disconnected chan struct{} // closed when the Disconnect policy was applied
+	stop         chan struct{} // closed by Close()
+	done         chan struct{} // closed when the delivery goroutine stopped
+}
+
+var sessionEventNames = []string{"received", "answer", "sent", "failed"}
+
+func (t SessionEventType) String() string {
+	if t < 0 || int(t) >= len(sessionEventNames) {
+		return fmt.Sprintf("SessionEventType(%d)", int(t))
+	}
+	return sessionEventNames[t]
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Public API
+///////////////////////////////////////////////////////////////////////////////
+
+// OpenSession opens a session on the default bridge, see Bridge.OpenSession()
+func OpenSession(opts ListenerOptions, filters ...Filter) (*Session, error) {
+	return defaultBridge.OpenSession(opts, filters...)
+}
+
+// OpenSession opens a session which receives the incoming messages matching one of the filters. opts limits the
+// incoming messages queued for the session, answers and acknowledgements are never dropped
+func (b *Bridge) OpenSession(opts ListenerOptions, filters ...Filter) (*Session, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range filters {
+		if err := f.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Session{
+		b:            b,
+		opts:         opts,
+		events:       make(chan SessionEvent),
+		filters:      append([]Filter(nil), filters...),
+		requests:     make(map[uint64]uint64),
+		wake:         make(chan struct{}, 1),
+		disconnected: make(chan struct{}),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	b.listenersMutex.Lock()
+	b.sessions = append(b.sessions, s)
+	b.listenersMutex.Unlock()
+	go s.deliver()
+
+	return s, nil
+}
+
+// Events returns the channel of the events. It is closed after Close() or if the session was disconnected by the
+// Disconnect overflow policy
+func (s *Session) Events() <-chan SessionEvent {
+	return s.events
+}
+
+// Transfer starts a transfer, its answer is delivered as EventAnswer with the ID. Like all requests of the session,
+// it is canceled with ctx
+func (s *Session) Transfer(ctx context.Context, id uint64, message EsbMessage) {
+	s.request(ctx, id, message, true)
+}
+
+// Send starts a send, the acknowledgement of the peripheral is delivered as EventSent with the ID
+func (s *Session) Send(ctx context.Context, id uint64, message EsbMessage) {
+	s.request(ctx, id, message, false)
+}
+
+// SetFilters replaces the filters of the incoming messages. Without filters, no incoming messages are received
+func (s *Session) SetFilters(filters ...Filter) error {
+	for _, f := range filters {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.filters = append([]Filter(nil), filters...)
+	return nil
+}
+
+// Close closes the session. Running requests are not canceled, but their results are discarded
+func (s *Session) Close() {
+	s.b.listenersMutex.Lock()
+	for i, session := range s.b.sessions {
+		if session == s {
+			s.b.sessions = append(s.b.sessions[:i], s.b.sessions[i+1:]...)
+			break
+		}
+	}
+	s.b.listenersMutex.Unlock()
+
+	s.mu.Lock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	s.queue = nil
+	s.mu.Unlock()
+
+	<-s.done
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private functions
+///////////////////////////////////////////////////////////////////////////////
+
+// request runs a transfer or send and queues its result
+func (s *Session) request(ctx context.Context, id uint64, message EsbMessage, transfer bool) {
+	// the answer arrives after all messages received so far, events are held back until it is known
+	s.mu.Lock()
+	s.nextReq++
+	req := s.nextReq
+	s.requests[req] = s.b.seq.Last()
+	s.mu.Unlock()
+
+	go func() {
+		event := SessionEvent{ID: id}
+		var err error
+		if transfer {
+			event.Type = EventAnswer
+			event.Message, err = s.b.TransferContext(ctx, message)
+		} else {
+			event.Type = EventSent
+			event.Message, err = s.b.send(ctx, message)
+		}
+		if err != nil {
+			message.Seq = s.b.seq.Last()
+			message.Timestamp = time.Now()
+			event = SessionEvent{Type: EventFailed, ID: id, Message: message, Err: err}
+		}
+
+		// all incoming messages received before the answer must be queued before it
+		s.b.waitDispatched()
+		s.complete(req, event)
+	}()
+}
+
+// complete queues the result of a request
+func (s *Session) complete(req uint64, event SessionEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.requests, req)
+	if s.closed() {
+		return
+	}
+	s.insert(event)
+	s.signal()
+}
+
+// push queues an incoming message without blocking if it matches one of the filters, and applies the overflow policy
+// if the queue is full. Returns the dropped messages
+func (s *Session) push(message EsbMessage) []EsbMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed() {
+		return nil
+	}
+	matching := false
+	for _, f := range s.filters {
+		if f.Match(message) {
+			matching = true
+			break
+		}
+	}
+	if !matching {
+		return nil
+	}
+
+	var dropped []EsbMessage
+	if s.received >= s.opts.QueueSize {
+		switch s.opts.Overflow {
+		case DropNewest:
+			s.dropped++
+			return []EsbMessage{message}
+		case Disconnect:
+			for _, e := range s.queue {
+				if e.Type == EventReceived {
+					dropped = append(dropped, e.Message)
+				}
+			}
+			dropped = append(dropped, message)
+			s.dropped += uint64(len(dropped))
+			s.queue = nil
+			s.received = 0
+			close(s.disconnected)
+			return dropped
+		default:
+			for i, e := range s.queue {
+				if e.Type == EventReceived {
+					dropped = []EsbMessage{e.Message}
+					s.queue = append(s.queue[:i], s.queue[i+1:]...)
+					s.received--
+					s.dropped++
+					break
+				}
+			}
+		}
+	}
+	s.insert(SessionEvent{Type: EventReceived, Message: message})
+	s.received++
+	s.signal()
+	return dropped
+}
+
+// insert queues an event behind all events with a lower or the same sequence number. s.mu must be held
+func (s *Session) insert(event SessionEvent) {
+	i := len(s.queue)
+	for i > 0 && s.queue[i-1].Message.Seq > event.Message.Seq {
+		i--
+	}
+	s.queue = append(s.queue, SessionEvent{})
+	copy(s.queue[i+1:], s.queue[i:])
+	s.queue[i] = event
+}
+
+// next removes and returns the first queued event, if it can be delivered: no running request may get an answer
+// with a lower sequence number. s.mu must be held
+func (s *Session) next() (SessionEvent, bool) {
+	if len(s.queue) == 0 {
+		return SessionEvent{}, false
+	}
+	event := s.queue[0]
+	for _, started := range s.requests {
+		if event.Message.Seq > started {
+			return SessionEvent{}, false
+		}
+	}
+
+	s.queue = s.queue[:copy(s.queue, s.queue[1:])]
+	if event.Type == EventReceived {
+		s.received--
+		event.Message.Dropped = s.dropped
+		s.dropped = 0
+	}
+	return event, true
+}
+
+// closed returns true if the session was closed or disconnected. s.mu must be held
+func (s *Session) closed() bool {
+	select {
+	case <-s.disconnected:
+		return true
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// signal wakes the delivery goroutine. s.mu must be held
+func (s *Session) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends the queued events to the events channel until the session is closed or disconnected
+func (s *Session) deliver() {
+	defer close(s.done)
+	defer close(s.events)
+	for {
+		s.mu.Lock()
+		event, ok := s.next()
+		s.mu.Unlock()
+		if !ok {
+			select {
+			case <-s.wake:
+				continue
+			case <-s.disconnected:
+				return
+			case <-s.stop:
+				return
+			}
+		}
+
+		select {
+		case s.events <- event:
+		case <-s.disconnected:
+			return
+		case <-s.stop:
+			return
+		}
+	}
+}
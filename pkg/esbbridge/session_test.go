@@ -0,0 +1,99 @@
+package esbbridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+)
+
+// TestSessionOrder tests that the events of a session are delivered in the order the bridge received the messages
+func TestSessionOrder(t *testing.T) {
+	e := emulator.New()
+	defer e.Close()
+	// the peripheral sends a message before every answer, tagged with the payload of the request
+	e.AddPeripheral(&emulator.Peripheral{Address: testPipelineAddress, Handler: func(req emulator.Message) emulator.Message {
+		e.Receive(testPipelineAddress, emulator.Message{Cmd: 0x50, Payload: req.Payload})
+		return req
+	}})
+
+	b := &Bridge{}
+	if err := b.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := b.GetFwVersion(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := b.OpenSession(ListenerOptions{}, Filter{Cmds: []CmdRange{{0x50, 0x50}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	const n = 10
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 1; i <= n; i++ {
+		msg := EsbMessage{Address: testPipelineAddress[:], Cmd: 0x01, Payload: []byte{byte(i)}}
+		if i%2 == 0 {
+			s.Send(ctx, uint64(i), msg)
+		} else {
+			s.Transfer(ctx, uint64(i), msg)
+		}
+	}
+	unknownAddress := []byte{9, 9, 9, 9, 9}
+	s.Transfer(ctx, n+1, EsbMessage{Address: unknownAddress, Cmd: 0x01})
+
+	// every answer and acknowledgement follows the message received while it was transferred
+	var last SessionEvent
+	for results := 0; results < n+1; {
+		var event SessionEvent
+		select {
+		case event = <-s.Events():
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout, %v of %v results received", results, n+1)
+		}
+		if event.Message.Seq <= last.Message.Seq && event.Type != EventFailed {
+			t.Fatalf("Event %+v delivered after %+v", event, last)
+		}
+
+		switch event.Type {
+		case EventReceived:
+		case EventAnswer, EventSent:
+			results++
+			if last.Type != EventReceived || last.Message.Payload[0] != byte(event.ID) {
+				t.Fatalf("Event %+v should follow the message received during the request, got %+v", event, last)
+			}
+			if event.Type == EventSent && event.Message.Payload[0] != byte(event.ID) {
+				t.Fatalf("Sent event should hold the sent message, got %+v", event)
+			}
+		case EventFailed:
+			results++
+			if event.ID != n+1 || !errors.Is(event.Err, ErrNoAck) {
+				t.Fatalf("Unexpected failed request %+v", event)
+			}
+		}
+		if event.Message.Timestamp.IsZero() {
+			t.Fatalf("Event %+v has no timestamp", event)
+		}
+		last = event
+	}
+
+	// without filters, no messages are received
+	if err := s.SetFilters(); err != nil {
+		t.Fatal(err)
+	}
+	s.Transfer(ctx, n+2, EsbMessage{Address: testPipelineAddress[:], Cmd: 0x01, Payload: []byte{1}})
+	if event := <-s.Events(); event.Type != EventAnswer || event.ID != n+2 {
+		t.Fatalf("Expected answer %v, got %+v", n+2, event)
+	}
+
+	s.Close()
+	if _, ok := <-s.Events(); ok {
+		t.Fatalf("Events channel should be closed after Close()")
+	}
+}
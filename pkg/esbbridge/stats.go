@@ -0,0 +1,168 @@
+package esbbridge
+
+import (
+	"errors"
+	"sync"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// Types and constants
+///////////////////////////////////////////////////////////////////////////////
+
+// MaxAddressStats is the number of addresses with their own AddressStats. The messages of further addresses, e.g.
+// of peripherals with corrupted addresses, are counted together, see Bridge.OtherAddressStats(). This way the
+// counters don't grow without bounds
+const MaxAddressStats = 64
+
+// AddressStats holds counters about the ESB messages exchanged with one peripheral address
+type AddressStats struct {
+	// Transfers counts the messages sent with Transfer(), Sends the messages sent with Send()
+	Transfers uint64
+	Sends     uint64
+	// Timeouts counts the transfers and sends the device did not answer in time
+	Timeouts uint64
+	// PeerErrors counts the transfers and sends which failed with a firmware error, e.g. because the peripheral
+	// did not acknowledge the message, see FirmwareError
+	PeerErrors uint64
+	// Received counts the incoming messages by command ID
+	Received map[byte]uint64
+	// Dropped counts the incoming messages dropped for listeners which did not keep up, see OverflowPolicy
+	Dropped uint64
+}
+
+// trafficStats holds the AddressStats of a bridge
+type trafficStats struct {
+	mu        sync.Mutex
+	addresses map[[AddressSize]byte]*AddressStats
+	others    *AddressStats // the addresses beyond MaxAddressStats, nil until there is one
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Public API
+///////////////////////////////////////////////////////////////////////////////
+
+// GetAddressStats returns the message counters of the default bridge, see Bridge.AddressStats()
+func GetAddressStats() map[[AddressSize]byte]AddressStats {
+	return defaultBridge.AddressStats()
+}
+
+// GetOtherAddressStats returns the message counters of the default bridge beyond MaxAddressStats addresses, see
+// Bridge.OtherAddressStats()
+func GetOtherAddressStats() (AddressStats, bool) {
+	return defaultBridge.OtherAddressStats()
+}
+
+// AddressStats returns a copy of the message counters of the addresses the bridge exchanged messages with, at most
+// MaxAddressStats addresses. Unlike LinkStats, the counters are kept when the connection to the device is lost
+func (b *Bridge) AddressStats() map[[AddressSize]byte]AddressStats {
+	return b.stats.load()
+}
+
+// OtherAddressStats returns a copy of the message counters of all addresses beyond the MaxAddressStats addresses
+// returned by AddressStats(). Returns false if the bridge exchanged messages with no further address
+func (b *Bridge) OtherAddressStats() (AddressStats, bool) {
+	return b.stats.loadOthers()
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Private functions
+///////////////////////////////////////////////////////////////////////////////
+
+// countSent counts a message sent with Transfer() (transfer = true) or Send() and the error it failed with
+func (s *trafficStats) countSent(address []byte, transfer bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.get(address)
+	if transfer {
+		a.Transfers++
+	} else {
+		a.Sends++
+	}
+
+	var fwErr *FirmwareError
+	switch {
+	case errors.Is(err, ErrTimeout):
+		a.Timeouts++
+	case errors.As(err, &fwErr):
+		a.PeerErrors++
+	}
+}
+
+// countReceived counts an incoming message
+func (s *trafficStats) countReceived(message EsbMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.get(message.Address)
+	if a.Received == nil {
+		a.Received = make(map[byte]uint64)
+	}
+	a.Received[message.Cmd]++
+}
+
+// countDropped counts an incoming message dropped for a listener
+func (s *trafficStats) countDropped(message EsbMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.get(message.Address).Dropped++
+}
+
+// get returns the counters of an address, they are created on first use. Beyond MaxAddressStats addresses, the
+// counters of the other addresses are returned. s.mu must be held
+func (s *trafficStats) get(address []byte) *AddressStats {
+	var key [AddressSize]byte
+	copy(key[:], address)
+
+	if s.addresses == nil {
+		s.addresses = make(map[[AddressSize]byte]*AddressStats)
+	}
+	if a, ok := s.addresses[key]; ok {
+		return a
+	}
+	if len(s.addresses) >= MaxAddressStats {
+		if s.others == nil {
+			s.others = &AddressStats{}
+		}
+		return s.others
+	}
+	a := &AddressStats{}
+	s.addresses[key] = a
+	return a
+}
+
+// load returns a copy of the counters of the addresses
+func (s *trafficStats) load() map[[AddressSize]byte]AddressStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[[AddressSize]byte]AddressStats, len(s.addresses))
+	for key, a := range s.addresses {
+		stats[key] = a.copy()
+	}
+	return stats
+}
+
+// loadOthers returns a copy of the counters of the addresses beyond MaxAddressStats, false if there are none
+func (s *trafficStats) loadOthers() (AddressStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.others == nil {
+		return AddressStats{}, false
+	}
+	return s.others.copy(), true
+}
+
+// copy returns a deep copy of the counters
+func (a *AddressStats) copy() AddressStats {
+	c := *a
+	if a.Received != nil {
+		c.Received = make(map[byte]uint64, len(a.Received))
+		for cmd, n := range a.Received {
+			c.Received[cmd] = n
+		}
+	}
+	return c
+}
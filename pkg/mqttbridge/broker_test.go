@@ -0,0 +1,275 @@
+package mqttbridge
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// testBroker is a minimal in-process MQTT 3.1.1 broker for the tests. It supports retained messages, wills, wildcard
+// subscriptions and QoS 0 and 1. Messages are not queued for disconnected clients
+type testBroker struct {
+	l net.Listener
+
+	mu       sync.Mutex
+	sessions map[*brokerSession]struct{}
+	retained map[string]*packets.PublishPacket
+	history  map[string][]string // payloads by topic, in the order they were published
+}
+
+// brokerSession is the connection of a client to the test broker
+type brokerSession struct {
+	conn     net.Conn
+	clientID string
+
+	writeMutex sync.Mutex
+	nextID     uint16 // guarded by writeMutex
+
+	// guarded by testBroker.mu
+	filters map[string]byte // granted QoS by topic filter
+	will    *packets.PublishPacket
+}
+
+// startBroker starts a test broker on a local port, it is closed with the test
+func startBroker(t *testing.T) *testBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testBroker{l: l, sessions: make(map[*brokerSession]struct{}),
+		retained: make(map[string]*packets.PublishPacket), history: make(map[string][]string)}
+	go b.serve()
+	t.Cleanup(func() {
+		l.Close()
+		b.Disconnect()
+	})
+	return b
+}
+
+// URL returns the broker address for paho clients
+func (b *testBroker) URL() string {
+	return "tcp://" + b.l.Addr().String()
+}
+
+// Disconnect drops the connections of all clients without DISCONNECT, so their wills are published
+func (b *testBroker) Disconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+}
+
+// Retained returns the payload of the retained message of a topic
+func (b *testBroker) Retained(topic string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p, ok := b.retained[topic]; ok {
+		return string(p.Payload)
+	}
+	return ""
+}
+
+// Published returns the payloads published on a topic so far
+func (b *testBroker) Published(topic string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.history[topic]...)
+}
+
+// serve accepts clients until the listener is closed
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.l.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+// handle serves a client connection
+func (b *testBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	p, err := packets.ReadPacket(r)
+	if err != nil {
+		return
+	}
+	connect, ok := p.(*packets.ConnectPacket)
+	if !ok {
+		return
+	}
+	s := &brokerSession{conn: conn, clientID: connect.ClientIdentifier, filters: make(map[string]byte)}
+	if connect.WillFlag {
+		will := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+		will.TopicName = connect.WillTopic
+		will.Payload = connect.WillMessage
+		will.Qos = connect.WillQos
+		will.Retain = connect.WillRetain
+		s.will = will
+	}
+
+	b.mu.Lock()
+	for other := range b.sessions {
+		if other.clientID == s.clientID {
+			// a client with the same ID takes over the session
+			other.conn.Close()
+		}
+	}
+	b.sessions[s] = struct{}{}
+	b.mu.Unlock()
+	s.write(packets.NewControlPacket(packets.Connack))
+
+	for {
+		p, err := packets.ReadPacket(r)
+		if err != nil {
+			break
+		}
+		switch p := p.(type) {
+		case *packets.PublishPacket:
+			if p.Qos > 0 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				s.write(ack)
+			}
+			b.publish(p)
+		case *packets.SubscribePacket:
+			b.subscribe(s, p)
+		case *packets.PingreqPacket:
+			s.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			b.mu.Lock()
+			s.will = nil
+			b.mu.Unlock()
+			b.remove(s)
+			return
+		}
+	}
+	b.remove(s)
+}
+
+// remove ends a session and publishes its will
+func (b *testBroker) remove(s *brokerSession) {
+	b.mu.Lock()
+	will := s.will
+	s.will = nil
+	delete(b.sessions, s)
+	b.mu.Unlock()
+
+	if will != nil {
+		b.publish(will)
+	}
+}
+
+// publish delivers a message to all subscribers and stores it, if it is retained
+func (b *testBroker) publish(p *packets.PublishPacket) {
+	b.mu.Lock()
+	b.history[p.TopicName] = append(b.history[p.TopicName], string(p.Payload))
+	if p.Retain {
+		if len(p.Payload) == 0 {
+			delete(b.retained, p.TopicName)
+		} else {
+			b.retained[p.TopicName] = p
+		}
+	}
+	receivers := make(map[*brokerSession]byte)
+	for s := range b.sessions {
+		for f, qos := range s.filters {
+			if matchTopic(f, p.TopicName) && qos >= receivers[s] {
+				receivers[s] = qos
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for s, qos := range receivers {
+		s.deliver(p, qos, false)
+	}
+}
+
+// subscribe handles a SUBSCRIBE packet and delivers the retained messages of the new topic filters
+func (b *testBroker) subscribe(s *brokerSession, p *packets.SubscribePacket) {
+	ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	ack.MessageID = p.MessageID
+
+	b.mu.Lock()
+	type retainedMessage struct {
+		m   *packets.PublishPacket
+		qos byte
+	}
+	var retained []retainedMessage
+	for i, f := range p.Topics {
+		qos := p.Qoss[i]
+		if qos > 1 {
+			qos = 1
+		}
+		s.filters[f] = qos
+		ack.ReturnCodes = append(ack.ReturnCodes, qos)
+		for topic, m := range b.retained {
+			if matchTopic(f, topic) {
+				retained = append(retained, retainedMessage{m, qos})
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	s.write(ack)
+	for _, r := range retained {
+		s.deliver(r.m, r.qos, true)
+	}
+}
+
+// deliver sends a message to the client with at most the granted QoS. Acknowledgements of the client are ignored
+func (s *brokerSession) deliver(m *packets.PublishPacket, granted byte, retained bool) {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName = m.TopicName
+	p.Payload = m.Payload
+	p.Qos = m.Qos
+	if granted < p.Qos {
+		p.Qos = granted
+	}
+	p.Retain = retained
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	if p.Qos > 0 {
+		s.nextID++
+		if s.nextID == 0 {
+			s.nextID++
+		}
+		p.MessageID = s.nextID
+	}
+	if err := p.Write(s.conn); err != nil {
+		s.conn.Close()
+	}
+}
+
+// write sends a packet to the client, errors end the session in the reader
+func (s *brokerSession) write(p packets.ControlPacket) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	if err := p.Write(s.conn); err != nil {
+		s.conn.Close()
+	}
+}
+
+// matchTopic returns true if a topic matches a topic filter with the wildcards + and #
+func matchTopic(filter string, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
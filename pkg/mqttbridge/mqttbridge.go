@@ -0,0 +1,277 @@
+// Package mqttbridge connects an esb-bridge RPC server to an MQTT broker. Incoming ESB messages are published on
+// the broker, and transfers and sends can be requested by publishing on the broker.
+//
+// Topics (with the default prefix "esb", addresses and commands hex encoded):
+//   esb/status                      "online" or "offline" (retained, "offline" is the will of the bridge)
+//   esb/<addr>/rx/<cmd>             incoming messages, e.g. esb/6f6f6f6f01/rx/01
+//   esb/<addr>/tx                   requests, e.g. {"correlation_id": "42", "cmd": 16, "payload": "0102"}
+//   esb/<addr>/tx/response          responses, e.g. {"correlation_id": "42", "ok": true, "cmd": 16, "payload": ""}
+//
+// Requests are received with QoS 1 in a persistent session, so requests published with QoS 1 while the bridge is
+// disconnected are delivered by the broker when it reconnects. Responses are published with QoS 1, incoming messages
+// with QoS 0.
+//
+// Requests are transfers, unless "send": true is set. The response is published on "response_topic" of the request,
+// if set. Failed requests are answered with "ok": false and the error in "message"
+package mqttbridge
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/spritkopf/esb-bridge/pkg/client"
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+)
+
+// DefaultTopicPrefix is the first level of all topics, if no other prefix is configured
+const DefaultTopicPrefix = "esb"
+
+// DefaultClientID is the MQTT client ID of the bridge, if none is configured
+const DefaultClientID = "esb-bridge"
+
+// DefaultReconnectDelay is the maximum time between attempts to reconnect to the broker, if none is configured
+const DefaultReconnectDelay = 2 * time.Second
+
+// publishTimeout is the time to wait for the broker to take over a published message
+const publishTimeout = 5 * time.Second
+
+// Payloads of the status topic
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+// Config holds the configuration of the MQTT bridge
+type Config struct {
+	// Broker is the address of the MQTT broker, e.g. "tcp://localhost:1883"
+	Broker string
+	// ClientID is the MQTT client ID, DefaultClientID if empty
+	ClientID string
+	// Username and Password authenticate the bridge at the broker, optional
+	Username string
+	Password string
+	// TopicPrefix is the first level of all topics, DefaultTopicPrefix if empty
+	TopicPrefix string
+	// Addresses are the pipeline addresses to listen on, their incoming messages are published. The incoming
+	// messages of all addresses are published if empty
+	Addresses [][]byte
+	// ReconnectDelay is the maximum time between attempts to reconnect to the broker, and the time to wait before
+	// listening again after a Listen stream ended. DefaultReconnectDelay if 0
+	ReconnectDelay time.Duration
+}
+
+// Request is the JSON payload of a request on a tx topic
+type Request struct {
+	CorrelationID string `json:"correlation_id"`
+	Cmd           *uint8 `json:"cmd"`
+	Payload       string `json:"payload,omitempty"`
+	Send          bool   `json:"send,omitempty"`
+	ResponseTopic string `json:"response_topic,omitempty"`
+}
+
+// Response is the JSON payload of a response to a request. Cmd, Error and Payload are the answer of a transfer
+type Response struct {
+	CorrelationID string `json:"correlation_id"`
+	OK            bool   `json:"ok"`
+	Message       string `json:"message,omitempty"`
+	Cmd           uint8  `json:"cmd"`
+	Error         uint8  `json:"error"`
+	Payload       string `json:"payload"`
+}
+
+// RxMessage is the JSON payload of an incoming message on an rx topic
+type RxMessage struct {
+	Addr    string `json:"addr"`
+	Cmd     uint8  `json:"cmd"`
+	Payload string `json:"payload"`
+}
+
+// Bridge forwards messages between an esb-bridge RPC server and an MQTT broker
+type Bridge struct {
+	cfg    Config
+	esb    client.EsbClientInterface
+	client mqtt.Client
+}
+
+// New creates an MQTT bridge for a connected esb-bridge client. Call Run() to start it
+func New(cfg Config, esb client.EsbClientInterface) *Bridge {
+	if cfg.TopicPrefix == "" {
+		cfg.TopicPrefix = DefaultTopicPrefix
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = DefaultClientID
+	}
+	if cfg.ReconnectDelay == 0 {
+		cfg.ReconnectDelay = DefaultReconnectDelay
+	}
+	b := &Bridge{cfg: cfg, esb: esb}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetCleanSession(false).
+		SetWill(b.statusTopic(), StatusOffline, 1, true).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(cfg.ReconnectDelay).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(cfg.ReconnectDelay).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("MQTT connection lost: %v", err)
+		})
+	b.client = mqtt.NewClient(opts)
+	return b
+}
+
+// Run listens on the configured addresses and connects to the broker. Lost connections to the broker and ended
+// Listen streams are reestablished. Runs until ctx is done, then "offline" is published and the connection is
+// closed. Returns an error if listening fails at the start
+func (b *Bridge) Run(ctx context.Context) error {
+	for _, addr := range b.addresses() {
+		stream, err := b.esb.ListenStream(ctx, addr, 0xFF)
+		if err != nil {
+			return fmt.Errorf("could not listen on %x: %w", addr, err)
+		}
+		go b.forward(ctx, addr, stream)
+	}
+
+	// the connection is retried until it succeeds, and reestablished when it is lost
+	b.client.Connect()
+	<-ctx.Done()
+
+	if b.client.IsConnectionOpen() {
+		b.client.Publish(b.statusTopic(), 1, true, StatusOffline).WaitTimeout(publishTimeout)
+	}
+	b.client.Disconnect(250)
+	return nil
+}
+
+//////////////////////////////////////////////////////////
+// Private functions
+//////////////////////////////////////////////////////////
+
+// onConnect subscribes the request topics and publishes "online", after every connection to the broker
+func (b *Bridge) onConnect(c mqtt.Client) {
+	log.Printf("Connected to MQTT broker %v", b.cfg.Broker)
+
+	token := c.Subscribe(b.cfg.TopicPrefix+"/+/tx", 1, func(_ mqtt.Client, m mqtt.Message) {
+		// requests take a while, the handler must not block the MQTT connection
+		go b.handleRequest(m)
+	})
+	if token.WaitTimeout(publishTimeout) && token.Error() != nil {
+		log.Printf("MQTT subscribe failed: %v", token.Error())
+	}
+	c.Publish(b.statusTopic(), 1, true, StatusOnline)
+}
+
+// publish publishes a message on the broker. Incoming messages (QoS 0) are dropped while the broker is not
+// connected, responses (QoS 1) are sent after the connection was reestablished
+func (b *Bridge) publish(topic string, qos byte, v interface{}) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("MQTT message error: %v", err)
+		return
+	}
+	token := b.client.Publish(topic, qos, false, payload)
+	if token.WaitTimeout(publishTimeout) && token.Error() != nil {
+		log.Printf("MQTT publish on %v failed: %v", topic, token.Error())
+	}
+}
+
+// addresses returns the addresses of the Listen streams, the configured addresses or the zero address, which
+// listens on all addresses
+func (b *Bridge) addresses() [][]byte {
+	if len(b.cfg.Addresses) == 0 {
+		return [][]byte{make([]byte, esbbridge.AddressSize)}
+	}
+	return b.cfg.Addresses
+}
+
+// forward publishes incoming messages on their rx topics until ctx is done. If the Listen stream ends, e.g. because
+// the server restarted, it listens on the address again
+func (b *Bridge) forward(ctx context.Context, addr []byte, stream *client.ListenStream) {
+	for {
+		for msg := range stream.Messages() {
+			topic := fmt.Sprintf("%v/%x/rx/%02x", b.cfg.TopicPrefix, msg.Address, msg.Cmd)
+			b.publish(topic, 0, RxMessage{
+				Addr:    hex.EncodeToString(msg.Address),
+				Cmd:     msg.Cmd,
+				Payload: hex.EncodeToString(msg.Payload)})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Listen stream for %x ended: %v", addr, stream.Err())
+
+		for stream = nil; stream == nil; {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(b.cfg.ReconnectDelay):
+			}
+			var err error
+			if stream, err = b.esb.ListenStream(ctx, addr, 0xFF); err != nil {
+				log.Printf("Could not listen on %x: %v", addr, err)
+			}
+		}
+	}
+}
+
+// handleRequest executes a request published on a tx topic and publishes the response
+func (b *Bridge) handleRequest(m mqtt.Message) {
+	// topic: <prefix>/<addr>/tx
+	levels := strings.Split(strings.TrimPrefix(m.Topic(), b.cfg.TopicPrefix+"/"), "/")
+	responseTopic := m.Topic() + "/response"
+
+	var req Request
+	answer, err := func() (esbbridge.EsbMessage, error) {
+		addr, err := hex.DecodeString(levels[0])
+		if err != nil || len(addr) != esbbridge.AddressSize {
+			return esbbridge.EsbMessage{}, fmt.Errorf("%w: invalid address %q", esbbridge.ErrInvalidParam, levels[0])
+		}
+		if err := json.Unmarshal(m.Payload(), &req); err != nil {
+			return esbbridge.EsbMessage{}, fmt.Errorf("%w: invalid request: %v", esbbridge.ErrInvalidParam, err)
+		}
+		if req.ResponseTopic != "" {
+			responseTopic = req.ResponseTopic
+		}
+		if req.Cmd == nil {
+			return esbbridge.EsbMessage{}, fmt.Errorf("%w: missing cmd", esbbridge.ErrInvalidParam)
+		}
+		payload, err := hex.DecodeString(req.Payload)
+		if err != nil {
+			return esbbridge.EsbMessage{}, fmt.Errorf("%w: invalid payload: %v", esbbridge.ErrInvalidParam, err)
+		}
+
+		msg := esbbridge.EsbMessage{Address: addr, Cmd: *req.Cmd, Payload: payload}
+		if req.Send {
+			return esbbridge.EsbMessage{}, b.esb.Send(msg)
+		}
+		return b.esb.Transfer(msg)
+	}()
+
+	resp := Response{CorrelationID: req.CorrelationID, OK: err == nil}
+	if err != nil {
+		log.Printf("MQTT request on %v failed: %v", m.Topic(), err)
+		resp.Message = err.Error()
+	} else {
+		resp.Cmd = answer.Cmd
+		resp.Error = answer.Error
+		resp.Payload = hex.EncodeToString(answer.Payload)
+	}
+	b.publish(responseTopic, 1, resp)
+}
+
+// statusTopic returns the topic of the online/offline status
+func (b *Bridge) statusTopic() string {
+	return b.cfg.TopicPrefix + "/status"
+}
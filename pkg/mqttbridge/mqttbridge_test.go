@@ -0,0 +1,221 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"google.golang.org/grpc"
+
+	"github.com/spritkopf/esb-bridge/pkg/client"
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	"github.com/spritkopf/esb-bridge/pkg/server"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+var testAddress = [emulator.AddressSize]byte{111, 111, 111, 111, 1}
+
+// startEsbClient starts an in-process RPC server connected to the emulator and returns a client connected to it
+func startEsbClient(t *testing.T, e *emulator.Emulator) *client.EsbClient {
+	c, _ := startEsbServer(t, e)
+	return c
+}
+
+// startEsbServer works like startEsbClient, but also returns a function which restarts the RPC server on the same
+// address, ending the running streams
+func startEsbServer(t *testing.T, e *emulator.Emulator) (*client.EsbClient, func()) {
+	bridge := &esbbridge.Bridge{}
+	if err := bridge.OpenTransport(e.Pipe()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bridge.Close() })
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var grpcServer *grpc.Server
+	serve := func(lis net.Listener) {
+		grpcServer = grpc.NewServer()
+		pb.RegisterEsbBridgeServer(grpcServer, server.NewService(bridge))
+		go grpcServer.Serve(lis)
+	}
+	serve(lis)
+	t.Cleanup(func() { grpcServer.Stop() })
+	restart := func() {
+		grpcServer.Stop()
+		lis, err := net.Listen("tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve(lis)
+	}
+
+	c := &client.EsbClient{}
+	if err := c.Connect(lis.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Disconnect() })
+	return c, restart
+}
+
+// subscribe connects a test client to the broker and returns the messages of a topic filter
+func subscribe(t *testing.T, broker *testBroker, filter string) (mqtt.Client, <-chan mqtt.Message) {
+	c := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker.URL()).SetClientID("test").SetAutoReconnect(false))
+	if token := c.Connect(); !token.WaitTimeout(3*time.Second) || token.Error() != nil {
+		t.Fatalf("Could not connect to the broker: %v", token.Error())
+	}
+	t.Cleanup(func() { c.Disconnect(0) })
+
+	messages := make(chan mqtt.Message, 100)
+	token := c.Subscribe(filter, 1, func(_ mqtt.Client, m mqtt.Message) { messages <- m })
+	if !token.WaitTimeout(3*time.Second) || token.Error() != nil {
+		t.Fatalf("Could not subscribe %v: %v", filter, token.Error())
+	}
+	return c, messages
+}
+
+// waitFor waits for the next message on a topic, other messages are skipped
+func waitFor(t *testing.T, messages <-chan mqtt.Message, topic string) mqtt.Message {
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case m := <-messages:
+			if m.Topic() == topic {
+				return m
+			}
+		case <-timeout:
+			t.Fatalf("Timeout, no message on %v", topic)
+		}
+	}
+}
+
+// waitRetained waits until the retained message of a topic has the expected payload
+func waitRetained(t *testing.T, broker *testBroker, topic string, payload string) {
+	for start := time.Now(); time.Since(start) < 3*time.Second; time.Sleep(10 * time.Millisecond) {
+		if broker.Retained(topic) == payload {
+			return
+		}
+	}
+	t.Fatalf("Expected %q on %v, got %q", payload, topic, broker.Retained(topic))
+}
+
+// TestBridge tests requests, incoming messages and the status of the MQTT bridge
+func TestBridge(t *testing.T) {
+	e := emulator.New()
+	e.AddPeripheral(&emulator.Peripheral{Address: testAddress})
+	esb := startEsbClient(t, e)
+
+	broker := startBroker(t)
+
+	b := New(Config{Broker: broker.URL(), Addresses: [][]byte{testAddress[:]}, ReconnectDelay: 50 * time.Millisecond}, esb)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error)
+	go func() {
+		runErr <- b.Run(ctx)
+	}()
+
+	sub, messages := subscribe(t, broker, "esb/#")
+
+	if m := waitFor(t, messages, "esb/status"); string(m.Payload()) != StatusOnline {
+		t.Fatalf("Expected status online, got %q", m.Payload())
+	}
+
+	// transfer
+	sub.Publish("esb/6f6f6f6f01/tx", 1, false, `{"correlation_id": "1", "cmd": 16, "payload": "0102"}`)
+	var resp Response
+	json.Unmarshal(waitFor(t, messages, "esb/6f6f6f6f01/tx/response").Payload(), &resp)
+	if resp.CorrelationID != "1" || !resp.OK || resp.Cmd != 16 {
+		t.Fatalf("Unexpected transfer response: %+v", resp)
+	}
+
+	// send to an unknown peripheral, with response topic
+	sub.Publish("esb/0909090909/tx", 1, false, `{"correlation_id": "2", "cmd": 16, "send": true, "response_topic": "esb/responses"}`)
+	resp = Response{}
+	json.Unmarshal(waitFor(t, messages, "esb/responses").Payload(), &resp)
+	if resp.CorrelationID != "2" || resp.OK || resp.Message == "" {
+		t.Fatalf("Unexpected send response: %+v", resp)
+	}
+
+	// incoming message, repeated until the listener of the server is attached
+	e.Receive(testAddress, emulator.Message{Cmd: 0x01, Payload: []byte{0xAB}})
+	ticker := time.NewTicker(100 * time.Millisecond)
+	go func() {
+		for range ticker.C {
+			e.Receive(testAddress, emulator.Message{Cmd: 0x01, Payload: []byte{0xAB}})
+		}
+	}()
+	var rx RxMessage
+	json.Unmarshal(waitFor(t, messages, "esb/6f6f6f6f01/rx/01").Payload(), &rx)
+	ticker.Stop()
+	if rx.Addr != "6f6f6f6f01" || rx.Cmd != 1 || rx.Payload != "ab" {
+		t.Fatalf("Unexpected incoming message: %+v", rx)
+	}
+
+	// the bridge reconnects after a lost connection, the will is published in between
+	published := len(broker.Published("esb/status"))
+	broker.Disconnect()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		status := broker.Published("esb/status")[published:]
+		if len(status) >= 2 {
+			if status[0] != StatusOffline || status[1] != StatusOnline {
+				t.Fatalf("Expected offline and online after a lost connection, got %q", status)
+			}
+			break
+		}
+		if time.Since(start) > 3*time.Second {
+			t.Fatalf("Timeout, status after a lost connection: %q", status)
+		}
+	}
+
+	cancel()
+	if err := <-runErr; err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	waitRetained(t, broker, "esb/status", StatusOffline)
+}
+
+// TestBridgeListenAgain tests that the bridge publishes the incoming messages of all addresses by default, and
+// listens again after the Listen stream ended
+func TestBridgeListenAgain(t *testing.T) {
+	e := emulator.New()
+	esb, restart := startEsbServer(t, e)
+
+	broker := startBroker(t)
+
+	b := New(Config{Broker: broker.URL(), ReconnectDelay: 50 * time.Millisecond}, esb)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	_, messages := subscribe(t, broker, "esb/+/rx/#")
+
+	// incoming messages are repeated until the listener of the server is attached
+	receive := func(addr [emulator.AddressSize]byte, topic string) {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		timeout := time.After(5 * time.Second)
+		for {
+			e.Receive(addr, emulator.Message{Cmd: 0x02})
+			select {
+			case m := <-messages:
+				if m.Topic() == topic {
+					return
+				}
+			case <-ticker.C:
+			case <-timeout:
+				t.Fatalf("Timeout, no message on %v", topic)
+			}
+		}
+	}
+	receive(testAddress, "esb/6f6f6f6f01/rx/02")
+	receive([emulator.AddressSize]byte{1, 2, 3, 4, 5}, "esb/0102030405/rx/02")
+
+	restart()
+	receive(testAddress, "esb/6f6f6f6f01/rx/02")
+}
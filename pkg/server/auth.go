@@ -0,0 +1,339 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// AllRPCs can be put into ClientPolicy.RPCs to allow all RPCs
+const AllRPCs = "*"
+
+// Policy maps the identities of clients to the RPCs they may call. A client is identified by a bearer token,
+// sent in the "authorization" metadata, or by the common name of its certificate if the server requires client
+// certificates. Clients without matching entry are rejected with status UNAUTHENTICATED, denied requests with
+// status PERMISSION_DENIED
+//
+// Example policy file:
+//   {"clients": [
+//     {"name": "heating", "rpcs": ["Transfer", "Send"], "addresses": ["111.111.111.111"], "cmds": [16, 17]},
+//     {"name": "dashboard", "token": "secret", "rpcs": ["Listen", "GetBridgeInfo"]}
+//   ]}
+type Policy struct {
+	Clients []ClientPolicy `json:"clients"`
+}
+
+// ClientPolicy holds the identity of a client and what it is allowed to do
+type ClientPolicy struct {
+	// Name identifies the client by the common name of its certificate
+	Name string `json:"name"`
+	// Token identifies the client by bearer token, optional
+	Token string `json:"token,omitempty"`
+	// RPCs are the names of the allowed RPCs, e.g. "Transfer" or "Listen". AllRPCs allows all
+	RPCs []string `json:"rpcs"`
+	// Addresses are the allowed pipeline address prefixes in dotted notation, e.g. "111.111.111.111" allows all
+	// pipelines 111.111.111.111.x. All addresses are allowed if empty
+	Addresses []string `json:"addresses,omitempty"`
+	// Cmds are the allowed command bytes. All commands are allowed if empty
+	Cmds []uint8 `json:"cmds,omitempty"`
+
+	addressPrefixes [][]byte
+}
+
+// addressedRequest is implemented by all requests directed to a peripheral
+type addressedRequest interface {
+	GetAddr() []byte
+	GetCmd() []byte
+}
+
+// LoadPolicy reads a policy from a JSON file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read policy: %v", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid policy %v: %v", path, err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, fmt.Errorf("invalid policy %v: %v", path, err)
+	}
+	return &p, nil
+}
+
+// compile validates the policy and parses the address prefixes
+func (p *Policy) compile() error {
+	names := map[string]bool{}
+	tokens := map[string]bool{}
+	for i := range p.Clients {
+		c := &p.Clients[i]
+		if c.Name == "" {
+			return fmt.Errorf("client %v has no name", i)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("duplicate client %q", c.Name)
+		}
+		names[c.Name] = true
+		if c.Token != "" {
+			if tokens[c.Token] {
+				return fmt.Errorf("client %q: token is used by another client", c.Name)
+			}
+			tokens[c.Token] = true
+		}
+
+		c.addressPrefixes = nil
+		for _, a := range c.Addresses {
+			prefix, err := parseAddressPrefix(a)
+			if err != nil {
+				return fmt.Errorf("client %q: %v", c.Name, err)
+			}
+			c.addressPrefixes = append(c.addressPrefixes, prefix)
+		}
+	}
+	return nil
+}
+
+// identify returns the policy of the client which made the call, or nil if it is unknown
+func (p *Policy) identify(ctx context.Context) *ClientPolicy {
+	var authorization []string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		authorization = md.Get("authorization")
+	}
+	return p.identifyClient(authorization, peerCertificate(ctx))
+}
+
+// identifyClient returns the policy of the client with a bearer token in one of the authorization headers, or with
+// the verified client certificate cert (may be nil). Returns nil if the client is unknown
+func (p *Policy) identifyClient(authorization []string, cert *x509.Certificate) *ClientPolicy {
+	for _, auth := range authorization {
+		if !strings.HasPrefix(auth, "Bearer ") {
+			continue
+		}
+		token := []byte(strings.TrimPrefix(auth, "Bearer "))
+		for i := range p.Clients {
+			c := &p.Clients[i]
+			if c.Token != "" && subtle.ConstantTimeCompare([]byte(c.Token), token) == 1 {
+				return c
+			}
+		}
+		// an invalid token is not overruled by the certificate
+		return nil
+	}
+
+	if cert != nil {
+		for i := range p.Clients {
+			if p.Clients[i].Name == cert.Subject.CommonName {
+				return &p.Clients[i]
+			}
+		}
+	}
+	return nil
+}
+
+// allowsRPC checks if the client may call an RPC
+func (c *ClientPolicy) allowsRPC(rpc string) bool {
+	for _, r := range c.RPCs {
+		if r == AllRPCs || r == rpc {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsRequest checks if the client may send a request to a peripheral
+func (c *ClientPolicy) allowsRequest(req addressedRequest) bool {
+	if len(c.addressPrefixes) > 0 {
+		allowed := false
+		for _, prefix := range c.addressPrefixes {
+			if bytes.HasPrefix(req.GetAddr(), prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if len(c.Cmds) == 0 {
+		return true
+	}
+	// a Listen request with cmd 0xFF receives all commands, so it is only allowed if 0xFF is listed as well
+	if len(req.GetCmd()) == 0 {
+		return false
+	}
+	for _, cmd := range c.Cmds {
+		if cmd == req.GetCmd()[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize checks an RPC call against the policy
+func (p *Policy) authorize(ctx context.Context, fullMethod string) (*ClientPolicy, error) {
+	rpc := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	client := p.identify(ctx)
+	return client, client.checkRPC(rpc)
+}
+
+// checkRPC returns a status error if the client is unknown (nil) or may not call the RPC
+func (c *ClientPolicy) checkRPC(rpc string) error {
+	if c == nil {
+		return status.Error(codes.Unauthenticated, "unknown client")
+	}
+	if !c.allowsRPC(rpc) {
+		return status.Errorf(codes.PermissionDenied, "client %q may not call %v", c.Name, rpc)
+	}
+	return nil
+}
+
+// checkRequest returns a status error if the client may not send the request
+func (c *ClientPolicy) checkRequest(req addressedRequest) error {
+	if l, ok := req.(*pb.Listener); ok && l.Filter != nil {
+		return c.checkFilter(l.Filter)
+	}
+	// the address prefixes only hold for complete addresses, the firmware reads the bytes after the address as
+	// command and payload
+	if m, ok := req.(*pb.EsbMessage); ok && len(m.Addr) != esbbridge.AddressSize {
+		return rpcError(fmt.Errorf("%w: address %v, expected %v bytes", esbbridge.ErrInvalidParam, m.Addr,
+			esbbridge.AddressSize))
+	}
+	if c.allowsRequest(req) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "client %q may not access cmd %v of %v", c.Name,
+		req.GetCmd(), req.GetAddr())
+}
+
+// checkFilter returns a status error if the client may not listen with the filter. nil is the filter for all
+// messages
+func (c *ClientPolicy) checkFilter(f *pb.Filter) error {
+	if f == nil {
+		f = &pb.Filter{}
+	}
+	if !c.allowsFilter(f) {
+		return status.Errorf(codes.PermissionDenied, "client %q may not listen for all messages of the filter",
+			c.Name)
+	}
+	return nil
+}
+
+// unaryInterceptor authorizes unary RPCs and their requests
+func (p *Policy) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	if isHealthCheck(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	client, err := p.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := req.(addressedRequest); ok {
+		if err := client.checkRequest(r); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor authorizes streaming RPCs and every request received on the stream
+func (p *Policy) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+
+	if isHealthCheck(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	client, err := p.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{ServerStream: ss, client: client})
+}
+
+// authorizedStream checks the requests received on a stream against the policy of the client
+type authorizedStream struct {
+	grpc.ServerStream
+	client *ClientPolicy
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if r, ok := m.(addressedRequest); ok {
+		return s.client.checkRequest(r)
+	}
+	switch r := m.(type) {
+	case *pb.SubscribeRequest:
+		if r.GetAdd() != nil {
+			return s.client.checkFilter(r.GetAdd().Filter)
+		}
+	case *pb.SessionRequest:
+		return s.client.checkSessionRequest(r)
+	}
+	return nil
+}
+
+// checkSessionRequest returns a status error if the client may not transfer or send the message of a session
+// request, or listen with one of its filters
+func (c *ClientPolicy) checkSessionRequest(req *pb.SessionRequest) error {
+	switch r := req.Request.(type) {
+	case *pb.SessionRequest_Transfer:
+		return c.checkRequest(r.Transfer)
+	case *pb.SessionRequest_Send:
+		return c.checkRequest(r.Send)
+	case *pb.SessionRequest_Listen:
+		for _, f := range r.Listen.Filters {
+			if err := c.checkFilter(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// peerCertificate returns the verified client certificate of the call, or nil if there is none
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return tlsInfo.State.VerifiedChains[0][0]
+}
+
+// parseAddressPrefix parses an address prefix in dotted notation, e.g. "111.111.111.111"
+func parseAddressPrefix(s string) ([]byte, error) {
+	// the missing bytes are filled in, so the prefix can be parsed like a complete address
+	n := strings.Count(s, ".") + 1
+	if n > esbbridge.AddressSize {
+		return nil, fmt.Errorf("invalid address prefix %q", s)
+	}
+	addr, err := esbbridge.ParseAddress(s + strings.Repeat(".0", esbbridge.AddressSize-n))
+	if err != nil {
+		return nil, fmt.Errorf("invalid address prefix %q", s)
+	}
+	return addr[:n], nil
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/internal/testcert"
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+const testPolicy = `{"clients": [
+	{"name": "heating", "token": "heating-token", "rpcs": ["Transfer", "Send"], "addresses": ["111.111.111.111"], "cmds": [16]},
+	{"name": "dashboard", "token": "dashboard-token", "rpcs": ["Listen", "GetBridgeInfo"], "cmds": [1]},
+	{"name": "admin", "rpcs": ["*"]}
+]}`
+
+// withToken returns a context which sends a bearer token
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// TestLoadPolicy tests reading and validating policy files
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(path, []byte(testPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy() failed: %v", err)
+	}
+	if len(p.Clients) != 3 || string(p.Clients[0].addressPrefixes[0]) != string([]byte{111, 111, 111, 111}) {
+		t.Fatalf("Unexpected policy: %+v", p)
+	}
+
+	for _, invalid := range []string{
+		`{"clients": [{"rpcs": ["*"]}]}`,
+		`{"clients": [{"name": "a"}, {"name": "a"}]}`,
+		`{"clients": [{"name": "a", "token": "t"}, {"name": "b", "token": "t"}]}`,
+		`{"clients": [{"name": "a", "addresses": ["111.256"]}]}`,
+		`{"clients": [{"name": "a", "addresses": ["1.2.3.4.5.6"]}]}`,
+		`{"clients": [{"name": "a", "cmds": [256]}]}`,
+		`{"clients": `,
+	} {
+		if err := ioutil.WriteFile(path, []byte(invalid), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadPolicy(path); err == nil {
+			t.Fatalf("LoadPolicy() should fail for %v", invalid)
+		}
+	}
+}
+
+// TestPolicy tests the authentication and authorization of RPCs by token
+func TestPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := ioutil.WriteFile(path, []byte(testPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := emulator.New()
+	e.AddPeripheral(&emulator.Peripheral{Address: testAddress})
+	s, client := startTestServer(t, e, Config{Policy: policy, HTTPListen: "127.0.0.1:0"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	transfer := func(ctx context.Context, addr []byte, cmd byte) error {
+		_, err := client.Transfer(ctx, &pb.EsbMessage{Addr: addr, Cmd: []byte{cmd}})
+		return err
+	}
+	listen := func(ctx context.Context, cmd byte) error {
+		stream, err := client.Listen(ctx, &pb.Listener{Addr: testAddress[:], Cmd: []byte{cmd}})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	}
+
+	listenFilter := func(ctx context.Context, filter *pb.Filter) error {
+		stream, err := client.Listen(ctx, &pb.Listener{Filter: filter})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	}
+
+	if err := transfer(withToken("heating-token"), testAddress[:], 0x10); err != nil {
+		t.Fatalf("Transfer should be allowed, got %v", err)
+	}
+
+	denied := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{"no token", transfer(context.Background(), testAddress[:], 0x10), codes.Unauthenticated},
+		{"invalid token", transfer(withToken("wrong"), testAddress[:], 0x10), codes.Unauthenticated},
+		{"rpc", transfer(withToken("dashboard-token"), testAddress[:], 0x10), codes.PermissionDenied},
+		{"address", transfer(withToken("heating-token"), []byte{9, 9, 9, 9, 9}, 0x10), codes.PermissionDenied},
+		{"cmd", transfer(withToken("heating-token"), testAddress[:], 0x20), codes.PermissionDenied},
+		// the firmware would take the byte after a 5 byte address as command
+		{"long address", transfer(withToken("heating-token"), append(testAddress[:], 0x99), 0x10),
+			codes.InvalidArgument},
+		{"short address", transfer(withToken("heating-token"), testAddress[:4], 0x10), codes.InvalidArgument},
+		{"stream rpc", listen(withToken("heating-token"), 0x01), codes.PermissionDenied},
+		{"listen all cmds", listen(withToken("dashboard-token"), 0xFF), codes.PermissionDenied},
+		{"filter all cmds", listenFilter(withToken("dashboard-token"), &pb.Filter{}), codes.PermissionDenied},
+		{"filter cmd range", listenFilter(withToken("dashboard-token"),
+			&pb.Filter{Cmds: []*pb.CmdRange{{First: 0x01, Last: 0x02}}}), codes.PermissionDenied},
+	}
+	for _, d := range denied {
+		if status.Code(d.err) != d.code {
+			t.Fatalf("%v: expected status %v, got %v", d.name, d.code, d.err)
+		}
+	}
+	// the policy rejects incomplete addresses itself, not only the bridge
+	for _, addr := range [][]byte{testAddress[:4], append(testAddress[:], 0x99)} {
+		err := policy.Clients[0].checkRequest(&pb.EsbMessage{Addr: addr, Cmd: []byte{0x10}})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Policy check of address %v: expected status %v, got %v", addr, codes.InvalidArgument, err)
+		}
+	}
+
+	if _, err := client.GetBridgeInfo(withToken("dashboard-token"), &pb.BridgeInfoRequest{}); err != nil {
+		t.Fatalf("GetBridgeInfo should be allowed, got %v", err)
+	}
+
+	// the HTTP gateway uses the same policy
+	url := "http://" + s.HTTPAddr().String()
+	body := `{"addr": "111.111.111.111.1", "cmd": 16}`
+	if code := httpCall(t, "POST", url+"/transfer", "heating-token", body, nil); code != http.StatusOK {
+		t.Fatalf("HTTP transfer should be allowed, got status %v", code)
+	}
+	if code := httpCall(t, "POST", url+"/transfer", "", body, nil); code != http.StatusUnauthorized {
+		t.Fatalf("HTTP transfer without token should be rejected, got status %v", code)
+	}
+	if code := httpCall(t, "POST", url+"/transfer", "dashboard-token", body, nil); code != http.StatusForbidden {
+		t.Fatalf("HTTP transfer should be denied, got status %v", code)
+	}
+	if code := httpCall(t, "GET", url+"/listen?addr=111.111.111.111.1", "dashboard-token", "", nil); code != http.StatusForbidden {
+		t.Fatalf("HTTP listen for all commands should be denied, got status %v", code)
+	}
+}
+
+// TestPolicyCertificate tests the identification of clients by the name of their certificate
+func TestPolicyCertificate(t *testing.T) {
+	ca, err := testcert.NewCA(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, serverKey, err := ca.Issue("localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, clientKey, err := ca.Issue("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &Policy{Clients: []ClientPolicy{{Name: "admin", RPCs: []string{"GetBridgeInfo"}}}}
+	cfg := Config{TLSCert: serverCert, TLSKey: serverKey, TLSClientCA: ca.CertFile, Policy: policy}
+
+	cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := ioutil.ReadFile(ca.CertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	creds := credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: roots})
+
+	e := emulator.New()
+	s, client := startTestServer(t, e, cfg, grpc.WithTransportCredentials(creds))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	if _, err := client.GetBridgeInfo(context.Background(), &pb.BridgeInfoRequest{}); err != nil {
+		t.Fatalf("GetBridgeInfo should be allowed, got %v", err)
+	}
+	_, err = client.Send(context.Background(), &pb.EsbMessage{Addr: testAddress[:], Cmd: []byte{0x10}})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Send should be denied, got %v", err)
+	}
+}
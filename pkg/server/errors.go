@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// errMissingCmd is returned for messages without command byte
+var errMissingCmd = fmt.Errorf("%w: missing cmd", esbbridge.ErrInvalidParam)
+
+// rpcErrors maps the errors of esbbridge to status codes and error reasons
+var rpcErrors = []struct {
+	err    error
+	code   codes.Code
+	reason pb.ErrorReason
+}{
+	{esbbridge.ErrNotConnected, codes.FailedPrecondition, pb.ErrorReason_ERR_NOT_CONNECTED},
+	{esbbridge.ErrUnavailable, codes.Unavailable, pb.ErrorReason_ERR_UNAVAILABLE},
+	{esbbridge.ErrTimeout, codes.DeadlineExceeded, pb.ErrorReason_ERR_TIMEOUT},
+	{esbbridge.ErrPayloadTooLarge, codes.InvalidArgument, pb.ErrorReason_ERR_PAYLOAD_TOO_LARGE},
+	{esbbridge.ErrInvalidParam, codes.InvalidArgument, pb.ErrorReason_ERR_INVALID_PARAM},
+	{esbbridge.ErrProtocol, codes.Internal, pb.ErrorReason_ERR_PROTOCOL},
+	{context.Canceled, codes.Canceled, pb.ErrorReason_ERR_UNKNOWN},
+}
+
+// rpcError converts a bridge error into an RPC error with matching status code. An ErrorDetail is attached, so the
+// client can restore the original error
+func rpcError(err error) error {
+	code := codes.Unknown
+	detail := &pb.ErrorDetail{}
+
+	var fwErr *esbbridge.FirmwareError
+	if errors.As(err, &fwErr) {
+		code = codes.Internal
+		if fwErr.Code == esbbridge.FwErrNoAck {
+			// the message did not reach the peripheral, it can be repeated
+			code = codes.Aborted
+		}
+		detail.Reason = pb.ErrorReason_ERR_FIRMWARE
+		detail.FwCmd = uint32(fwErr.Cmd)
+		detail.FwCode = uint32(fwErr.Code)
+	} else {
+		for _, e := range rpcErrors {
+			if errors.Is(err, e.err) {
+				code = e.code
+				detail.Reason = e.reason
+				break
+			}
+		}
+	}
+
+	st, detailErr := status.New(code, err.Error()).WithDetails(detail)
+	if detailErr != nil {
+		return status.Error(code, err.Error())
+	}
+	return st.Err()
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// listenFilter returns the filter of a Listen request, its filter if set, otherwise its address and command
+func listenFilter(listener *pb.Listener) (esbbridge.Filter, error) {
+	if listener.Filter != nil {
+		return filterFromProto(listener.Filter)
+	}
+	if len(listener.Cmd) != 1 {
+		return esbbridge.Filter{}, fmt.Errorf("%w: listener needs one cmd byte, got %v", esbbridge.ErrInvalidParam,
+			listener.Cmd)
+	}
+	var addr [esbbridge.AddressSize]byte
+	copy(addr[:], listener.Addr)
+	return esbbridge.ListenerFilter(addr, listener.Cmd[0]), nil
+}
+
+// filterFromProto converts and validates a filter of a request
+func filterFromProto(f *pb.Filter) (esbbridge.Filter, error) {
+	var filter esbbridge.Filter
+	if len(f.Addr) > esbbridge.AddressSize || len(f.AddrMask) > esbbridge.AddressSize {
+		return filter, fmt.Errorf("%w: filter address longer than %v bytes", esbbridge.ErrInvalidParam,
+			esbbridge.AddressSize)
+	}
+	copy(filter.Address[:], f.Addr)
+	copy(filter.AddressMask[:], f.AddrMask)
+
+	for _, r := range f.Cmds {
+		if r.First > 0xFF || r.Last > 0xFF {
+			return filter, fmt.Errorf("%w: invalid command range %v-%v", esbbridge.ErrInvalidParam, r.First, r.Last)
+		}
+		filter.Cmds = append(filter.Cmds, esbbridge.CmdRange{First: byte(r.First), Last: byte(r.Last)})
+	}
+	for _, p := range f.Payload {
+		if p.Offset > uint32(esbbridge.MaxPayloadSize) {
+			return filter, fmt.Errorf("%w: payload offset %v out of range", esbbridge.ErrInvalidParam, p.Offset)
+		}
+		filter.Payload = append(filter.Payload, esbbridge.PayloadMatch{Offset: int(p.Offset), Value: p.Value,
+			Mask: p.Mask})
+	}
+	for _, e := range f.Exclude {
+		exclude, err := filterFromProto(e)
+		if err != nil {
+			return filter, err
+		}
+		filter.Exclude = append(filter.Exclude, exclude)
+	}
+	return filter, filter.Validate()
+}
+
+// allowsFilter checks if all messages a filter may match are allowed for the client. Payload patterns and exclude
+// filters only narrow the filter, they are not taken into account
+func (c *ClientPolicy) allowsFilter(f *pb.Filter) bool {
+	if len(c.addressPrefixes) > 0 {
+		allowed := false
+		for _, prefix := range c.addressPrefixes {
+			if len(f.AddrMask) >= len(prefix) && len(f.Addr) >= len(prefix) &&
+				bytes.Equal(f.Addr[:len(prefix)], prefix) && allOnes(f.AddrMask[:len(prefix)]) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if len(c.Cmds) == 0 {
+		return true
+	}
+	// a filter without commands receives all commands
+	if len(f.Cmds) == 0 {
+		return false
+	}
+	cmds := map[uint32]bool{}
+	for _, cmd := range c.Cmds {
+		cmds[uint32(cmd)] = true
+	}
+	for _, r := range f.Cmds {
+		for cmd := r.First; cmd <= r.Last && cmd <= 0xFF; cmd++ {
+			if !cmds[cmd] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// allOnes returns true if all bits of the mask are set
+func allOnes(mask []byte) bool {
+	for _, b := range mask {
+		if b != 0xFF {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"testing"
+
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// TestAllowsFilter tests that a filter is only allowed if all messages it may match are allowed
+func TestAllowsFilter(t *testing.T) {
+	policy := &Policy{Clients: []ClientPolicy{{Name: "sensors", Addresses: []string{"111.111.111"},
+		Cmds: []uint8{0x10, 0x11, 0x12}}}}
+	if err := policy.compile(); err != nil {
+		t.Fatal(err)
+	}
+	c := &policy.Clients[0]
+
+	prefix := []byte{111, 111, 111, 111, 0}
+	prefixMask := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00}
+	cases := []struct {
+		filter  *pb.Filter
+		allowed bool
+	}{
+		{&pb.Filter{Addr: prefix, AddrMask: prefixMask, Cmds: []*pb.CmdRange{{First: 0x10, Last: 0x12}}}, true},
+		{&pb.Filter{Addr: prefix, AddrMask: prefixMask, Cmds: []*pb.CmdRange{{First: 0x10, Last: 0x13}}}, false},
+		{&pb.Filter{Addr: prefix, AddrMask: prefixMask}, false},
+		{&pb.Filter{Addr: prefix, AddrMask: []byte{0xFF, 0xFF}, Cmds: []*pb.CmdRange{{First: 0x10, Last: 0x10}}}, false},
+		{&pb.Filter{Addr: []byte{111, 111, 112}, AddrMask: prefixMask, Cmds: []*pb.CmdRange{{First: 0x10, Last: 0x10}}}, false},
+	}
+	for i, tc := range cases {
+		if allowed := c.allowsFilter(tc.filter); allowed != tc.allowed {
+			t.Fatalf("Case %v: expected %v, got %v", i, tc.allowed, allowed)
+		}
+	}
+}
+
+// TestFilterFromProto tests the conversion of the filter of a Listen request
+func TestFilterFromProto(t *testing.T) {
+	f, err := filterFromProto(&pb.Filter{
+		Addr:     []byte{111, 111, 111, 111},
+		AddrMask: []byte{0xFF, 0xFF, 0xFF, 0xFF},
+		Exclude:  []*pb.Filter{{Cmds: []*pb.CmdRange{{First: 0x01, Last: 0x01}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := f.String(); s != "addr 111.111.111.111.* !(cmd 0x01)" {
+		t.Fatalf("Unexpected filter %v", s)
+	}
+
+	invalid := []*pb.Filter{
+		{Addr: []byte{1, 2, 3, 4, 5, 6}},
+		{Cmds: []*pb.CmdRange{{First: 0x10, Last: 0x100}}},
+		{Cmds: []*pb.CmdRange{{First: 0x10, Last: 0x01}}},
+		{Payload: []*pb.PayloadMatch{{Offset: 1000, Value: []byte{1}}}},
+		{Exclude: []*pb.Filter{{Payload: []*pb.PayloadMatch{{Offset: 0}}}}},
+	}
+	for _, f := range invalid {
+		if _, err := filterFromProto(f); err == nil {
+			t.Fatalf("Conversion of %v should fail", f)
+		}
+	}
+}
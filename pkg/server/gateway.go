@@ -0,0 +1,390 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// The HTTP gateway makes the RPC service available to clients which can't speak gRPC. Its endpoints call the
+// same service methods as the gRPC server, so the behavior and the errors are the same:
+//
+//   POST /transfer  {"addr": "111.111.111.111.1", "cmd": 16, "payload": "0102"} -> answer message
+//   POST /send      {"addr": "111.111.111.111.1", "cmd": 16, "payload_base64": "AQI="} -> {}
+//   GET  /info      -> bridge info
+//   GET  /listen?addr=111.111.111.111.1&cmd=255 -> Server-Sent Events, one event per incoming message
+//
+// Without addr and cmd, /listen streams the incoming messages of all addresses and commands.
+// Payloads are sent either hex encoded ("payload") or base64 encoded ("payload_base64"), answers contain both.
+// Errors are answered with a matching HTTP status and a body like
+// {"code": "Unavailable", "reason": "ERR_UNAVAILABLE", "message": "..."}
+
+// httpRequest is the JSON body of POST /transfer and POST /send
+type httpRequest struct {
+	Addr          string `json:"addr"`
+	Cmd           *uint8 `json:"cmd"`
+	Payload       string `json:"payload,omitempty"`
+	PayloadBase64 string `json:"payload_base64,omitempty"`
+}
+
+// httpMessage is the JSON representation of an answer or an incoming message
+type httpMessage struct {
+	Addr          string `json:"addr"`
+	Cmd           uint8  `json:"cmd"`
+	Error         uint8  `json:"error"`
+	Payload       string `json:"payload"`
+	PayloadBase64 string `json:"payload_base64"`
+	// Dropped is the number of messages dropped before this one, listen only
+	Dropped uint64 `json:"dropped,omitempty"`
+	// Seq and Time are the sequence number and the time of arrival (RFC 3339) of the message
+	Seq  uint64 `json:"seq,omitempty"`
+	Time string `json:"time,omitempty"`
+	// Radio is the radio metadata of an incoming message, if the firmware reports it
+	Radio *httpRadioInfo `json:"radio,omitempty"`
+}
+
+// httpRadioInfo is the JSON representation of the radio metadata of an incoming message
+type httpRadioInfo struct {
+	Pipe        uint32 `json:"pipe"`
+	RSSI        int32  `json:"rssi"`
+	Retransmits uint32 `json:"retransmits"`
+}
+
+// httpBridgeInfo is the JSON representation of the bridge info
+type httpBridgeInfo struct {
+	FwVersion      string   `json:"fw_version"`
+	Device         string   `json:"device"`
+	UptimeSeconds  uint64   `json:"uptime_seconds"`
+	State          string   `json:"state"`
+	Capabilities   []string `json:"capabilities"`
+	MaxPayloadSize uint32   `json:"max_payload_size"`
+}
+
+// httpError is the JSON body of error responses
+type httpError struct {
+	Code    string `json:"code"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message"`
+}
+
+// gateway serves the HTTP endpoints
+type gateway struct {
+	service *esbBridgeServer
+	policy  *Policy
+	metrics *serverMetrics
+}
+
+// newGateway creates the HTTP handler of the gateway. If policy is not nil, clients are authenticated and
+// authorized like gRPC clients: by "Authorization: Bearer <token>" header or client certificate. The requests are
+// measured by metrics, like the RPC interceptors do for gRPC calls
+func newGateway(service *esbBridgeServer, policy *Policy, metrics *serverMetrics) http.Handler {
+	g := &gateway{service: service, policy: policy, metrics: metrics}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/transfer", g.handler(http.MethodPost, "Transfer", g.transfer))
+	mux.HandleFunc("/send", g.handler(http.MethodPost, "Send", g.send))
+	mux.HandleFunc("/info", g.handler(http.MethodGet, "GetBridgeInfo", g.info))
+	mux.HandleFunc("/listen", g.handler(http.MethodGet, "Listen", g.listen))
+	return mux
+}
+
+// gatewayFunc handles a request of an authorized client. client is nil if there is no policy
+type gatewayFunc func(w http.ResponseWriter, r *http.Request, client *ClientPolicy)
+
+// handler checks the method of the request and authorizes the client for the RPC behind the endpoint
+func (g *gateway) handler(method string, rpc string, f gatewayFunc) http.HandlerFunc {
+	return g.metrics.httpHandler(rpc, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(httpError{Code: codes.Unimplemented.String(), Message: "method not allowed"})
+			return
+		}
+
+		var client *ClientPolicy
+		if g.policy != nil {
+			var cert *x509.Certificate
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+				cert = r.TLS.VerifiedChains[0][0]
+			}
+			client = g.policy.identifyClient(r.Header.Values("Authorization"), cert)
+			if err := client.checkRPC(rpc); err != nil {
+				writeHTTPError(w, err)
+				return
+			}
+		}
+
+		f(w, r, client)
+	})
+}
+
+// transfer handles POST /transfer
+func (g *gateway) transfer(w http.ResponseWriter, r *http.Request, client *ClientPolicy) {
+	msg, err := g.decodeMessage(r, client)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	answer, err := g.service.Transfer(r.Context(), msg)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeJSON(w, newHTTPMessage(answer))
+}
+
+// send handles POST /send
+func (g *gateway) send(w http.ResponseWriter, r *http.Request, client *ClientPolicy) {
+	msg, err := g.decodeMessage(r, client)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	if _, err := g.service.Send(r.Context(), msg); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeJSON(w, struct{}{})
+}
+
+// info handles GET /info
+func (g *gateway) info(w http.ResponseWriter, r *http.Request, client *ClientPolicy) {
+	info, err := g.service.GetBridgeInfo(r.Context(), &pb.BridgeInfoRequest{})
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	writeJSON(w, httpBridgeInfo{
+		FwVersion:      fmt.Sprintf("%v.%v.%v", info.FwVersion.Major, info.FwVersion.Minor, info.FwVersion.Patch),
+		Device:         info.Device,
+		UptimeSeconds:  info.UptimeSeconds,
+		State:          esbbridge.ConnectionState(info.State).String(),
+		Capabilities:   info.Capabilities,
+		MaxPayloadSize: info.MaxPayloadSize,
+	})
+}
+
+// listen handles GET /listen. Incoming messages are streamed as Server-Sent Events until the client disconnects.
+// If the stream ends because of an error, e.g. the shutdown of the server, a final "error" event is sent
+func (g *gateway) listen(w http.ResponseWriter, r *http.Request, client *ClientPolicy) {
+	// like in the Listen RPC, the zero address receives the messages of all addresses
+	addr := make([]byte, esbbridge.AddressSize)
+	var err error
+	if a := r.URL.Query().Get("addr"); a != "" {
+		addr, err = parseAddress(a)
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+	}
+	cmd := uint64(0xFF)
+	if c := r.URL.Query().Get("cmd"); c != "" {
+		cmd, err = strconv.ParseUint(c, 0, 8)
+		if err != nil {
+			writeHTTPError(w, rpcError(fmt.Errorf("%w: invalid cmd %q", esbbridge.ErrInvalidParam, c)))
+			return
+		}
+	}
+	listener := &pb.Listener{Addr: addr, Cmd: []byte{byte(cmd)}}
+	if client != nil {
+		if err := client.checkRequest(listener); err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeHTTPError(w, status.Error(codes.Internal, "streaming not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	stream := &sseStream{ctx: r.Context(), w: w, flusher: flusher}
+	if err := g.service.Listen(listener, stream); err != nil {
+		data, _ := json.Marshal(newHTTPError(err))
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+}
+
+// decodeMessage reads the JSON body of a transfer or send request and checks it against the policy of the client
+func (g *gateway) decodeMessage(r *http.Request, client *ClientPolicy) (*pb.EsbMessage, error) {
+	var req httpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, rpcError(fmt.Errorf("%w: invalid request body: %v", esbbridge.ErrInvalidParam, err))
+	}
+
+	addr, err := parseAddress(req.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if req.Cmd == nil {
+		return nil, rpcError(errMissingCmd)
+	}
+
+	var payload []byte
+	switch {
+	case req.Payload != "" && req.PayloadBase64 != "":
+		err = fmt.Errorf("%w: payload and payload_base64 are exclusive", esbbridge.ErrInvalidParam)
+	case req.PayloadBase64 != "":
+		payload, err = base64.StdEncoding.DecodeString(req.PayloadBase64)
+	default:
+		payload, err = hex.DecodeString(req.Payload)
+	}
+	if err != nil {
+		return nil, rpcError(fmt.Errorf("%w: invalid payload: %v", esbbridge.ErrInvalidParam, err))
+	}
+
+	msg := &pb.EsbMessage{Addr: addr, Cmd: []byte{*req.Cmd}, Payload: payload}
+	if client != nil {
+		if err := client.checkRequest(msg); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// sseStream passes the messages of the Listen RPC on as Server-Sent Events
+type sseStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s *sseStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *sseStream) Send(msg *pb.EsbMessage) error {
+	data, err := json.Marshal(newHTTPMessage(msg))
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// newHTTPMessage converts a message of the RPC service
+func newHTTPMessage(msg *pb.EsbMessage) httpMessage {
+	m := httpMessage{
+		Addr:          formatAddress(msg.Addr),
+		Payload:       hex.EncodeToString(msg.Payload),
+		PayloadBase64: base64.StdEncoding.EncodeToString(msg.Payload),
+		Dropped:       msg.Dropped,
+		Seq:           msg.Seq,
+	}
+	if msg.TimeUnixNano != 0 {
+		m.Time = time.Unix(0, msg.TimeUnixNano).UTC().Format(time.RFC3339Nano)
+	}
+	if msg.Radio != nil {
+		m.Radio = &httpRadioInfo{Pipe: msg.Radio.Pipe, RSSI: msg.Radio.Rssi, Retransmits: msg.Radio.Retransmits}
+	}
+	if len(msg.Cmd) > 0 {
+		m.Cmd = msg.Cmd[0]
+	}
+	if len(msg.Error) > 0 {
+		m.Error = msg.Error[0]
+	}
+	return m
+}
+
+// newHTTPError converts a status error of the RPC service
+func newHTTPError(err error) httpError {
+	st := status.Convert(err)
+	e := httpError{Code: st.Code().String(), Message: st.Message()}
+	for _, d := range st.Details() {
+		if detail, ok := d.(*pb.ErrorDetail); ok {
+			e.Reason = detail.Reason.String()
+		}
+	}
+	return e
+}
+
+// writeHTTPError answers a request with a status error of the RPC service
+func writeHTTPError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus(status.Code(err)))
+	json.NewEncoder(w).Encode(newHTTPError(err))
+}
+
+// writeJSON answers a request with status 200 and a JSON body
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("HTTP response error: %v", err)
+	}
+}
+
+// httpStatus maps gRPC status codes to HTTP status codes
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.Aborted, codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Canceled:
+		return 499 // client closed request
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// parseAddress parses a pipeline address in dotted notation, e.g. "111.111.111.111.1"
+func parseAddress(s string) ([]byte, error) {
+	addr, err := esbbridge.ParseAddress(s)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return addr[:], nil
+}
+
+// formatAddress formats a pipeline address in dotted notation
+func formatAddress(addr []byte) string {
+	parts := make([]string, len(addr))
+	for i, b := range addr {
+		parts[i] = strconv.Itoa(int(b))
+	}
+	return strings.Join(parts, ".")
+}
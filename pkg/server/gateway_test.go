@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+)
+
+// httpCall sends a request to the gateway and decodes the JSON answer into v (may be nil).
+// Returns the HTTP status code
+func httpCall(t *testing.T, method, url, token, body string, v interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%v %v: invalid answer: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// TestGateway tests the HTTP endpoints of the gateway
+func TestGateway(t *testing.T) {
+	e := emulator.New()
+	e.AddPeripheral(&emulator.Peripheral{Address: testAddress})
+	s, _ := startTestServer(t, e, Config{HTTPListen: "127.0.0.1:0"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	url := "http://" + s.HTTPAddr().String()
+
+	var answer httpMessage
+	code := httpCall(t, "POST", url+"/transfer", "", `{"addr": "111.111.111.111.1", "cmd": 16, "payload": "0102"}`, &answer)
+	if code != http.StatusOK || answer.Addr != "111.111.111.111.1" || answer.Cmd != 16 || answer.Error != 0 {
+		t.Fatalf("Unexpected transfer answer: %v %+v", code, answer)
+	}
+
+	code = httpCall(t, "POST", url+"/send", "", `{"addr": "111.111.111.111.1", "cmd": 16, "payload_base64": "AQI="}`, nil)
+	if code != http.StatusOK {
+		t.Fatalf("Send failed with status %v", code)
+	}
+
+	var info httpBridgeInfo
+	code = httpCall(t, "GET", url+"/info", "", "", &info)
+	if code != http.StatusOK || info.FwVersion != "1.0.0" || info.State != "connected" {
+		t.Fatalf("Unexpected bridge info: %v %+v", code, info)
+	}
+
+	errorCases := []struct {
+		method, path, body string
+		code               int
+		reason             string
+	}{
+		{"POST", "/transfer", `{"addr": "111.111.111.111.1"}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"POST", "/transfer", `{"addr": "111.111.111.111", "cmd": 16}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"POST", "/send", `{"addr": "111.111.111.111.1", "cmd": 16, "payload": "xyz"}`, http.StatusBadRequest, "ERR_INVALID_PARAM"},
+		{"POST", "/transfer", `{"addr": "9.9.9.9.9", "cmd": 16}`, http.StatusConflict, "ERR_FIRMWARE"},
+		{"GET", "/transfer", "", http.StatusMethodNotAllowed, ""},
+		{"GET", "/listen?addr=1.2.3", "", http.StatusBadRequest, "ERR_INVALID_PARAM"},
+	}
+	for _, c := range errorCases {
+		var httpErr httpError
+		code := httpCall(t, c.method, url+c.path, "", c.body, &httpErr)
+		if code != c.code || httpErr.Reason != c.reason {
+			t.Fatalf("%v %v %v: expected %v %v, got %v %+v", c.method, c.path, c.body, c.code, c.reason, code, httpErr)
+		}
+	}
+}
+
+// TestGatewayListen tests the Server-Sent Events of the listen endpoint, which listens on all addresses by default,
+// and their end at shutdown
+func TestGatewayListen(t *testing.T) {
+	e := emulator.New()
+	s, _ := startTestServer(t, e, Config{HTTPListen: "127.0.0.1:0"})
+	go s.Run(context.Background())
+
+	// without addr, the messages of all addresses are received
+	resp, err := http.Get("http://" + s.HTTPAddr().String() + "/listen?cmd=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected listen response: %v %v", resp.StatusCode, resp.Header)
+	}
+
+	// the listener is attached after the response header was sent, repeat the message until it arrives
+	received := make(chan struct{})
+	go func() {
+		for {
+			e.ReceiveRadio(testAddress, emulator.Message{Cmd: 0x01, Payload: []byte{0xAB}},
+				emulator.RadioInfo{Pipe: 1, RSSI: -60})
+			select {
+			case <-received:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}()
+
+	events := bufio.NewScanner(resp.Body)
+	var msg httpMessage
+	for events.Scan() {
+		if strings.HasPrefix(events.Text(), "data: ") {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(events.Text(), "data: ")), &msg); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	close(received)
+	if msg.Addr != "111.111.111.111.1" || msg.Cmd != 1 || msg.Payload != "ab" || msg.Seq == 0 || msg.Time == "" {
+		t.Fatalf("Unexpected event: %+v", msg)
+	}
+	if msg.Radio == nil || msg.Radio.Pipe != 1 || msg.Radio.RSSI != -60 {
+		t.Fatalf("Unexpected radio metadata: %+v", msg.Radio)
+	}
+
+	go s.Shutdown(context.Background())
+
+	// skip repeated messages until the error event of the shutdown
+	for events.Scan() {
+		if events.Text() == "event: error" {
+			return
+		}
+	}
+	t.Fatalf("Expected an error event at shutdown, stream ended with %v", events.Err())
+}
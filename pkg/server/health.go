@@ -0,0 +1,53 @@
+package server
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// newHealthServer creates the standard gRPC health service. The status of the server (service name "") and of the
+// esb-bridge service follows the connection to the device: SERVING while it is connected, NOT_SERVING while it is
+// lost or reconnecting. A device is only connected again after its firmware version was read successfully
+func newHealthServer(bridge *esbbridge.Bridge, done <-chan struct{}) *health.Server {
+	h := health.NewServer()
+
+	// register before reading the current state, so no change gets lost
+	states := make(chan esbbridge.StateEvent, 10)
+	bridge.AddStateListener(states)
+	setHealth(h, bridge.State())
+
+	go func() {
+		defer bridge.RemoveStateListener(states)
+		for {
+			select {
+			case ev := <-states:
+				setHealth(h, ev.State)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return h
+}
+
+// setHealth sets the health status of the server according to the connection state of the device
+func setHealth(h *health.Server, state esbbridge.ConnectionState) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if state == esbbridge.StateConnected {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	h.SetServingStatus("", status)
+	h.SetServingStatus(pb.EsbBridge_ServiceDesc.ServiceName, status)
+}
+
+// isHealthCheck returns true for the RPCs of the health service. They are not subject to the access policy,
+// so probes without credentials (e.g. of Kubernetes) can use them
+func isHealthCheck(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// dialTestServer opens another insecure connection to the test server
+func dialTestServer(t *testing.T, s *Server) *grpc.ClientConn {
+	conn, err := grpc.Dial(s.Addrs()[0].String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestHealth tests that the health status follows the connection to the device
+func TestHealth(t *testing.T) {
+	e := emulator.New()
+	s, _ := startTestServer(t, e, Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	health := healthpb.NewHealthClient(dialTestServer(t, s))
+
+	for _, service := range []string{"", pb.EsbBridge_ServiceDesc.ServiceName} {
+		resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Fatalf("Service %q should be serving, got %v %v", service, resp, err)
+		}
+	}
+
+	watch, err := health.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus := func(expected healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		resp, err := watch.Recv()
+		if err != nil || resp.Status != expected {
+			t.Fatalf("Expected status %v, got %v %v", expected, resp, err)
+		}
+	}
+	expectStatus(healthpb.HealthCheckResponse_SERVING)
+
+	// the reconnected device fails the firmware version check until the answers are enabled again
+	e.DropAnswers(1000)
+	e.Unplug()
+	expectStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	e.DropAnswers(0)
+	expectStatus(healthpb.HealthCheckResponse_SERVING)
+
+	// shutdown
+	go s.Shutdown(ctx)
+	expectStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// TestHealthPolicy tests that health checks need no credentials, while reflection is subject to the policy
+func TestHealthPolicy(t *testing.T) {
+	policy := &Policy{Clients: []ClientPolicy{{Name: "admin", Token: "admin-token", RPCs: []string{AllRPCs}}}}
+	e := emulator.New()
+	s, _ := startTestServer(t, e, Config{Policy: policy})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	conn := dialTestServer(t, s)
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Health check without credentials failed: %v %v", resp, err)
+	}
+
+	listServices := func(ctx context.Context) ([]string, error) {
+		stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		err = stream.Send(&rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_ListServices{ListServices: "*"}})
+		if err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		var services []string
+		for _, s := range resp.GetListServicesResponse().GetService() {
+			services = append(services, s.Name)
+		}
+		return services, nil
+	}
+
+	if _, err := listServices(ctx); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Reflection without credentials should fail with Unauthenticated, got %v", err)
+	}
+
+	// reflection over an insecure connection, the token is sent as plain metadata
+	tokenCtx, tokenCancel := context.WithTimeout(withToken("admin-token"), 5*time.Second)
+	defer tokenCancel()
+	services, err := listServices(tokenCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, s := range services {
+		found[s] = true
+	}
+	if !found[pb.EsbBridge_ServiceDesc.ServiceName] || !found[healthpb.Health_ServiceDesc.ServiceName] {
+		t.Fatalf("Reflection should list the esb-bridge and health services, got %v", services)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// unixPrefix marks a listen address as path of a Unix domain socket
+const unixPrefix = "unix://"
+
+// listen opens a listener for a listen address, "host:port" (IPv6 hosts in brackets, e.g. "[::1]:9815", an empty
+// host listens on all interfaces) or "unix:///path/to/socket"
+func listen(address string) (net.Listener, error) {
+	if strings.HasPrefix(address, unixPrefix) {
+		path := strings.TrimPrefix(address, unixPrefix)
+		if path == "" {
+			return nil, fmt.Errorf("invalid listen address %q: missing socket path", address)
+		}
+		if err := removeStaleSocket(path); err != nil {
+			return nil, fmt.Errorf("could not listen on %q: %v", address, err)
+		}
+		return net.Listen("unix", path)
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %v", address, err)
+	}
+	return net.Listen("tcp", address)
+}
+
+// removeStaleSocket removes the socket file left by a previous run. A socket which still accepts connections is not
+// removed, an error is returned instead
+func removeStaleSocket(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		// net.Listen reports existing files which are no sockets
+		return nil
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("address in use: %v is served by another process", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
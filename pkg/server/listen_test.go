@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestListen tests listening on TCP addresses and Unix domain sockets
+func TestListen(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "esb-bridge.sock")
+
+	for _, address := range []string{"127.0.0.1:0", "localhost:0", unixPrefix + socket} {
+		lis, err := listen(address)
+		if err != nil {
+			t.Fatalf("listen(%q) failed: %v", address, err)
+		}
+		lis.Close()
+	}
+
+	if lis, err := listen("[::1]:0"); err == nil {
+		lis.Close()
+	} else {
+		t.Logf("IPv6 not available: %v", err)
+	}
+
+	for _, address := range []string{"", "9815", "localhost", "unix://"} {
+		if lis, err := listen(address); err == nil {
+			lis.Close()
+			t.Fatalf("listen(%q) should fail", address)
+		}
+	}
+}
+
+// TestListenSocketInUse tests that a socket file left by a previous run is replaced, but a socket in use is not
+func TestListenSocketInUse(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "esb-bridge.sock")
+
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	lis, err := listen(unixPrefix + socket)
+	if err != nil {
+		t.Fatalf("Stale socket should be replaced: %v", err)
+	}
+	defer lis.Close()
+
+	if second, err := listen(unixPrefix + socket); err == nil {
+		second.Close()
+		t.Fatalf("listen() should fail for a socket in use")
+	} else if !strings.Contains(err.Error(), "address in use") {
+		t.Fatalf("Expected address in use error, got %v", err)
+	}
+	if conn, err := net.Dial("unix", socket); err != nil {
+		t.Fatalf("Socket in use should not be removed: %v", err)
+	} else {
+		conn.Close()
+	}
+}
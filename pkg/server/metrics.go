@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+)
+
+// serverMetrics holds the metrics of the server, exported on the /metrics endpoint
+type serverMetrics struct {
+	registry      *prometheus.Registry
+	rpcDuration   *prometheus.HistogramVec
+	activeStreams *prometheus.GaugeVec
+	// requests of the HTTP gateway, by the RPC behind the endpoint
+	httpDuration   *prometheus.HistogramVec
+	activeRequests *prometheus.GaugeVec
+}
+
+// statusRecorder records the status code of an HTTP response. It passes Flush() on for the Server-Sent Events of
+// the gateway
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+// addressCollector exports the message counters of the bridge by peripheral address, they are read on every scrape.
+// The number of addresses is limited by esbbridge.MaxAddressStats, the further addresses are exported as "other"
+type addressCollector struct {
+	bridge *esbbridge.Bridge
+}
+
+// addressCounter is a counter of esbbridge.AddressStats exported by the addressCollector
+type addressCounter struct {
+	desc  *prometheus.Desc
+	value func(s esbbridge.AddressStats) uint64
+}
+
+var (
+	addressCounters = []addressCounter{
+		{prometheus.NewDesc("esbbridge_transfers_total", "Messages sent with Transfer by peripheral address",
+			[]string{"addr"}, nil),
+			func(s esbbridge.AddressStats) uint64 { return s.Transfers }},
+		{prometheus.NewDesc("esbbridge_sends_total", "Messages sent with Send by peripheral address",
+			[]string{"addr"}, nil),
+			func(s esbbridge.AddressStats) uint64 { return s.Sends }},
+		{prometheus.NewDesc("esbbridge_timeouts_total",
+			"Transfers and sends not answered by the device in time by peripheral address", []string{"addr"}, nil),
+			func(s esbbridge.AddressStats) uint64 { return s.Timeouts }},
+		{prometheus.NewDesc("esbbridge_peer_errors_total",
+			"Transfers and sends failed with a firmware error (e.g. not acknowledged) by peripheral address",
+			[]string{"addr"}, nil),
+			func(s esbbridge.AddressStats) uint64 { return s.PeerErrors }},
+		{prometheus.NewDesc("esbbridge_dropped_messages_total",
+			"Incoming messages dropped for Listen streams which did not keep up by peripheral address",
+			[]string{"addr"}, nil),
+			func(s esbbridge.AddressStats) uint64 { return s.Dropped }},
+	}
+	receivedDesc = prometheus.NewDesc("esbbridge_received_messages_total",
+		"Incoming messages by peripheral address and command", []string{"addr", "cmd"}, nil)
+)
+
+// newMetrics creates the metrics of the server. The counters of the bridge and its USB link are read on every scrape
+func newMetrics(bridge *esbbridge.Bridge) *serverMetrics {
+	r := prometheus.NewRegistry()
+	m := &serverMetrics{
+		registry: r,
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "esbbridge_rpc_duration_seconds",
+			Help: "Duration of the gRPC calls by method and status code",
+		}, []string{"method", "code"}),
+		activeStreams: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "esbbridge_rpc_active_streams",
+			Help: "Number of running streaming gRPC calls (e.g. Listen) by method",
+		}, []string{"method"}),
+	}
+	m.httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "esbbridge_http_duration_seconds",
+		Help: "Duration of the requests of the HTTP gateway by method and HTTP status code",
+	}, []string{"method", "code"})
+	m.activeRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "esbbridge_http_active_requests",
+		Help: "Number of running requests of the HTTP gateway (e.g. Listen) by method",
+	}, []string{"method"})
+	r.MustRegister(m.rpcDuration, m.activeStreams, m.httpDuration, m.activeRequests)
+
+	r.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "esbbridge_device_connected",
+		Help: "1 if the esb-bridge device is connected, 0 otherwise",
+	}, func() float64 {
+		if bridge.State() == esbbridge.StateConnected {
+			return 1
+		}
+		return 0
+	}))
+
+	// USB link, the counters restart when the device is reconnected
+	link := func(name, help string, value func(s esbbridge.LinkStats) uint64) {
+		r.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, func() float64 {
+			return float64(value(bridge.LinkStats()))
+		}))
+	}
+	link("esbbridge_usb_frames_received_total", "Valid frames received from the device",
+		func(s esbbridge.LinkStats) uint64 { return s.FramesIn })
+	link("esbbridge_usb_frames_sent_total", "Frames sent to the device",
+		func(s esbbridge.LinkStats) uint64 { return s.FramesOut })
+	link("esbbridge_usb_resyncs_total", "Resynchronisations of the frame stream received from the device",
+		func(s esbbridge.LinkStats) uint64 { return s.Resyncs })
+	link("esbbridge_usb_crc_errors_total", "Frames with invalid CRC received from the device",
+		func(s esbbridge.LinkStats) uint64 { return s.CRCErrors })
+	link("esbbridge_usb_length_errors_total", "Frames with invalid length received from the device",
+		func(s esbbridge.LinkStats) uint64 { return s.LengthErrors })
+	link("esbbridge_usb_dropped_bytes_total", "Bytes received from the device which were not part of a valid frame",
+		func(s esbbridge.LinkStats) uint64 { return s.DroppedBytes })
+	link("esbbridge_usb_stale_answers_total", "Answers received from the device after their request timed out",
+		func(s esbbridge.LinkStats) uint64 { return s.StaleAnswers })
+
+	// ESB messages by peripheral address
+	r.MustRegister(addressCollector{bridge})
+
+	return m
+}
+
+// handler returns the HTTP handler of the /metrics endpoint
+func (m *serverMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Describe implements prometheus.Collector
+func (c addressCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, counter := range addressCounters {
+		ch <- counter.desc
+	}
+	ch <- receivedDesc
+}
+
+// Collect implements prometheus.Collector
+func (c addressCollector) Collect(ch chan<- prometheus.Metric) {
+	for addr, s := range c.bridge.AddressStats() {
+		c.collect(ch, formatAddress(addr[:]), s)
+	}
+	if s, ok := c.bridge.OtherAddressStats(); ok {
+		c.collect(ch, "other", s)
+	}
+}
+
+// collect sends the counters of one address label
+func (c addressCollector) collect(ch chan<- prometheus.Metric, label string, s esbbridge.AddressStats) {
+	for _, counter := range addressCounters {
+		ch <- prometheus.MustNewConstMetric(counter.desc, prometheus.CounterValue, float64(counter.value(s)), label)
+	}
+	for cmd, n := range s.Received {
+		ch <- prometheus.MustNewConstMetric(receivedDesc, prometheus.CounterValue, float64(n), label,
+			strconv.Itoa(int(cmd)))
+	}
+}
+
+// unaryInterceptor measures the duration of unary RPCs
+func (m *serverMetrics) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	m.observe(info.FullMethod, start, err)
+	return resp, err
+}
+
+// streamInterceptor measures the duration of streaming RPCs and counts the running streams
+func (m *serverMetrics) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	method := methodName(info.FullMethod)
+	active := m.activeStreams.WithLabelValues(method)
+	active.Inc()
+	defer active.Dec()
+
+	start := time.Now()
+	err := handler(srv, ss)
+	m.observe(info.FullMethod, start, err)
+	return err
+}
+
+// httpHandler measures the duration of the requests of a gateway endpoint and counts the running requests. method
+// is the RPC behind the endpoint
+func (m *serverMetrics) httpHandler(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		active := m.activeRequests.WithLabelValues(method)
+		active.Inc()
+		defer active.Dec()
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		h(rec, r)
+		m.httpDuration.WithLabelValues(method, strconv.Itoa(rec.code)).Observe(time.Since(start).Seconds())
+	}
+}
+
+// WriteHeader implements http.ResponseWriter
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush implements http.Flusher
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// observe records the duration of an RPC
+func (m *serverMetrics) observe(fullMethod string, start time.Time, err error) {
+	m.rpcDuration.WithLabelValues(methodName(fullMethod), status.Code(err).String()).Observe(time.Since(start).Seconds())
+}
+
+// methodName returns the method of a full RPC name, e.g. "Transfer" for "/esbbridge.EsbBridge/Transfer"
+func methodName(fullMethod string) string {
+	return fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+}
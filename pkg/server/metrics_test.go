@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// scrape returns the metrics of the server
+func scrape(t *testing.T, s *Server) string {
+	resp, err := http.Get("http://" + s.MetricsAddr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// TestMetrics tests that the metrics endpoint exports the counters of the bridge and the RPCs
+func TestMetrics(t *testing.T) {
+	e := emulator.New()
+	e.AddPeripheral(&emulator.Peripheral{Address: testAddress})
+	s, client := startTestServer(t, e, Config{MetricsListen: "127.0.0.1:0"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	client.Transfer(ctx, &pb.EsbMessage{Addr: testAddress[:], Cmd: []byte{0x10}})
+	client.Transfer(ctx, &pb.EsbMessage{Addr: []byte{9, 9, 9, 9, 9}, Cmd: []byte{0x10}})
+
+	listenCtx, stopListen := context.WithCancel(ctx)
+	stream, err := client.Listen(listenCtx, &pb.Listener{Addr: testAddress[:], Cmd: []byte{0xFF}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the listener is attached asynchronously, repeat the message until it arrives
+	received := make(chan struct{})
+	go func() {
+		for {
+			e.Receive(testAddress, emulator.Message{Cmd: 0x01, Payload: []byte{0xAB}})
+			select {
+			case <-received:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}()
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	close(received)
+
+	metrics := scrape(t, s)
+	for _, line := range []string{
+		"esbbridge_device_connected 1",
+		"esbbridge_usb_frames_sent_total ",
+		`esbbridge_transfers_total{addr="111.111.111.111.1"} 1`,
+		`esbbridge_peer_errors_total{addr="9.9.9.9.9"} 1`,
+		`esbbridge_received_messages_total{addr="111.111.111.111.1",cmd="1"} `,
+		`esbbridge_rpc_duration_seconds_count{code="OK",method="Transfer"} 1`,
+		`esbbridge_rpc_duration_seconds_count{code="Aborted",method="Transfer"} 1`,
+		`esbbridge_rpc_active_streams{method="Listen"} 1`,
+	} {
+		if !strings.Contains(metrics, "\n"+line) {
+			t.Fatalf("Metric %q not found in:\n%v", line, metrics)
+		}
+	}
+
+	stopListen()
+	for i := 0; ; i++ {
+		metrics = scrape(t, s)
+		if strings.Contains(metrics, `esbbridge_rpc_active_streams{method="Listen"} 0`) {
+			break
+		}
+		if i == 20 {
+			t.Fatalf("Listen stream still counted as active:\n%v", metrics)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// TestGatewayMetrics tests that the requests of the HTTP gateway are measured
+func TestGatewayMetrics(t *testing.T) {
+	e := emulator.New()
+	s, _ := startTestServer(t, e, Config{MetricsListen: "127.0.0.1:0", HTTPListen: "127.0.0.1:0"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	url := "http://" + s.HTTPAddr().String()
+
+	httpCall(t, "GET", url+"/info", "", "", nil)
+	httpCall(t, "POST", url+"/transfer", "", `{"addr": "1.2.3"}`, nil)
+
+	metrics := scrape(t, s)
+	for _, line := range []string{
+		`esbbridge_http_duration_seconds_count{code="200",method="GetBridgeInfo"} 1`,
+		`esbbridge_http_duration_seconds_count{code="400",method="Transfer"} 1`,
+		`esbbridge_http_active_requests{method="Transfer"} 0`,
+	} {
+		if !strings.Contains(metrics, "\n"+line) {
+			t.Fatalf("Metric %q not found in:\n%v", line, metrics)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-// Package main implements a simple gRPC server that implements the esbbridge rpc server described in esbbridge_rpc.proto
+// Package server implements the gRPC server of the esbbridge rpc service described in esbbridge_rpc.proto
 package server
 
 import (
@@ -6,64 +6,214 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 
 	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
 	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
 )
 
+// DefaultListen is the listen address of the server if none is configured
+const DefaultListen = ":9815"
+
+// DefaultShutdownTimeout is the time running RPCs get to finish during shutdown, if none is configured
+const DefaultShutdownTimeout = 10 * time.Second
+
+// MaxListenQueueSize limits the queue size a client can request for a Listen stream
+const MaxListenQueueSize = 1024
+
+// Capabilities of the server, GetBridgeInfo reports them in addition to the capabilities of the bridge and its
+// firmware, see esbbridge.BridgeInfo
 const (
-	hostname = "esbbridgeserver"
+	// CapFilter - Listen requests can select messages by address masks, command ranges and payload patterns
+	CapFilter = "filter"
+	// CapSubscribe - the Subscribe RPC serves many filters on one stream, they can be changed while it runs
+	CapSubscribe = "subscribe"
+	// CapSession - the Session RPC exchanges transfers, sends and incoming messages in the order the bridge
+	// received them
+	CapSession = "session"
 )
 
+// capabilities are the features implemented by the server, they don't depend on the firmware of the device
+var capabilities = []string{CapFilter, CapSubscribe, CapSession}
+
+// Config holds the configuration of the esb-bridge RPC server
+type Config struct {
+	// Device is the device string of the esb-bridge device, e.g. "/dev/ttyACM0" or "tcp://raspberrypi:3333"
+	Device string
+	// Listen holds the addresses the server listens on, DefaultListen if empty. Addresses are either "host:port"
+	// (e.g. "localhost:9815", "[::1]:9815" or ":9815" for all interfaces) or Unix domain sockets
+	// (e.g. "unix:///run/esb-bridge.sock")
+	Listen []string
+	// ShutdownTimeout is the time running RPCs get to finish when Run() shuts down the server,
+	// DefaultShutdownTimeout if 0
+	ShutdownTimeout time.Duration
+	// TLSCert and TLSKey are the paths of the PEM encoded certificate and private key of the server. If both are
+	// empty, the server does not use TLS
+	TLSCert string
+	TLSKey  string
+	// TLSClientCA is the path of a PEM encoded CA bundle. If set, clients must authenticate with a certificate
+	// signed by one of these CAs (mutual TLS)
+	TLSClientCA string
+	// Policy authenticates clients and restricts what they may do, see LoadPolicy(). All clients may call all RPCs
+	// if nil
+	Policy *Policy
+	// HTTPListen is the address of the HTTP gateway, which offers the RPCs as JSON API for clients without gRPC
+	// support. Same format as the Listen addresses, the gateway is disabled if empty. TLS and Policy apply as well
+	HTTPListen string
+	// MetricsListen is the address of the /metrics endpoint, which exports counters and latencies of the bridge and
+	// the RPCs in the Prometheus text format. Same format as the Listen addresses, disabled if empty. The endpoint is
+	// served without TLS and Policy, so it should only be reachable from trusted networks
+	MetricsListen string
+	// ListenQueueSize is the number of incoming messages queued for a Listen stream whose client does not keep up,
+	// esbbridge.DefaultListenerQueueSize if 0. Clients can request another size up to MaxListenQueueSize
+	ListenQueueSize int
+	// ListenOverflow decides what happens to incoming messages while the queue of a Listen stream is full,
+	// unless the client requests another policy
+	ListenOverflow esbbridge.OverflowPolicy
+}
+
 type esbBridgeServer struct {
 	pb.UnimplementedEsbBridgeServer
+	bridge          *esbbridge.Bridge
+	stopping        <-chan struct{}           // closed when the server shuts down, ends the Listen streams
+	listenerOptions esbbridge.ListenerOptions // defaults for the Listen streams
+}
+
+// Server is the esb-bridge RPC server. It owns the connection to the esb-bridge device and serves the RPC service
+// on all configured addresses. Create it with New(), then call Run()
+type Server struct {
+	cfg        Config
+	bridge     *esbbridge.Bridge
+	grpcServer *grpc.Server
+	health     *health.Server
+	listeners  []net.Listener
+	httpServer *http.Server // nil if the HTTP gateway is disabled
+	httpLis    net.Listener
+	metrics    *serverMetrics
+	// metricsServer serves the /metrics endpoint, nil if it is disabled
+	metricsServer *http.Server
+	metricsLis    net.Listener
+
+	shutdownOnce sync.Once
+	stopping     chan struct{} // closed when the shutdown begins
+	stopped      chan struct{} // closed when the shutdown is complete
 }
 
-// GetFeature returns the feature at the given point.
+// Transfer sends a message to a peripheral and returns its answer
 func (s *esbBridgeServer) Transfer(ctx context.Context, msg *pb.EsbMessage) (*pb.EsbMessage, error) {
+	if len(msg.Cmd) == 0 {
+		return nil, rpcError(errMissingCmd)
+	}
 
 	txMessage := esbbridge.EsbMessage{Address: msg.Addr, Cmd: msg.Cmd[0], Payload: msg.Payload}
 
 	log.Printf("Transfer Message: %v\n", txMessage)
 
-	answer, err := esbbridge.Transfer(txMessage)
+	answer, err := s.bridge.TransferContext(ctx, txMessage)
 
 	if err != nil {
 		log.Printf("Transfer error: %v", err)
-		return nil, err
+		return nil, rpcError(err)
 	}
 	log.Printf("Answer: %v\n", answer)
-	return &pb.EsbMessage{Addr: msg.Addr, Cmd: []byte{answer.Cmd}, Error: []byte{answer.Error}, Payload: answer.Payload}, nil
+	return messageToProto(answer), nil
+}
+
+// Send sends a message without waiting for a reply
+func (s *esbBridgeServer) Send(ctx context.Context, msg *pb.EsbMessage) (*pb.SendResult, error) {
+	if len(msg.Cmd) == 0 {
+		return nil, rpcError(errMissingCmd)
+	}
+
+	txMessage := esbbridge.EsbMessage{Address: msg.Addr, Cmd: msg.Cmd[0], Payload: msg.Payload}
+
+	log.Printf("Send Message: %v\n", txMessage)
+
+	err := s.bridge.SendContext(ctx, txMessage)
+	if err != nil {
+		log.Printf("Send error: %v", err)
+		return nil, rpcError(err)
+	}
+	return &pb.SendResult{}, nil
+}
+
+// GetBridgeInfo returns information about the esb-bridge device, its firmware and its connection
+func (s *esbBridgeServer) GetBridgeInfo(ctx context.Context, req *pb.BridgeInfoRequest) (*pb.BridgeInfo, error) {
+	info, err := s.bridge.Info()
+	if err != nil {
+		log.Printf("GetBridgeInfo error: %v", err)
+		return nil, rpcError(err)
+	}
+
+	return &pb.BridgeInfo{
+		FwVersion: &pb.FirmwareVersion{
+			Major: uint32(info.FwVersion.Major),
+			Minor: uint32(info.FwVersion.Minor),
+			Patch: uint32(info.FwVersion.Patch)},
+		Device:         info.Device,
+		UptimeSeconds:  uint64(info.Uptime.Seconds()),
+		State:          pb.ConnectionState(info.State), // the enum values match esbbridge.ConnectionState
+		Capabilities:   append(info.Capabilities, capabilities...),
+		MaxPayloadSize: uint32(info.MaxPayloadSize),
+	}, nil
 }
 
 // Listen starts to listen for a specific messages and streams incoming messages to the client
 func (s *esbBridgeServer) Listen(listener *pb.Listener, messageStream pb.EsbBridge_ListenServer) error {
 
-	log.Printf("Attach listener for Address: %v, Command %v", listener.Addr, listener.Cmd)
+	filter, err := listenFilter(listener)
+	if err != nil {
+		return rpcError(err)
+	}
+	log.Printf("Attach listener for %v", filter)
 	streamDone := messageStream.Context().Done()
 
-	listenAddr := [5]byte{}
-	copy(listenAddr[:5], listener.Addr)
-
-	lc := make(chan esbbridge.EsbMessage, 1)
-	esbbridge.AddListener(listenAddr, listener.Cmd[0], lc)
+	opts, err := s.listenOptions(listener)
+	if err != nil {
+		return rpcError(err)
+	}
+	// messages are queued by the bridge, see opts
+	lc := make(chan esbbridge.EsbMessage)
+	sub, err := s.bridge.SubscribeFilter(filter, lc, opts)
+	if err != nil {
+		return rpcError(err)
+	}
+	defer func() {
+		log.Printf("Detach listener for %v", filter)
+		sub.Unsubscribe()
+	}()
 
 listenLoop:
 	for {
 		select {
 		case msg := <-lc:
 			log.Printf("Incoming Message: %v\n", msg)
-			err := messageStream.Send(&pb.EsbMessage{Addr: msg.Address, Cmd: []byte{msg.Cmd}, Payload: msg.Payload})
+			if msg.Dropped > 0 {
+				log.Printf("Listener %v: %v messages dropped, client does not keep up", filter, msg.Dropped)
+			}
+			err := messageStream.Send(messageToProto(msg))
 			if err != nil {
 				return err
 			}
+		case <-sub.Done():
+			log.Printf("Listener %v disconnected, client does not keep up", filter)
+			return status.Error(codes.ResourceExhausted, "listener queue overflow, client does not keep up")
 		case <-streamDone:
-			log.Printf("Listener %v, %v canceled by client", listener.Addr, listener.Cmd)
-			log.Printf("Detach listener for Address: %v, Command %v", listener.Addr, listener.Cmd)
-			esbbridge.RemoveListener(lc)
+			log.Printf("Listener %v canceled by client", filter)
 			break listenLoop
+		case <-s.stopping:
+			log.Printf("Listener %v ended by server shutdown", filter)
+			return status.Error(codes.Unavailable, "server is shutting down")
 		}
 	}
 
@@ -72,45 +222,370 @@ listenLoop:
 	return nil
 }
 
-func newServer() *esbBridgeServer {
-	s := &esbBridgeServer{}
+// listenOptions returns the queue options of a Listen stream, the defaults of the server overridden by the request
+func (s *esbBridgeServer) listenOptions(listener *pb.Listener) (esbbridge.ListenerOptions, error) {
+	opts := s.listenerOptions
+	if listener.QueueSize > MaxListenQueueSize {
+		return opts, fmt.Errorf("%w: queue size %v exceeds maximum %v", esbbridge.ErrInvalidParam,
+			listener.QueueSize, MaxListenQueueSize)
+	}
+	if listener.QueueSize > 0 {
+		opts.QueueSize = int(listener.QueueSize)
+	}
+
+	switch listener.Overflow {
+	case pb.OverflowPolicy_OVERFLOW_DEFAULT:
+	case pb.OverflowPolicy_OVERFLOW_DROP_OLDEST:
+		opts.Overflow = esbbridge.DropOldest
+	case pb.OverflowPolicy_OVERFLOW_DROP_NEWEST:
+		opts.Overflow = esbbridge.DropNewest
+	case pb.OverflowPolicy_OVERFLOW_DISCONNECT:
+		opts.Overflow = esbbridge.Disconnect
+	default:
+		return opts, fmt.Errorf("%w: unknown overflow policy %v", esbbridge.ErrInvalidParam, listener.Overflow)
+	}
+	return opts, nil
+}
+
+// messageToProto converts an answer or an incoming message
+func messageToProto(msg esbbridge.EsbMessage) *pb.EsbMessage {
+	m := &pb.EsbMessage{Addr: msg.Address, Cmd: []byte{msg.Cmd}, Error: []byte{msg.Error}, Payload: msg.Payload,
+		Dropped: msg.Dropped, Seq: msg.Seq}
+	if !msg.Timestamp.IsZero() {
+		m.TimeUnixNano = msg.Timestamp.UnixNano()
+	}
+	if msg.Radio != nil {
+		m.Radio = &pb.RadioInfo{Pipe: uint32(msg.Radio.Pipe), Rssi: int32(msg.Radio.RSSI),
+			Retransmits: uint32(msg.Radio.Retransmits)}
+	}
+	return m
+}
+
+// NewService creates the esb-bridge RPC service for an opened bridge. It can be registered on any grpc.Server
+// with pb.RegisterEsbBridgeServer()
+func NewService(bridge *esbbridge.Bridge) pb.EsbBridgeServer {
+	s := &esbBridgeServer{bridge: bridge}
 	return s
 }
 
-// Start starts the esb-bridge RPC server in a goroutine. To cancel the execution,
-// call the returned cancel function
-// Params:
-//   device: device string to connect to (e.g. /dev/ttyACM0)
-//   port: TCP port for the RPC server
-func Start(device string, port uint) (context.CancelFunc, error) {
+// New opens the esb-bridge device and the listeners of the server. Call Run() to start serving
+func New(cfg Config) (*Server, error) {
 
-	err := esbbridge.Open(device)
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		log.Printf("TLS setup failed: %v", err)
+		return nil, err
+	}
+	if cfg.ListenQueueSize < 0 || cfg.ListenQueueSize > MaxListenQueueSize {
+		err := fmt.Errorf("%w: listen queue size %v, maximum is %v", esbbridge.ErrInvalidParam, cfg.ListenQueueSize,
+			MaxListenQueueSize)
+		log.Printf("Invalid configuration: %v", err)
+		return nil, err
+	}
+	if cfg.ListenOverflow < esbbridge.DropOldest || cfg.ListenOverflow > esbbridge.Disconnect {
+		err := fmt.Errorf("%w: unknown overflow policy %v", esbbridge.ErrInvalidParam, cfg.ListenOverflow)
+		log.Printf("Invalid configuration: %v", err)
+		return nil, err
+	}
+	if cfg.Policy != nil {
+		if err := cfg.Policy.compile(); err != nil {
+			log.Printf("Invalid policy: %v", err)
+			return nil, err
+		}
+	}
+
+	addresses := cfg.Listen
+	if len(addresses) == 0 {
+		addresses = []string{DefaultListen}
+	}
+
+	var listeners []net.Listener
+	for _, address := range addresses {
+		lis, err := listen(address)
+		if err != nil {
+			log.Printf("failed to listen: %v", err)
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, lis)
+	}
+	var httpLis net.Listener
+	if cfg.HTTPListen != "" {
+		httpLis, err = listen(cfg.HTTPListen)
+		if err != nil {
+			log.Printf("failed to listen: %v", err)
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, httpLis)
+	}
+	var metricsLis net.Listener
+	if cfg.MetricsListen != "" {
+		metricsLis, err = listen(cfg.MetricsListen)
+		if err != nil {
+			log.Printf("failed to listen: %v", err)
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, metricsLis)
+	}
+
+	bridge := &esbbridge.Bridge{}
+	err = bridge.Open(cfg.Device)
 	if err != nil {
 		log.Printf("Could not open connection to esb-bridge device: %v", err)
+		closeListeners(listeners)
 		return nil, err
 	}
-	fwVersion, err := esbbridge.GetFwVersion()
+	// the firmware version was read by Open()
+	info, err := bridge.Info()
 	if err != nil {
 		log.Printf("Error reading Firmware version of esb-bridge device: %v", err)
+		bridge.Close()
+		closeListeners(listeners)
 		return nil, err
 	}
-	log.Printf("esb-bridge firmware version: %v", fwVersion)
+	log.Printf("esb-bridge firmware version: %v", info.FwVersion)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	go func(context.Context) {
-		defer esbbridge.Close()
+	s := &Server{
+		cfg:       cfg,
+		bridge:    bridge,
+		listeners: listeners,
+		stopping:  make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	// the HTTP listeners are served separately
+	if metricsLis != nil {
+		s.listeners = s.listeners[:len(s.listeners)-1]
+		s.metricsLis = metricsLis
+	}
+	if httpLis != nil {
+		s.listeners = s.listeners[:len(s.listeners)-1]
+		s.httpLis = httpLis
+	}
 
-		lis, err := net.Listen("tcp", fmt.Sprintf("%v:%v", hostname, port))
-		if err != nil {
-			log.Fatalf("failed to listen: %v", err)
+	s.metrics = newMetrics(bridge)
+
+	// the metrics interceptors come first, so calls rejected by the policy are measured as well
+	unaryInterceptors := []grpc.UnaryServerInterceptor{s.metrics.unaryInterceptor}
+	streamInterceptors := []grpc.StreamServerInterceptor{s.metrics.streamInterceptor}
+
+	var opts []grpc.ServerOption
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+		if cfg.TLSClientCA != "" {
+			log.Printf("TLS enabled, client certificates required")
+		} else {
+			log.Printf("TLS enabled")
+		}
+	}
+	if cfg.Policy != nil {
+		unaryInterceptors = append(unaryInterceptors, cfg.Policy.unaryInterceptor)
+		streamInterceptors = append(streamInterceptors, cfg.Policy.streamInterceptor)
+		if tlsCfg == nil {
+			log.Printf("Warning: access policy without TLS, tokens are sent unencrypted")
 		}
-		var opts []grpc.ServerOption
+	}
+
+	opts = append(opts, grpc.ChainUnaryInterceptor(unaryInterceptors...))
+	opts = append(opts, grpc.ChainStreamInterceptor(streamInterceptors...))
+
+	service := &esbBridgeServer{bridge: bridge, stopping: s.stopping, listenerOptions: esbbridge.ListenerOptions{
+		QueueSize: cfg.ListenQueueSize,
+		Overflow:  cfg.ListenOverflow,
+	}}
+	s.grpcServer = grpc.NewServer(opts...)
+	pb.RegisterEsbBridgeServer(s.grpcServer, service)
+	s.health = newHealthServer(bridge, s.stopped)
+	healthpb.RegisterHealthServer(s.grpcServer, s.health)
+	reflection.Register(s.grpcServer)
+
+	if httpLis != nil {
+		s.httpServer = &http.Server{Handler: newGateway(service, cfg.Policy, s.metrics), TLSConfig: tlsCfg}
+	}
+	if metricsLis != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", s.metrics.handler())
+		s.metricsServer = &http.Server{Handler: mux}
+	}
 
-		log.Printf("Serving on port %v\n", port)
-		grpcServer := grpc.NewServer(opts...)
-		pb.RegisterEsbBridgeServer(grpcServer, newServer())
-		grpcServer.Serve(lis)
-	}(ctx)
+	states := make(chan esbbridge.StateEvent, 10)
+	bridge.AddStateListener(states)
+	go logStateEvents(s.stopped, states)
+
+	return s, nil
+}
+
+// Run serves the RPC service on all listeners until ctx is done, Shutdown() is called or a listener fails.
+// Then the server is shut down, running RPCs get ShutdownTimeout to finish. Returns nil after a regular shutdown
+func (s *Server) Run(ctx context.Context) error {
+	serveErr := make(chan error, len(s.listeners)+2)
+	for _, lis := range s.listeners {
+		log.Printf("Serving on %v\n", lis.Addr())
+		go func(lis net.Listener) {
+			serveErr <- s.grpcServer.Serve(lis)
+		}(lis)
+	}
+	if s.httpServer != nil {
+		log.Printf("Serving HTTP gateway on %v\n", s.httpLis.Addr())
+		go serveHTTP(s.httpServer, s.httpLis, serveErr)
+	}
+	if s.metricsServer != nil {
+		log.Printf("Serving metrics on %v\n", s.metricsLis.Addr())
+		go serveHTTP(s.metricsServer, s.metricsLis, serveErr)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case <-s.stopping:
+	case err = <-serveErr:
+		log.Printf("Serve error: %v", err)
+	}
+
+	timeout := s.cfg.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if shutdownErr := s.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+// HTTPAddr returns the address of the HTTP gateway, nil if it is disabled
+func (s *Server) HTTPAddr() net.Addr {
+	if s.httpLis == nil {
+		return nil
+	}
+	return s.httpLis.Addr()
+}
+
+// MetricsAddr returns the address of the /metrics endpoint, nil if it is disabled
+func (s *Server) MetricsAddr() net.Addr {
+	if s.metricsLis == nil {
+		return nil
+	}
+	return s.metricsLis.Addr()
+}
+
+// Addrs returns the addresses the gRPC server listens on
+func (s *Server) Addrs() []net.Addr {
+	addrs := make([]net.Addr, 0, len(s.listeners))
+	for _, lis := range s.listeners {
+		addrs = append(addrs, lis.Addr())
+	}
+	return addrs
+}
+
+// Shutdown stops the server gracefully: no new RPCs are accepted, Listen streams are ended with status
+// UNAVAILABLE and running RPCs like Transfer are awaited. If ctx is done before, the remaining RPCs are canceled.
+// Finally the esb-bridge device is closed, after the transfers still running on it failed
+func (s *Server) Shutdown(ctx context.Context) error {
+	first := false
+	s.shutdownOnce.Do(func() {
+		first = true
+		close(s.stopping)
+	})
+	if !first {
+		// shutdown already in progress
+		select {
+		case <-s.stopped:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer close(s.stopped)
+
+	log.Printf("Shutting down")
+	// health checks report NOT_SERVING from now on, so probes and load balancers stop sending new clients
+	s.health.Shutdown()
+
+	graceful := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(graceful)
+	}()
+
+	var err error
+	if s.httpServer != nil {
+		// returns early if ctx is done, then the remaining connections are closed below
+		err = s.httpServer.Shutdown(ctx)
+	}
+	if s.metricsServer != nil {
+		// scrapes are short, no need to wait for them
+		s.metricsServer.Close()
+	}
+
+	select {
+	case <-graceful:
+	case <-ctx.Done():
+		log.Printf("Shutdown timeout, canceling running RPCs")
+		s.grpcServer.Stop()
+		err = ctx.Err()
+	}
+	if s.httpServer != nil && err != nil {
+		s.httpServer.Close()
+	}
+
+	// canceled handlers may still be running a transfer, Close() lets it fail and waits for it
+	s.bridge.Close()
+
+	return err
+}
+
+// Start starts the esb-bridge RPC server in a goroutine. To stop the server, call the returned cancel function
+// Params:
+//   cfg: device to connect to and addresses to listen on
+func Start(cfg Config) (context.CancelFunc, error) {
+	s, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Run(ctx)
 
 	return cancel, nil
 }
+
+// logStateEvents logs the connection state changes of the bridge until done is closed
+func logStateEvents(done <-chan struct{}, states <-chan esbbridge.StateEvent) {
+	for {
+		select {
+		case ev := <-states:
+			if ev.Err != nil {
+				log.Printf("esb-bridge device %v: %v", ev.State, ev.Err)
+			} else {
+				log.Printf("esb-bridge device %v", ev.State)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// serveHTTP serves an HTTP server on a listener, with TLS if the server has a TLS config.
+// Errors other than http.ErrServerClosed are sent on serveErr
+func serveHTTP(srv *http.Server, lis net.Listener, serveErr chan<- error) {
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ServeTLS(lis, "", "")
+	} else {
+		err = srv.Serve(lis)
+	}
+	if err != http.ErrServerClosed {
+		serveErr <- err
+	}
+}
+
+// closeListeners closes all listeners
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+var testAddress = [emulator.AddressSize]byte{111, 111, 111, 111, 1}
+
+// startTestServer starts a server connected to an emulated device behind a TCP socket and returns a client for it.
+// Device and Listen of cfg are set by the function. The connection is insecure if no dial options are given
+func startTestServer(t *testing.T, e *emulator.Emulator, cfg Config, opts ...grpc.DialOption) (*Server, pb.EsbBridgeClient) {
+	device, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { device.Close() })
+	go e.ServeListener(device)
+
+	cfg.Device = "tcp://" + device.Addr().String()
+	cfg.Listen = []string{"127.0.0.1:0"}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(opts) == 0 {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	conn, err := grpc.Dial(s.Addrs()[0].String(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return s, pb.NewEsbBridgeClient(conn)
+}
+
+// TestGetBridgeInfo tests that the capabilities of the server are reported together with those of the bridge
+func TestGetBridgeInfo(t *testing.T) {
+	s, client := startTestServer(t, emulator.New(), Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	info, err := client.GetBridgeInfo(context.Background(), &pb.BridgeInfoRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	capabilities := make(map[string]bool)
+	for _, c := range info.Capabilities {
+		capabilities[c] = true
+	}
+	for _, c := range []string{esbbridge.CapTransfer, esbbridge.CapListen, CapFilter, CapSubscribe, CapSession} {
+		if !capabilities[c] {
+			t.Fatalf("Capability %v missing: %v", c, info.Capabilities)
+		}
+	}
+}
+
+// TestShutdown tests that a shutdown ends Listen streams and waits for running transfers
+func TestShutdown(t *testing.T) {
+	e := emulator.New()
+	e.AddPeripheral(&emulator.Peripheral{Address: testAddress})
+	e.Latency = 300 * time.Millisecond
+	s, client := startTestServer(t, e, Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(ctx)
+	}()
+
+	stream, err := client.Listen(context.Background(), &pb.Listener{Addr: testAddress[:], Cmd: []byte{0xFF}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the listener is attached asynchronously, repeat the message until it arrives
+	received := make(chan struct{})
+	go func() {
+		for {
+			e.Receive(testAddress, emulator.Message{Cmd: 0x01})
+			select {
+			case <-received:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}()
+	_, err = stream.Recv()
+	close(received)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a transfer which is still running when the shutdown begins
+	transferErr := make(chan error, 1)
+	go func() {
+		_, err := client.Transfer(context.Background(), &pb.EsbMessage{Addr: testAddress[:], Cmd: []byte{0x10}})
+		transferErr <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+
+	// skip repeated messages which were still in flight
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Listen stream should end with status UNAVAILABLE, got %v", err)
+	}
+	if err := <-transferErr; err != nil {
+		t.Fatalf("Running transfer should be finished before the shutdown, got %v", err)
+	}
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("Run() should return nil after a regular shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout, Run() did not return")
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Repeated Shutdown() should return nil, got %v", err)
+	}
+}
+
+// TestShutdownTimeout tests that a shutdown whose timeout expires cancels the running transfers before the device
+// is closed
+func TestShutdownTimeout(t *testing.T) {
+	e := emulator.New()
+	e.AddPeripheral(&emulator.Peripheral{Address: testAddress})
+	s, client := startTestServer(t, e, Config{})
+	go s.Run(context.Background())
+
+	e.Latency = 500 * time.Millisecond
+	transferErr := make(chan error, 10)
+	for i := 0; i < cap(transferErr); i++ {
+		go func() {
+			_, err := client.Transfer(context.Background(), &pb.EsbMessage{Addr: testAddress[:], Cmd: []byte{0x10}})
+			transferErr <- err
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	for i := 0; i < cap(transferErr); i++ {
+		if err := <-transferErr; err == nil {
+			t.Fatalf("Transfer should be canceled by the shutdown")
+		}
+	}
+}
+
+// blockingStream is a Listen stream whose Send blocks until release is closed, like a client which does not keep up
+type blockingStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	release chan struct{}
+	sent    chan *pb.EsbMessage
+}
+
+func (s *blockingStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *blockingStream) Send(msg *pb.EsbMessage) error {
+	<-s.release
+	s.sent <- msg
+	return nil
+}
+
+// TestListenOverflow tests the overflow policies of Listen streams whose client does not keep up
+func TestListenOverflow(t *testing.T) {
+	e := emulator.New()
+	s, client := startTestServer(t, e, Config{})
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go s.Run(runCtx)
+
+	stream, err := client.Listen(runCtx, &pb.Listener{Addr: testAddress[:], Cmd: []byte{0xFF},
+		QueueSize: MaxListenQueueSize + 1})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Listen with a too large queue should fail with InvalidArgument, got %v", err)
+	}
+
+	for _, overflow := range []pb.OverflowPolicy{pb.OverflowPolicy_OVERFLOW_DISCONNECT, pb.OverflowPolicy_OVERFLOW_DROP_OLDEST} {
+		service := &esbBridgeServer{bridge: s.bridge, stopping: s.stopping}
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := &blockingStream{ctx: ctx, release: make(chan struct{}), sent: make(chan *pb.EsbMessage, 100)}
+		listenErr := make(chan error, 1)
+		go func() {
+			listenErr <- service.Listen(&pb.Listener{Addr: testAddress[:], Cmd: []byte{0xFF}, QueueSize: 1,
+				Overflow: overflow}, stream)
+		}()
+
+		// send messages until the queue overflows, then let the stream continue
+		dropped := s.bridge.AddressStats()[testAddress].Dropped
+		for s.bridge.AddressStats()[testAddress].Dropped == dropped {
+			e.Receive(testAddress, emulator.Message{Cmd: 0x01})
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(stream.release)
+
+		if overflow == pb.OverflowPolicy_OVERFLOW_DISCONNECT {
+			if err := <-listenErr; status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("Listen should end with ResourceExhausted, got %v", err)
+			}
+		} else {
+			for msg := range stream.sent {
+				if msg.Dropped > 0 {
+					break
+				}
+			}
+			cancel()
+			if err := <-listenErr; err != nil {
+				t.Fatalf("Listen should end without error, got %v", err)
+			}
+		}
+		cancel()
+	}
+}
@@ -25,33 +25,1281 @@ const (
 // of the legacy proto package is being used.
 const _ = proto.ProtoPackageIsVersion4
 
+// OverflowPolicy decides what happens to incoming messages for a listening client which does not keep up
+type OverflowPolicy int32
+
+const (
+	// the default policy of the server
+	OverflowPolicy_OVERFLOW_DEFAULT OverflowPolicy = 0
+	// the oldest queued message is dropped
+	OverflowPolicy_OVERFLOW_DROP_OLDEST OverflowPolicy = 1
+	// the incoming message is dropped
+	OverflowPolicy_OVERFLOW_DROP_NEWEST OverflowPolicy = 2
+	// the stream is ended with status RESOURCE_EXHAUSTED
+	OverflowPolicy_OVERFLOW_DISCONNECT OverflowPolicy = 3
+)
+
+// Enum value maps for OverflowPolicy.
+var (
+	OverflowPolicy_name = map[int32]string{
+		0: "OVERFLOW_DEFAULT",
+		1: "OVERFLOW_DROP_OLDEST",
+		2: "OVERFLOW_DROP_NEWEST",
+		3: "OVERFLOW_DISCONNECT",
+	}
+	OverflowPolicy_value = map[string]int32{
+		"OVERFLOW_DEFAULT":     0,
+		"OVERFLOW_DROP_OLDEST": 1,
+		"OVERFLOW_DROP_NEWEST": 2,
+		"OVERFLOW_DISCONNECT":  3,
+	}
+)
+
+func (x OverflowPolicy) Enum() *OverflowPolicy {
+	p := new(OverflowPolicy)
+	*p = x
+	return p
+}
+
+func (x OverflowPolicy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (OverflowPolicy) Descriptor() protoreflect.EnumDescriptor {
+	return file_pkg_server_service_esbbridge_rpc_proto_enumTypes[0].Descriptor()
+}
+
+func (OverflowPolicy) Type() protoreflect.EnumType {
+	return &file_pkg_server_service_esbbridge_rpc_proto_enumTypes[0]
+}
+
+func (x OverflowPolicy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use OverflowPolicy.Descriptor instead.
+func (OverflowPolicy) EnumDescriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{0}
+}
+
+// ConnectionState is the state of the connection between server and esb-bridge device
+type ConnectionState int32
+
+const (
+	ConnectionState_DISCONNECTED ConnectionState = 0
+	ConnectionState_CONNECTED    ConnectionState = 1
+	ConnectionState_RECONNECTING ConnectionState = 2
+)
+
+// Enum value maps for ConnectionState.
+var (
+	ConnectionState_name = map[int32]string{
+		0: "DISCONNECTED",
+		1: "CONNECTED",
+		2: "RECONNECTING",
+	}
+	ConnectionState_value = map[string]int32{
+		"DISCONNECTED": 0,
+		"CONNECTED":    1,
+		"RECONNECTING": 2,
+	}
+)
+
+func (x ConnectionState) Enum() *ConnectionState {
+	p := new(ConnectionState)
+	*p = x
+	return p
+}
+
+func (x ConnectionState) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ConnectionState) Descriptor() protoreflect.EnumDescriptor {
+	return file_pkg_server_service_esbbridge_rpc_proto_enumTypes[1].Descriptor()
+}
+
+func (ConnectionState) Type() protoreflect.EnumType {
+	return &file_pkg_server_service_esbbridge_rpc_proto_enumTypes[1]
+}
+
+func (x ConnectionState) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ConnectionState.Descriptor instead.
+func (ConnectionState) EnumDescriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{1}
+}
+
+// ErrorReason identifies the esb-bridge error behind a failed RPC
+type ErrorReason int32
+
+const (
+	ErrorReason_ERR_UNKNOWN           ErrorReason = 0
+	ErrorReason_ERR_NOT_CONNECTED     ErrorReason = 1
+	ErrorReason_ERR_UNAVAILABLE       ErrorReason = 2
+	ErrorReason_ERR_TIMEOUT           ErrorReason = 3
+	ErrorReason_ERR_PAYLOAD_TOO_LARGE ErrorReason = 4
+	ErrorReason_ERR_INVALID_PARAM     ErrorReason = 5
+	// the firmware answered with an error code, see fw_cmd and fw_code
+	ErrorReason_ERR_FIRMWARE ErrorReason = 6
+	// the device sent an answer which does not match the USB protocol
+	ErrorReason_ERR_PROTOCOL ErrorReason = 7
+)
+
+// Enum value maps for ErrorReason.
+var (
+	ErrorReason_name = map[int32]string{
+		0: "ERR_UNKNOWN",
+		1: "ERR_NOT_CONNECTED",
+		2: "ERR_UNAVAILABLE",
+		3: "ERR_TIMEOUT",
+		4: "ERR_PAYLOAD_TOO_LARGE",
+		5: "ERR_INVALID_PARAM",
+		6: "ERR_FIRMWARE",
+		7: "ERR_PROTOCOL",
+	}
+	ErrorReason_value = map[string]int32{
+		"ERR_UNKNOWN":           0,
+		"ERR_NOT_CONNECTED":     1,
+		"ERR_UNAVAILABLE":       2,
+		"ERR_TIMEOUT":           3,
+		"ERR_PAYLOAD_TOO_LARGE": 4,
+		"ERR_INVALID_PARAM":     5,
+		"ERR_FIRMWARE":          6,
+		"ERR_PROTOCOL":          7,
+	}
+)
+
+func (x ErrorReason) Enum() *ErrorReason {
+	p := new(ErrorReason)
+	*p = x
+	return p
+}
+
+func (x ErrorReason) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ErrorReason) Descriptor() protoreflect.EnumDescriptor {
+	return file_pkg_server_service_esbbridge_rpc_proto_enumTypes[2].Descriptor()
+}
+
+func (ErrorReason) Type() protoreflect.EnumType {
+	return &file_pkg_server_service_esbbridge_rpc_proto_enumTypes[2]
+}
+
+func (x ErrorReason) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ErrorReason.Descriptor instead.
+func (ErrorReason) EnumDescriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{2}
+}
+
 // Listener holds all information to listen for a specific package
 type Listener struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Addr []byte `protobuf:"bytes,1,opt,name=addr,proto3" json:"addr,omitempty"`
-	Cmd  []byte `protobuf:"bytes,2,opt,name=cmd,proto3" json:"cmd,omitempty"`
+	Addr []byte `protobuf:"bytes,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	Cmd  []byte `protobuf:"bytes,2,opt,name=cmd,proto3" json:"cmd,omitempty"`
+	// number of messages queued for the client if it does not keep up, the default of the server if 0
+	QueueSize uint32 `protobuf:"varint,3,opt,name=queue_size,json=queueSize,proto3" json:"queue_size,omitempty"`
+	// what happens to incoming messages while the queue is full
+	Overflow OverflowPolicy `protobuf:"varint,4,opt,name=overflow,proto3,enum=server.OverflowPolicy" json:"overflow,omitempty"`
+	// selects the messages if set, addr and cmd are ignored then
+	Filter *Filter `protobuf:"bytes,5,opt,name=filter,proto3" json:"filter,omitempty"`
+}
+
+func (x *Listener) Reset() {
+	*x = Listener{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Listener) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Listener) ProtoMessage() {}
+
+func (x *Listener) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Listener.ProtoReflect.Descriptor instead.
+func (*Listener) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Listener) GetAddr() []byte {
+	if x != nil {
+		return x.Addr
+	}
+	return nil
+}
+
+func (x *Listener) GetCmd() []byte {
+	if x != nil {
+		return x.Cmd
+	}
+	return nil
+}
+
+func (x *Listener) GetQueueSize() uint32 {
+	if x != nil {
+		return x.QueueSize
+	}
+	return 0
+}
+
+func (x *Listener) GetOverflow() OverflowPolicy {
+	if x != nil {
+		return x.Overflow
+	}
+	return OverflowPolicy_OVERFLOW_DEFAULT
+}
+
+func (x *Listener) GetFilter() *Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+// Filter selects incoming messages. A message matches if it matches all criteria and none of the exclude filters
+type Filter struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the address bits set in addr_mask must be equal to the bits of addr, all addresses match if addr_mask is empty
+	Addr     []byte `protobuf:"bytes,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	AddrMask []byte `protobuf:"bytes,2,opt,name=addr_mask,json=addrMask,proto3" json:"addr_mask,omitempty"`
+	// the matching command IDs, all commands match if empty
+	Cmds []*CmdRange `protobuf:"bytes,3,rep,name=cmds,proto3" json:"cmds,omitempty"`
+	// patterns which must all match the payload
+	Payload []*PayloadMatch `protobuf:"bytes,4,rep,name=payload,proto3" json:"payload,omitempty"`
+	Exclude []*Filter       `protobuf:"bytes,5,rep,name=exclude,proto3" json:"exclude,omitempty"`
+}
+
+func (x *Filter) Reset() {
+	*x = Filter{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Filter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Filter) ProtoMessage() {}
+
+func (x *Filter) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Filter.ProtoReflect.Descriptor instead.
+func (*Filter) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Filter) GetAddr() []byte {
+	if x != nil {
+		return x.Addr
+	}
+	return nil
+}
+
+func (x *Filter) GetAddrMask() []byte {
+	if x != nil {
+		return x.AddrMask
+	}
+	return nil
+}
+
+func (x *Filter) GetCmds() []*CmdRange {
+	if x != nil {
+		return x.Cmds
+	}
+	return nil
+}
+
+func (x *Filter) GetPayload() []*PayloadMatch {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Filter) GetExclude() []*Filter {
+	if x != nil {
+		return x.Exclude
+	}
+	return nil
+}
+
+// CmdRange is a range of command IDs, first and last are included
+type CmdRange struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	First uint32 `protobuf:"varint,1,opt,name=first,proto3" json:"first,omitempty"`
+	Last  uint32 `protobuf:"varint,2,opt,name=last,proto3" json:"last,omitempty"`
+}
+
+func (x *CmdRange) Reset() {
+	*x = CmdRange{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CmdRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CmdRange) ProtoMessage() {}
+
+func (x *CmdRange) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CmdRange.ProtoReflect.Descriptor instead.
+func (*CmdRange) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CmdRange) GetFirst() uint32 {
+	if x != nil {
+		return x.First
+	}
+	return 0
+}
+
+func (x *CmdRange) GetLast() uint32 {
+	if x != nil {
+		return x.Last
+	}
+	return 0
+}
+
+// PayloadMatch is a byte pattern at an offset of the payload, only the bits set in mask are compared if it is not empty
+type PayloadMatch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Offset uint32 `protobuf:"varint,1,opt,name=offset,proto3" json:"offset,omitempty"`
+	Value  []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Mask   []byte `protobuf:"bytes,3,opt,name=mask,proto3" json:"mask,omitempty"`
+}
+
+func (x *PayloadMatch) Reset() {
+	*x = PayloadMatch{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PayloadMatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PayloadMatch) ProtoMessage() {}
+
+func (x *PayloadMatch) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PayloadMatch.ProtoReflect.Descriptor instead.
+func (*PayloadMatch) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PayloadMatch) GetOffset() uint32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *PayloadMatch) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *PayloadMatch) GetMask() []byte {
+	if x != nil {
+		return x.Mask
+	}
+	return nil
+}
+
+// SubscribeRequest adds or removes a subscription of a Subscribe stream
+type SubscribeRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Request:
+	//	*SubscribeRequest_Add
+	//	*SubscribeRequest_Remove
+	Request isSubscribeRequest_Request `protobuf_oneof:"request"`
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{4}
+}
+
+func (m *SubscribeRequest) GetRequest() isSubscribeRequest_Request {
+	if m != nil {
+		return m.Request
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetAdd() *Subscription {
+	if x, ok := x.GetRequest().(*SubscribeRequest_Add); ok {
+		return x.Add
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetRemove() uint32 {
+	if x, ok := x.GetRequest().(*SubscribeRequest_Remove); ok {
+		return x.Remove
+	}
+	return 0
+}
+
+type isSubscribeRequest_Request interface {
+	isSubscribeRequest_Request()
+}
+
+type SubscribeRequest_Add struct {
+	// adds a subscription, its id is chosen by the client and must not be in use on the stream
+	Add *Subscription `protobuf:"bytes,1,opt,name=add,proto3,oneof"`
+}
+
+type SubscribeRequest_Remove struct {
+	// removes the subscription with this id
+	Remove uint32 `protobuf:"varint,2,opt,name=remove,proto3,oneof"`
+}
+
+func (*SubscribeRequest_Add) isSubscribeRequest_Request() {}
+
+func (*SubscribeRequest_Remove) isSubscribeRequest_Request() {}
+
+// Subscription selects incoming messages for a Subscribe stream
+type Subscription struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id uint32 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// all messages match if not set
+	Filter *Filter `protobuf:"bytes,2,opt,name=filter,proto3" json:"filter,omitempty"`
+}
+
+func (x *Subscription) Reset() {
+	*x = Subscription{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Subscription) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Subscription) ProtoMessage() {}
+
+func (x *Subscription) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Subscription.ProtoReflect.Descriptor instead.
+func (*Subscription) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Subscription) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Subscription) GetFilter() *Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+// SubscribedMessage is an incoming message of a Subscribe stream
+type SubscribedMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message *EsbMessage `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// the subscriptions matching the message
+	SubscriptionIds []uint32 `protobuf:"varint,2,rep,packed,name=subscription_ids,json=subscriptionIds,proto3" json:"subscription_ids,omitempty"`
+}
+
+func (x *SubscribedMessage) Reset() {
+	*x = SubscribedMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubscribedMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribedMessage) ProtoMessage() {}
+
+func (x *SubscribedMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribedMessage.ProtoReflect.Descriptor instead.
+func (*SubscribedMessage) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SubscribedMessage) GetMessage() *EsbMessage {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *SubscribedMessage) GetSubscriptionIds() []uint32 {
+	if x != nil {
+		return x.SubscriptionIds
+	}
+	return nil
+}
+
+// SessionRequest is a request of a Session stream
+type SessionRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// chosen by the client, the event answering the request has the same id
+	Id uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Types that are assignable to Request:
+	//	*SessionRequest_Transfer
+	//	*SessionRequest_Send
+	//	*SessionRequest_Listen
+	Request isSessionRequest_Request `protobuf_oneof:"request"`
+}
+
+func (x *SessionRequest) Reset() {
+	*x = SessionRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionRequest) ProtoMessage() {}
+
+func (x *SessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionRequest.ProtoReflect.Descriptor instead.
+func (*SessionRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SessionRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (m *SessionRequest) GetRequest() isSessionRequest_Request {
+	if m != nil {
+		return m.Request
+	}
+	return nil
+}
+
+func (x *SessionRequest) GetTransfer() *EsbMessage {
+	if x, ok := x.GetRequest().(*SessionRequest_Transfer); ok {
+		return x.Transfer
+	}
+	return nil
+}
+
+func (x *SessionRequest) GetSend() *EsbMessage {
+	if x, ok := x.GetRequest().(*SessionRequest_Send); ok {
+		return x.Send
+	}
+	return nil
+}
+
+func (x *SessionRequest) GetListen() *SessionFilters {
+	if x, ok := x.GetRequest().(*SessionRequest_Listen); ok {
+		return x.Listen
+	}
+	return nil
+}
+
+type isSessionRequest_Request interface {
+	isSessionRequest_Request()
+}
+
+type SessionRequest_Transfer struct {
+	// transfers the message, answered with an answer event
+	Transfer *EsbMessage `protobuf:"bytes,2,opt,name=transfer,proto3,oneof"`
+}
+
+type SessionRequest_Send struct {
+	// sends the message, answered with a sent event
+	Send *EsbMessage `protobuf:"bytes,3,opt,name=send,proto3,oneof"`
+}
+
+type SessionRequest_Listen struct {
+	// replaces the filters of the incoming messages, no messages are received without filters
+	Listen *SessionFilters `protobuf:"bytes,4,opt,name=listen,proto3,oneof"`
+}
+
+func (*SessionRequest_Transfer) isSessionRequest_Request() {}
+
+func (*SessionRequest_Send) isSessionRequest_Request() {}
+
+func (*SessionRequest_Listen) isSessionRequest_Request() {}
+
+// SessionFilters are the filters of the incoming messages of a Session stream
+type SessionFilters struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Filters []*Filter `protobuf:"bytes,1,rep,name=filters,proto3" json:"filters,omitempty"`
+}
+
+func (x *SessionFilters) Reset() {
+	*x = SessionFilters{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SessionFilters) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionFilters) ProtoMessage() {}
+
+func (x *SessionFilters) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionFilters.ProtoReflect.Descriptor instead.
+func (*SessionFilters) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SessionFilters) GetFilters() []*Filter {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+// SessionEvent is an answer, an acknowledgement, a failed request or an incoming message of a Session stream
+type SessionEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// numbers the messages received by the esb-bridge device in the order of their arrival
+	Seq uint64 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	// time of arrival on the server, in nanoseconds since the Unix epoch
+	TimeUnixNano int64 `protobuf:"varint,2,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	// id of the request, 0 for incoming messages
+	Id uint64 `protobuf:"varint,3,opt,name=id,proto3" json:"id,omitempty"`
+	// Types that are assignable to Event:
+	//	*SessionEvent_Answer
+	//	*SessionEvent_Received
+	//	*SessionEvent_Sent
+	//	*SessionEvent_Error
+	Event isSessionEvent_Event `protobuf_oneof:"event"`
+}
+
+func (x *SessionEvent) Reset() {
+	*x = SessionEvent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SessionEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionEvent) ProtoMessage() {}
+
+func (x *SessionEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionEvent.ProtoReflect.Descriptor instead.
+func (*SessionEvent) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SessionEvent) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *SessionEvent) GetTimeUnixNano() int64 {
+	if x != nil {
+		return x.TimeUnixNano
+	}
+	return 0
+}
+
+func (x *SessionEvent) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (m *SessionEvent) GetEvent() isSessionEvent_Event {
+	if m != nil {
+		return m.Event
+	}
+	return nil
+}
+
+func (x *SessionEvent) GetAnswer() *EsbMessage {
+	if x, ok := x.GetEvent().(*SessionEvent_Answer); ok {
+		return x.Answer
+	}
+	return nil
+}
+
+func (x *SessionEvent) GetReceived() *EsbMessage {
+	if x, ok := x.GetEvent().(*SessionEvent_Received); ok {
+		return x.Received
+	}
+	return nil
+}
+
+func (x *SessionEvent) GetSent() *SendResult {
+	if x, ok := x.GetEvent().(*SessionEvent_Sent); ok {
+		return x.Sent
+	}
+	return nil
+}
+
+func (x *SessionEvent) GetError() *SessionError {
+	if x, ok := x.GetEvent().(*SessionEvent_Error); ok {
+		return x.Error
+	}
+	return nil
+}
+
+type isSessionEvent_Event interface {
+	isSessionEvent_Event()
+}
+
+type SessionEvent_Answer struct {
+	Answer *EsbMessage `protobuf:"bytes,4,opt,name=answer,proto3,oneof"`
+}
+
+type SessionEvent_Received struct {
+	Received *EsbMessage `protobuf:"bytes,5,opt,name=received,proto3,oneof"`
+}
+
+type SessionEvent_Sent struct {
+	Sent *SendResult `protobuf:"bytes,6,opt,name=sent,proto3,oneof"`
+}
+
+type SessionEvent_Error struct {
+	Error *SessionError `protobuf:"bytes,7,opt,name=error,proto3,oneof"`
+}
+
+func (*SessionEvent_Answer) isSessionEvent_Event() {}
+
+func (*SessionEvent_Received) isSessionEvent_Event() {}
+
+func (*SessionEvent_Sent) isSessionEvent_Event() {}
+
+func (*SessionEvent_Error) isSessionEvent_Event() {}
+
+// SessionError is the reason of a failed request of a Session stream
+type SessionError struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// gRPC status code
+	Code    int32        `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message string       `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Detail  *ErrorDetail `protobuf:"bytes,3,opt,name=detail,proto3" json:"detail,omitempty"`
+}
+
+func (x *SessionError) Reset() {
+	*x = SessionError{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SessionError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionError) ProtoMessage() {}
+
+func (x *SessionError) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionError.ProtoReflect.Descriptor instead.
+func (*SessionError) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SessionError) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *SessionError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *SessionError) GetDetail() *ErrorDetail {
+	if x != nil {
+		return x.Detail
+	}
+	return nil
+}
+
+// SendResult is the (empty) result of a successful Send
+type SendResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *SendResult) Reset() {
+	*x = SendResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SendResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendResult) ProtoMessage() {}
+
+func (x *SendResult) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendResult.ProtoReflect.Descriptor instead.
+func (*SendResult) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{11}
+}
+
+// BridgeInfoRequest is the (empty) request of GetBridgeInfo
+type BridgeInfoRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *BridgeInfoRequest) Reset() {
+	*x = BridgeInfoRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BridgeInfoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BridgeInfoRequest) ProtoMessage() {}
+
+func (x *BridgeInfoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BridgeInfoRequest.ProtoReflect.Descriptor instead.
+func (*BridgeInfoRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{12}
+}
+
+// FirmwareVersion is the firmware version of the esb-bridge device
+type FirmwareVersion struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Major uint32 `protobuf:"varint,1,opt,name=major,proto3" json:"major,omitempty"`
+	Minor uint32 `protobuf:"varint,2,opt,name=minor,proto3" json:"minor,omitempty"`
+	Patch uint32 `protobuf:"varint,3,opt,name=patch,proto3" json:"patch,omitempty"`
+}
+
+func (x *FirmwareVersion) Reset() {
+	*x = FirmwareVersion{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FirmwareVersion) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FirmwareVersion) ProtoMessage() {}
+
+func (x *FirmwareVersion) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FirmwareVersion.ProtoReflect.Descriptor instead.
+func (*FirmwareVersion) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *FirmwareVersion) GetMajor() uint32 {
+	if x != nil {
+		return x.Major
+	}
+	return 0
+}
+
+func (x *FirmwareVersion) GetMinor() uint32 {
+	if x != nil {
+		return x.Minor
+	}
+	return 0
+}
+
+func (x *FirmwareVersion) GetPatch() uint32 {
+	if x != nil {
+		return x.Patch
+	}
+	return 0
+}
+
+// BridgeInfo describes the esb-bridge device and its connection
+type BridgeInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	FwVersion *FirmwareVersion `protobuf:"bytes,1,opt,name=fw_version,json=fwVersion,proto3" json:"fw_version,omitempty"`
+	// device path of the esb-bridge device on the server
+	Device string `protobuf:"bytes,2,opt,name=device,proto3" json:"device,omitempty"`
+	// time since the server opened the device
+	UptimeSeconds uint64          `protobuf:"varint,3,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
+	State         ConnectionState `protobuf:"varint,4,opt,name=state,proto3,enum=server.ConnectionState" json:"state,omitempty"`
+	// features offered by the bridge with its firmware and by the server, e.g. "transfer", "listen", "filter"
+	Capabilities   []string `protobuf:"bytes,5,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	MaxPayloadSize uint32   `protobuf:"varint,6,opt,name=max_payload_size,json=maxPayloadSize,proto3" json:"max_payload_size,omitempty"`
+}
+
+func (x *BridgeInfo) Reset() {
+	*x = BridgeInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BridgeInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BridgeInfo) ProtoMessage() {}
+
+func (x *BridgeInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BridgeInfo.ProtoReflect.Descriptor instead.
+func (*BridgeInfo) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *BridgeInfo) GetFwVersion() *FirmwareVersion {
+	if x != nil {
+		return x.FwVersion
+	}
+	return nil
+}
+
+func (x *BridgeInfo) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *BridgeInfo) GetUptimeSeconds() uint64 {
+	if x != nil {
+		return x.UptimeSeconds
+	}
+	return 0
+}
+
+func (x *BridgeInfo) GetState() ConnectionState {
+	if x != nil {
+		return x.State
+	}
+	return ConnectionState_DISCONNECTED
+}
+
+func (x *BridgeInfo) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *BridgeInfo) GetMaxPayloadSize() uint32 {
+	if x != nil {
+		return x.MaxPayloadSize
+	}
+	return 0
+}
+
+// ErrorDetail is attached to the status of a failed RPC
+type ErrorDetail struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Reason ErrorReason `protobuf:"varint,1,opt,name=reason,proto3,enum=server.ErrorReason" json:"reason,omitempty"`
+	// USB command ID and error code, for ERR_FIRMWARE
+	FwCmd  uint32 `protobuf:"varint,2,opt,name=fw_cmd,json=fwCmd,proto3" json:"fw_cmd,omitempty"`
+	FwCode uint32 `protobuf:"varint,3,opt,name=fw_code,json=fwCode,proto3" json:"fw_code,omitempty"`
 }
 
-func (x *Listener) Reset() {
-	*x = Listener{}
+func (x *ErrorDetail) Reset() {
+	*x = ErrorDetail{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[0]
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[15]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *Listener) String() string {
+func (x *ErrorDetail) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Listener) ProtoMessage() {}
+func (*ErrorDetail) ProtoMessage() {}
 
-func (x *Listener) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[0]
+func (x *ErrorDetail) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[15]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -62,23 +1310,30 @@ func (x *Listener) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Listener.ProtoReflect.Descriptor instead.
-func (*Listener) Descriptor() ([]byte, []int) {
-	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{0}
+// Deprecated: Use ErrorDetail.ProtoReflect.Descriptor instead.
+func (*ErrorDetail) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{15}
 }
 
-func (x *Listener) GetAddr() []byte {
+func (x *ErrorDetail) GetReason() ErrorReason {
 	if x != nil {
-		return x.Addr
+		return x.Reason
 	}
-	return nil
+	return ErrorReason_ERR_UNKNOWN
 }
 
-func (x *Listener) GetCmd() []byte {
+func (x *ErrorDetail) GetFwCmd() uint32 {
 	if x != nil {
-		return x.Cmd
+		return x.FwCmd
 	}
-	return nil
+	return 0
+}
+
+func (x *ErrorDetail) GetFwCode() uint32 {
+	if x != nil {
+		return x.FwCode
+	}
+	return 0
 }
 
 // EsbMessage holds all information for an ESB transaction
@@ -91,12 +1346,21 @@ type EsbMessage struct {
 	Cmd     []byte `protobuf:"bytes,2,opt,name=cmd,proto3" json:"cmd,omitempty"`
 	Error   []byte `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
 	Payload []byte `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	// Listen only: number of messages dropped since the previous message because the client did not keep up
+	Dropped uint64 `protobuf:"varint,5,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	// answers and incoming messages: numbers the messages received by the esb-bridge device in the order of their
+	// arrival
+	Seq uint64 `protobuf:"varint,6,opt,name=seq,proto3" json:"seq,omitempty"`
+	// answers and incoming messages: time of arrival on the server, in nanoseconds since the Unix epoch
+	TimeUnixNano int64 `protobuf:"varint,7,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	// incoming messages: radio metadata, not set if the firmware does not report it
+	Radio *RadioInfo `protobuf:"bytes,8,opt,name=radio,proto3" json:"radio,omitempty"`
 }
 
 func (x *EsbMessage) Reset() {
 	*x = EsbMessage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[1]
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[16]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -109,7 +1373,7 @@ func (x *EsbMessage) String() string {
 func (*EsbMessage) ProtoMessage() {}
 
 func (x *EsbMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[1]
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[16]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -122,7 +1386,7 @@ func (x *EsbMessage) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use EsbMessage.ProtoReflect.Descriptor instead.
 func (*EsbMessage) Descriptor() ([]byte, []int) {
-	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{1}
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{16}
 }
 
 func (x *EsbMessage) GetAddr() []byte {
@@ -153,34 +1417,296 @@ func (x *EsbMessage) GetPayload() []byte {
 	return nil
 }
 
+func (x *EsbMessage) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+func (x *EsbMessage) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *EsbMessage) GetTimeUnixNano() int64 {
+	if x != nil {
+		return x.TimeUnixNano
+	}
+	return 0
+}
+
+func (x *EsbMessage) GetRadio() *RadioInfo {
+	if x != nil {
+		return x.Radio
+	}
+	return nil
+}
+
+// RadioInfo is the radio metadata of an incoming message
+type RadioInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// ESB pipe the message was received on
+	Pipe uint32 `protobuf:"varint,1,opt,name=pipe,proto3" json:"pipe,omitempty"`
+	// signal strength in dBm
+	Rssi int32 `protobuf:"zigzag32,2,opt,name=rssi,proto3" json:"rssi,omitempty"`
+	// number of retransmissions the peripheral needed to deliver the message
+	Retransmits uint32 `protobuf:"varint,3,opt,name=retransmits,proto3" json:"retransmits,omitempty"`
+}
+
+func (x *RadioInfo) Reset() {
+	*x = RadioInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RadioInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RadioInfo) ProtoMessage() {}
+
+func (x *RadioInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_server_service_esbbridge_rpc_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RadioInfo.ProtoReflect.Descriptor instead.
+func (*RadioInfo) Descriptor() ([]byte, []int) {
+	return file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *RadioInfo) GetPipe() uint32 {
+	if x != nil {
+		return x.Pipe
+	}
+	return 0
+}
+
+func (x *RadioInfo) GetRssi() int32 {
+	if x != nil {
+		return x.Rssi
+	}
+	return 0
+}
+
+func (x *RadioInfo) GetRetransmits() uint32 {
+	if x != nil {
+		return x.Retransmits
+	}
+	return 0
+}
+
 var File_pkg_server_service_esbbridge_rpc_proto protoreflect.FileDescriptor
 
 var file_pkg_server_service_esbbridge_rpc_proto_rawDesc = []byte{
 	0x0a, 0x26, 0x70, 0x6b, 0x67, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x73, 0x65, 0x72,
 	0x76, 0x69, 0x63, 0x65, 0x2f, 0x65, 0x73, 0x62, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x5f, 0x72,
 	0x70, 0x63, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x06, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72,
-	0x22, 0x30, 0x0a, 0x08, 0x4c, 0x69, 0x73, 0x74, 0x65, 0x6e, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04,
-	0x61, 0x64, 0x64, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x61, 0x64, 0x64, 0x72,
-	0x12, 0x10, 0x0a, 0x03, 0x63, 0x6d, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x63,
-	0x6d, 0x64, 0x22, 0x62, 0x0a, 0x0a, 0x45, 0x73, 0x62, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
-	0x12, 0x12, 0x0a, 0x04, 0x61, 0x64, 0x64, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04,
-	0x61, 0x64, 0x64, 0x72, 0x12, 0x10, 0x0a, 0x03, 0x63, 0x6d, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x0c, 0x52, 0x03, 0x63, 0x6d, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18,
-	0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x18, 0x0a, 0x07,
-	0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x70,
-	0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x32, 0x75, 0x0a, 0x09, 0x45, 0x73, 0x62, 0x42, 0x72, 0x69,
+	0x22, 0xab, 0x01, 0x0a, 0x08, 0x4c, 0x69, 0x73, 0x74, 0x65, 0x6e, 0x65, 0x72, 0x12, 0x12, 0x0a,
+	0x04, 0x61, 0x64, 0x64, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x61, 0x64, 0x64,
+	0x72, 0x12, 0x10, 0x0a, 0x03, 0x63, 0x6d, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03,
+	0x63, 0x6d, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x71, 0x75, 0x65, 0x75, 0x65, 0x5f, 0x73, 0x69, 0x7a,
+	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x71, 0x75, 0x65, 0x75, 0x65, 0x53, 0x69,
+	0x7a, 0x65, 0x12, 0x32, 0x0a, 0x08, 0x6f, 0x76, 0x65, 0x72, 0x66, 0x6c, 0x6f, 0x77, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x0e, 0x32, 0x16, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x4f, 0x76,
+	0x65, 0x72, 0x66, 0x6c, 0x6f, 0x77, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x08, 0x6f, 0x76,
+	0x65, 0x72, 0x66, 0x6c, 0x6f, 0x77, 0x12, 0x26, 0x0a, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e,
+	0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x22, 0xb9,
+	0x01, 0x0a, 0x06, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x64, 0x64,
+	0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x61, 0x64, 0x64, 0x72, 0x12, 0x1b, 0x0a,
+	0x09, 0x61, 0x64, 0x64, 0x72, 0x5f, 0x6d, 0x61, 0x73, 0x6b, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x08, 0x61, 0x64, 0x64, 0x72, 0x4d, 0x61, 0x73, 0x6b, 0x12, 0x24, 0x0a, 0x04, 0x63, 0x6d,
+	0x64, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65,
+	0x72, 0x2e, 0x43, 0x6d, 0x64, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x52, 0x04, 0x63, 0x6d, 0x64, 0x73,
+	0x12, 0x2e, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x04, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x14, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x50, 0x61, 0x79, 0x6c, 0x6f,
+	0x61, 0x64, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x52, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64,
+	0x12, 0x28, 0x0a, 0x07, 0x65, 0x78, 0x63, 0x6c, 0x75, 0x64, 0x65, 0x18, 0x05, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x46, 0x69, 0x6c, 0x74, 0x65,
+	0x72, 0x52, 0x07, 0x65, 0x78, 0x63, 0x6c, 0x75, 0x64, 0x65, 0x22, 0x34, 0x0a, 0x08, 0x43, 0x6d,
+	0x64, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x69, 0x72, 0x73, 0x74, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x66, 0x69, 0x72, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04,
+	0x6c, 0x61, 0x73, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x6c, 0x61, 0x73, 0x74,
+	0x22, 0x50, 0x0a, 0x0c, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x4d, 0x61, 0x74, 0x63, 0x68,
+	0x12, 0x16, 0x0a, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x12,
+	0x0a, 0x04, 0x6d, 0x61, 0x73, 0x6b, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x6d, 0x61,
+	0x73, 0x6b, 0x22, 0x61, 0x0a, 0x10, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x28, 0x0a, 0x03, 0x61, 0x64, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x53, 0x75, 0x62,
+	0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x48, 0x00, 0x52, 0x03, 0x61, 0x64, 0x64,
+	0x12, 0x18, 0x0a, 0x06, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d,
+	0x48, 0x00, 0x52, 0x06, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x42, 0x09, 0x0a, 0x07, 0x72, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x46, 0x0a, 0x0c, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x02, 0x69, 0x64, 0x12, 0x26, 0x0a, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x46,
+	0x69, 0x6c, 0x74, 0x65, 0x72, 0x52, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x22, 0x6c, 0x0a,
+	0x11, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x64, 0x4d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x12, 0x2c, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x45, 0x73, 0x62,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x12, 0x29, 0x0a, 0x10, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x5f, 0x69, 0x64, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0d, 0x52, 0x0f, 0x73, 0x75, 0x62, 0x73,
+	0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x73, 0x22, 0xb9, 0x01, 0x0a, 0x0e,
+	0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0e,
+	0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x02, 0x69, 0x64, 0x12, 0x30,
+	0x0a, 0x08, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x12, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x45, 0x73, 0x62, 0x4d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x48, 0x00, 0x52, 0x08, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72,
+	0x12, 0x28, 0x0a, 0x04, 0x73, 0x65, 0x6e, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12,
+	0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x45, 0x73, 0x62, 0x4d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x48, 0x00, 0x52, 0x04, 0x73, 0x65, 0x6e, 0x64, 0x12, 0x30, 0x0a, 0x06, 0x6c, 0x69,
+	0x73, 0x74, 0x65, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x73, 0x65, 0x72,
+	0x76, 0x65, 0x72, 0x2e, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x46, 0x69, 0x6c, 0x74, 0x65,
+	0x72, 0x73, 0x48, 0x00, 0x52, 0x06, 0x6c, 0x69, 0x73, 0x74, 0x65, 0x6e, 0x42, 0x09, 0x0a, 0x07,
+	0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x3a, 0x0a, 0x0e, 0x53, 0x65, 0x73, 0x73, 0x69,
+	0x6f, 0x6e, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x73, 0x12, 0x28, 0x0a, 0x07, 0x66, 0x69, 0x6c,
+	0x74, 0x65, 0x72, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x73, 0x65, 0x72,
+	0x76, 0x65, 0x72, 0x2e, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52, 0x07, 0x66, 0x69, 0x6c, 0x74,
+	0x65, 0x72, 0x73, 0x22, 0x97, 0x02, 0x0a, 0x0c, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x45,
+	0x76, 0x65, 0x6e, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x03, 0x73, 0x65, 0x71, 0x12, 0x24, 0x0a, 0x0e, 0x74, 0x69, 0x6d, 0x65, 0x5f, 0x75,
+	0x6e, 0x69, 0x78, 0x5f, 0x6e, 0x61, 0x6e, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c,
+	0x74, 0x69, 0x6d, 0x65, 0x55, 0x6e, 0x69, 0x78, 0x4e, 0x61, 0x6e, 0x6f, 0x12, 0x0e, 0x0a, 0x02,
+	0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x02, 0x69, 0x64, 0x12, 0x2c, 0x0a, 0x06,
+	0x61, 0x6e, 0x73, 0x77, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x73,
+	0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x45, 0x73, 0x62, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x48, 0x00, 0x52, 0x06, 0x61, 0x6e, 0x73, 0x77, 0x65, 0x72, 0x12, 0x30, 0x0a, 0x08, 0x72, 0x65,
+	0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x73,
+	0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x45, 0x73, 0x62, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x48, 0x00, 0x52, 0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x12, 0x28, 0x0a, 0x04,
+	0x73, 0x65, 0x6e, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x73, 0x65, 0x72,
+	0x76, 0x65, 0x72, 0x2e, 0x53, 0x65, 0x6e, 0x64, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x48, 0x00,
+	0x52, 0x04, 0x73, 0x65, 0x6e, 0x74, 0x12, 0x2c, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x53,
+	0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x48, 0x00, 0x52, 0x05, 0x65,
+	0x72, 0x72, 0x6f, 0x72, 0x42, 0x07, 0x0a, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x22, 0x69, 0x0a,
+	0x0c, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x12, 0x0a,
+	0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x63, 0x6f, 0x64,
+	0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x2b, 0x0a, 0x06, 0x64,
+	0x65, 0x74, 0x61, 0x69, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x73, 0x65,
+	0x72, 0x76, 0x65, 0x72, 0x2e, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x44, 0x65, 0x74, 0x61, 0x69, 0x6c,
+	0x52, 0x06, 0x64, 0x65, 0x74, 0x61, 0x69, 0x6c, 0x22, 0x0c, 0x0a, 0x0a, 0x53, 0x65, 0x6e, 0x64,
+	0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x13, 0x0a, 0x11, 0x42, 0x72, 0x69, 0x64, 0x67, 0x65,
+	0x49, 0x6e, 0x66, 0x6f, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x53, 0x0a, 0x0f, 0x46,
+	0x69, 0x72, 0x6d, 0x77, 0x61, 0x72, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x14,
+	0x0a, 0x05, 0x6d, 0x61, 0x6a, 0x6f, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x6d,
+	0x61, 0x6a, 0x6f, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x6d, 0x69, 0x6e, 0x6f, 0x72, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x05, 0x6d, 0x69, 0x6e, 0x6f, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x61,
+	0x74, 0x63, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x70, 0x61, 0x74, 0x63, 0x68,
+	0x22, 0x80, 0x02, 0x0a, 0x0a, 0x42, 0x72, 0x69, 0x64, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12,
+	0x36, 0x0a, 0x0a, 0x66, 0x77, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x46, 0x69, 0x72,
+	0x6d, 0x77, 0x61, 0x72, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x09, 0x66, 0x77,
+	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x64, 0x65, 0x76, 0x69, 0x63,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65, 0x12,
+	0x25, 0x0a, 0x0e, 0x75, 0x70, 0x74, 0x69, 0x6d, 0x65, 0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64,
+	0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0d, 0x75, 0x70, 0x74, 0x69, 0x6d, 0x65, 0x53,
+	0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x12, 0x2d, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x17, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x43,
+	0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x05,
+	0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x63, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c,
+	0x69, 0x74, 0x69, 0x65, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0c, 0x63, 0x61, 0x70,
+	0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73, 0x12, 0x28, 0x0a, 0x10, 0x6d, 0x61, 0x78,
+	0x5f, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x0e, 0x6d, 0x61, 0x78, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x53,
+	0x69, 0x7a, 0x65, 0x22, 0x6a, 0x0a, 0x0b, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x44, 0x65, 0x74, 0x61,
+	0x69, 0x6c, 0x12, 0x2b, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x13, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x45, 0x72, 0x72, 0x6f,
+	0x72, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12,
+	0x15, 0x0a, 0x06, 0x66, 0x77, 0x5f, 0x63, 0x6d, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x05, 0x66, 0x77, 0x43, 0x6d, 0x64, 0x12, 0x17, 0x0a, 0x07, 0x66, 0x77, 0x5f, 0x63, 0x6f, 0x64,
+	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x66, 0x77, 0x43, 0x6f, 0x64, 0x65, 0x22,
+	0xdd, 0x01, 0x0a, 0x0a, 0x45, 0x73, 0x62, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x12,
+	0x0a, 0x04, 0x61, 0x64, 0x64, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x61, 0x64,
+	0x64, 0x72, 0x12, 0x10, 0x0a, 0x03, 0x63, 0x6d, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x03, 0x63, 0x6d, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61,
+	0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x70, 0x61, 0x79,
+	0x6c, 0x6f, 0x61, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x12, 0x10,
+	0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x06, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x73, 0x65, 0x71,
+	0x12, 0x24, 0x0a, 0x0e, 0x74, 0x69, 0x6d, 0x65, 0x5f, 0x75, 0x6e, 0x69, 0x78, 0x5f, 0x6e, 0x61,
+	0x6e, 0x6f, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x74, 0x69, 0x6d, 0x65, 0x55, 0x6e,
+	0x69, 0x78, 0x4e, 0x61, 0x6e, 0x6f, 0x12, 0x27, 0x0a, 0x05, 0x72, 0x61, 0x64, 0x69, 0x6f, 0x18,
+	0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x52,
+	0x61, 0x64, 0x69, 0x6f, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x05, 0x72, 0x61, 0x64, 0x69, 0x6f, 0x22,
+	0x55, 0x0a, 0x09, 0x52, 0x61, 0x64, 0x69, 0x6f, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x12, 0x0a, 0x04,
+	0x70, 0x69, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x70, 0x69, 0x70, 0x65,
+	0x12, 0x12, 0x0a, 0x04, 0x72, 0x73, 0x73, 0x69, 0x18, 0x02, 0x20, 0x01, 0x28, 0x11, 0x52, 0x04,
+	0x72, 0x73, 0x73, 0x69, 0x12, 0x20, 0x0a, 0x0b, 0x72, 0x65, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x6d,
+	0x69, 0x74, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x72, 0x65, 0x74, 0x72, 0x61,
+	0x6e, 0x73, 0x6d, 0x69, 0x74, 0x73, 0x2a, 0x73, 0x0a, 0x0e, 0x4f, 0x76, 0x65, 0x72, 0x66, 0x6c,
+	0x6f, 0x77, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x14, 0x0a, 0x10, 0x4f, 0x56, 0x45, 0x52,
+	0x46, 0x4c, 0x4f, 0x57, 0x5f, 0x44, 0x45, 0x46, 0x41, 0x55, 0x4c, 0x54, 0x10, 0x00, 0x12, 0x18,
+	0x0a, 0x14, 0x4f, 0x56, 0x45, 0x52, 0x46, 0x4c, 0x4f, 0x57, 0x5f, 0x44, 0x52, 0x4f, 0x50, 0x5f,
+	0x4f, 0x4c, 0x44, 0x45, 0x53, 0x54, 0x10, 0x01, 0x12, 0x18, 0x0a, 0x14, 0x4f, 0x56, 0x45, 0x52,
+	0x46, 0x4c, 0x4f, 0x57, 0x5f, 0x44, 0x52, 0x4f, 0x50, 0x5f, 0x4e, 0x45, 0x57, 0x45, 0x53, 0x54,
+	0x10, 0x02, 0x12, 0x17, 0x0a, 0x13, 0x4f, 0x56, 0x45, 0x52, 0x46, 0x4c, 0x4f, 0x57, 0x5f, 0x44,
+	0x49, 0x53, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x10, 0x03, 0x2a, 0x44, 0x0a, 0x0f, 0x43,
+	0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x10,
+	0x0a, 0x0c, 0x44, 0x49, 0x53, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x45, 0x44, 0x10, 0x00,
+	0x12, 0x0d, 0x0a, 0x09, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x45, 0x44, 0x10, 0x01, 0x12,
+	0x10, 0x0a, 0x0c, 0x52, 0x45, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x49, 0x4e, 0x47, 0x10,
+	0x02, 0x2a, 0xb1, 0x01, 0x0a, 0x0b, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x52, 0x65, 0x61, 0x73, 0x6f,
+	0x6e, 0x12, 0x0f, 0x0a, 0x0b, 0x45, 0x52, 0x52, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e,
+	0x10, 0x00, 0x12, 0x15, 0x0a, 0x11, 0x45, 0x52, 0x52, 0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x43, 0x4f,
+	0x4e, 0x4e, 0x45, 0x43, 0x54, 0x45, 0x44, 0x10, 0x01, 0x12, 0x13, 0x0a, 0x0f, 0x45, 0x52, 0x52,
+	0x5f, 0x55, 0x4e, 0x41, 0x56, 0x41, 0x49, 0x4c, 0x41, 0x42, 0x4c, 0x45, 0x10, 0x02, 0x12, 0x0f,
+	0x0a, 0x0b, 0x45, 0x52, 0x52, 0x5f, 0x54, 0x49, 0x4d, 0x45, 0x4f, 0x55, 0x54, 0x10, 0x03, 0x12,
+	0x19, 0x0a, 0x15, 0x45, 0x52, 0x52, 0x5f, 0x50, 0x41, 0x59, 0x4c, 0x4f, 0x41, 0x44, 0x5f, 0x54,
+	0x4f, 0x4f, 0x5f, 0x4c, 0x41, 0x52, 0x47, 0x45, 0x10, 0x04, 0x12, 0x15, 0x0a, 0x11, 0x45, 0x52,
+	0x52, 0x5f, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x50, 0x41, 0x52, 0x41, 0x4d, 0x10,
+	0x05, 0x12, 0x10, 0x0a, 0x0c, 0x45, 0x52, 0x52, 0x5f, 0x46, 0x49, 0x52, 0x4d, 0x57, 0x41, 0x52,
+	0x45, 0x10, 0x06, 0x12, 0x10, 0x0a, 0x0c, 0x45, 0x52, 0x52, 0x5f, 0x50, 0x52, 0x4f, 0x54, 0x4f,
+	0x43, 0x4f, 0x4c, 0x10, 0x07, 0x32, 0xf0, 0x02, 0x0a, 0x09, 0x45, 0x73, 0x62, 0x42, 0x72, 0x69,
 	0x64, 0x67, 0x65, 0x12, 0x34, 0x0a, 0x08, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x12,
 	0x12, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x45, 0x73, 0x62, 0x4d, 0x65, 0x73, 0x73,
 	0x61, 0x67, 0x65, 0x1a, 0x12, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x45, 0x73, 0x62,
-	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x00, 0x12, 0x32, 0x0a, 0x06, 0x4c, 0x69, 0x73,
-	0x74, 0x65, 0x6e, 0x12, 0x10, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x4c, 0x69, 0x73,
-	0x74, 0x65, 0x6e, 0x65, 0x72, 0x1a, 0x12, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x45,
-	0x73, 0x62, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x00, 0x30, 0x01, 0x42, 0x3e, 0x5a,
-	0x3c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x70, 0x72, 0x69,
-	0x74, 0x6b, 0x6f, 0x70, 0x66, 0x2f, 0x65, 0x73, 0x62, 0x2d, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65,
-	0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x65, 0x73, 0x62, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x2f, 0x73,
-	0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x62, 0x06, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x00, 0x12, 0x30, 0x0a, 0x04, 0x53, 0x65, 0x6e,
+	0x64, 0x12, 0x12, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x45, 0x73, 0x62, 0x4d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x1a, 0x12, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x53,
+	0x65, 0x6e, 0x64, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x40, 0x0a, 0x0d, 0x47,
+	0x65, 0x74, 0x42, 0x72, 0x69, 0x64, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x19, 0x2e, 0x73,
+	0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x42, 0x72, 0x69, 0x64, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72,
+	0x2e, 0x42, 0x72, 0x69, 0x64, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x22, 0x00, 0x12, 0x32, 0x0a,
+	0x06, 0x4c, 0x69, 0x73, 0x74, 0x65, 0x6e, 0x12, 0x10, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72,
+	0x2e, 0x4c, 0x69, 0x73, 0x74, 0x65, 0x6e, 0x65, 0x72, 0x1a, 0x12, 0x2e, 0x73, 0x65, 0x72, 0x76,
+	0x65, 0x72, 0x2e, 0x45, 0x73, 0x62, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x00, 0x30,
+	0x01, 0x12, 0x46, 0x0a, 0x09, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x12, 0x18,
+	0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65,
+	0x72, 0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x64, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x12, 0x3d, 0x0a, 0x07, 0x53, 0x65, 0x73,
+	0x73, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x53, 0x65,
+	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x73,
+	0x65, 0x72, 0x76, 0x65, 0x72, 0x2e, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x45, 0x76, 0x65,
+	0x6e, 0x74, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x42, 0x3e, 0x5a, 0x3c, 0x67, 0x69, 0x74, 0x68,
+	0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x70, 0x72, 0x69, 0x74, 0x6b, 0x6f, 0x70, 0x66,
+	0x2f, 0x65, 0x73, 0x62, 0x2d, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x2f, 0x70, 0x6b, 0x67, 0x2f,
+	0x65, 0x73, 0x62, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72,
+	0x2f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -195,21 +1721,70 @@ func file_pkg_server_service_esbbridge_rpc_proto_rawDescGZIP() []byte {
 	return file_pkg_server_service_esbbridge_rpc_proto_rawDescData
 }
 
-var file_pkg_server_service_esbbridge_rpc_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_pkg_server_service_esbbridge_rpc_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_pkg_server_service_esbbridge_rpc_proto_msgTypes = make([]protoimpl.MessageInfo, 18)
 var file_pkg_server_service_esbbridge_rpc_proto_goTypes = []interface{}{
-	(*Listener)(nil),   // 0: server.Listener
-	(*EsbMessage)(nil), // 1: server.EsbMessage
+	(OverflowPolicy)(0),       // 0: server.OverflowPolicy
+	(ConnectionState)(0),      // 1: server.ConnectionState
+	(ErrorReason)(0),          // 2: server.ErrorReason
+	(*Listener)(nil),          // 3: server.Listener
+	(*Filter)(nil),            // 4: server.Filter
+	(*CmdRange)(nil),          // 5: server.CmdRange
+	(*PayloadMatch)(nil),      // 6: server.PayloadMatch
+	(*SubscribeRequest)(nil),  // 7: server.SubscribeRequest
+	(*Subscription)(nil),      // 8: server.Subscription
+	(*SubscribedMessage)(nil), // 9: server.SubscribedMessage
+	(*SessionRequest)(nil),    // 10: server.SessionRequest
+	(*SessionFilters)(nil),    // 11: server.SessionFilters
+	(*SessionEvent)(nil),      // 12: server.SessionEvent
+	(*SessionError)(nil),      // 13: server.SessionError
+	(*SendResult)(nil),        // 14: server.SendResult
+	(*BridgeInfoRequest)(nil), // 15: server.BridgeInfoRequest
+	(*FirmwareVersion)(nil),   // 16: server.FirmwareVersion
+	(*BridgeInfo)(nil),        // 17: server.BridgeInfo
+	(*ErrorDetail)(nil),       // 18: server.ErrorDetail
+	(*EsbMessage)(nil),        // 19: server.EsbMessage
+	(*RadioInfo)(nil),         // 20: server.RadioInfo
 }
 var file_pkg_server_service_esbbridge_rpc_proto_depIdxs = []int32{
-	1, // 0: server.EsbBridge.Transfer:input_type -> server.EsbMessage
-	0, // 1: server.EsbBridge.Listen:input_type -> server.Listener
-	1, // 2: server.EsbBridge.Transfer:output_type -> server.EsbMessage
-	1, // 3: server.EsbBridge.Listen:output_type -> server.EsbMessage
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0,  // 0: server.Listener.overflow:type_name -> server.OverflowPolicy
+	4,  // 1: server.Listener.filter:type_name -> server.Filter
+	5,  // 2: server.Filter.cmds:type_name -> server.CmdRange
+	6,  // 3: server.Filter.payload:type_name -> server.PayloadMatch
+	4,  // 4: server.Filter.exclude:type_name -> server.Filter
+	8,  // 5: server.SubscribeRequest.add:type_name -> server.Subscription
+	4,  // 6: server.Subscription.filter:type_name -> server.Filter
+	19, // 7: server.SubscribedMessage.message:type_name -> server.EsbMessage
+	19, // 8: server.SessionRequest.transfer:type_name -> server.EsbMessage
+	19, // 9: server.SessionRequest.send:type_name -> server.EsbMessage
+	11, // 10: server.SessionRequest.listen:type_name -> server.SessionFilters
+	4,  // 11: server.SessionFilters.filters:type_name -> server.Filter
+	19, // 12: server.SessionEvent.answer:type_name -> server.EsbMessage
+	19, // 13: server.SessionEvent.received:type_name -> server.EsbMessage
+	14, // 14: server.SessionEvent.sent:type_name -> server.SendResult
+	13, // 15: server.SessionEvent.error:type_name -> server.SessionError
+	18, // 16: server.SessionError.detail:type_name -> server.ErrorDetail
+	16, // 17: server.BridgeInfo.fw_version:type_name -> server.FirmwareVersion
+	1,  // 18: server.BridgeInfo.state:type_name -> server.ConnectionState
+	2,  // 19: server.ErrorDetail.reason:type_name -> server.ErrorReason
+	20, // 20: server.EsbMessage.radio:type_name -> server.RadioInfo
+	19, // 21: server.EsbBridge.Transfer:input_type -> server.EsbMessage
+	19, // 22: server.EsbBridge.Send:input_type -> server.EsbMessage
+	15, // 23: server.EsbBridge.GetBridgeInfo:input_type -> server.BridgeInfoRequest
+	3,  // 24: server.EsbBridge.Listen:input_type -> server.Listener
+	7,  // 25: server.EsbBridge.Subscribe:input_type -> server.SubscribeRequest
+	10, // 26: server.EsbBridge.Session:input_type -> server.SessionRequest
+	19, // 27: server.EsbBridge.Transfer:output_type -> server.EsbMessage
+	14, // 28: server.EsbBridge.Send:output_type -> server.SendResult
+	17, // 29: server.EsbBridge.GetBridgeInfo:output_type -> server.BridgeInfo
+	19, // 30: server.EsbBridge.Listen:output_type -> server.EsbMessage
+	9,  // 31: server.EsbBridge.Subscribe:output_type -> server.SubscribedMessage
+	12, // 32: server.EsbBridge.Session:output_type -> server.SessionEvent
+	27, // [27:33] is the sub-list for method output_type
+	21, // [21:27] is the sub-list for method input_type
+	21, // [21:21] is the sub-list for extension type_name
+	21, // [21:21] is the sub-list for extension extendee
+	0,  // [0:21] is the sub-list for field type_name
 }
 
 func init() { file_pkg_server_service_esbbridge_rpc_proto_init() }
@@ -231,6 +1806,186 @@ func file_pkg_server_service_esbbridge_rpc_proto_init() {
 			}
 		}
 		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Filter); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CmdRange); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PayloadMatch); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubscribeRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Subscription); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubscribedMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SessionRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SessionFilters); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SessionEvent); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SessionError); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SendResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BridgeInfoRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FirmwareVersion); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BridgeInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ErrorDetail); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*EsbMessage); i {
 			case 0:
 				return &v.state
@@ -242,19 +1997,47 @@ func file_pkg_server_service_esbbridge_rpc_proto_init() {
 				return nil
 			}
 		}
+		file_pkg_server_service_esbbridge_rpc_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RadioInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_pkg_server_service_esbbridge_rpc_proto_msgTypes[4].OneofWrappers = []interface{}{
+		(*SubscribeRequest_Add)(nil),
+		(*SubscribeRequest_Remove)(nil),
+	}
+	file_pkg_server_service_esbbridge_rpc_proto_msgTypes[7].OneofWrappers = []interface{}{
+		(*SessionRequest_Transfer)(nil),
+		(*SessionRequest_Send)(nil),
+		(*SessionRequest_Listen)(nil),
+	}
+	file_pkg_server_service_esbbridge_rpc_proto_msgTypes[9].OneofWrappers = []interface{}{
+		(*SessionEvent_Answer)(nil),
+		(*SessionEvent_Received)(nil),
+		(*SessionEvent_Sent)(nil),
+		(*SessionEvent_Error)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_pkg_server_service_esbbridge_rpc_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      3,
+			NumMessages:   18,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_pkg_server_service_esbbridge_rpc_proto_goTypes,
 		DependencyIndexes: file_pkg_server_service_esbbridge_rpc_proto_depIdxs,
+		EnumInfos:         file_pkg_server_service_esbbridge_rpc_proto_enumTypes,
 		MessageInfos:      file_pkg_server_service_esbbridge_rpc_proto_msgTypes,
 	}.Build()
 	File_pkg_server_service_esbbridge_rpc_proto = out.File
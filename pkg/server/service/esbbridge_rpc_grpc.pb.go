@@ -20,8 +20,18 @@ const _ = grpc.SupportPackageIsVersion7
 type EsbBridgeClient interface {
 	// Transfers an ESB message to a peripheral device and returns the anwser
 	Transfer(ctx context.Context, in *EsbMessage, opts ...grpc.CallOption) (*EsbMessage, error)
+	// Sends an ESB message to a peripheral device without waiting for a reply. Fails if the message was not acknowledged
+	Send(ctx context.Context, in *EsbMessage, opts ...grpc.CallOption) (*SendResult, error)
+	// Returns information about the esb-bridge device, its firmware and its connection
+	GetBridgeInfo(ctx context.Context, in *BridgeInfoRequest, opts ...grpc.CallOption) (*BridgeInfo, error)
 	// Starts listening for specific packages. Server will send matching messages async to the client
 	Listen(ctx context.Context, in *Listener, opts ...grpc.CallOption) (EsbBridge_ListenClient, error)
+	// Listens with many subscriptions on one stream. The client adds and removes subscriptions, the server sends the
+	// messages matching any of them, tagged with the IDs of the matching subscriptions
+	Subscribe(ctx context.Context, opts ...grpc.CallOption) (EsbBridge_SubscribeClient, error)
+	// Transfers and sends messages and receives incoming messages on one stream. The server sends the answers,
+	// acknowledgements and incoming messages in the order the esb-bridge device received them
+	Session(ctx context.Context, opts ...grpc.CallOption) (EsbBridge_SessionClient, error)
 }
 
 type esbBridgeClient struct {
@@ -41,6 +51,24 @@ func (c *esbBridgeClient) Transfer(ctx context.Context, in *EsbMessage, opts ...
 	return out, nil
 }
 
+func (c *esbBridgeClient) Send(ctx context.Context, in *EsbMessage, opts ...grpc.CallOption) (*SendResult, error) {
+	out := new(SendResult)
+	err := c.cc.Invoke(ctx, "/server.EsbBridge/Send", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *esbBridgeClient) GetBridgeInfo(ctx context.Context, in *BridgeInfoRequest, opts ...grpc.CallOption) (*BridgeInfo, error) {
+	out := new(BridgeInfo)
+	err := c.cc.Invoke(ctx, "/server.EsbBridge/GetBridgeInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *esbBridgeClient) Listen(ctx context.Context, in *Listener, opts ...grpc.CallOption) (EsbBridge_ListenClient, error) {
 	stream, err := c.cc.NewStream(ctx, &EsbBridge_ServiceDesc.Streams[0], "/server.EsbBridge/Listen", opts...)
 	if err != nil {
@@ -73,14 +101,86 @@ func (x *esbBridgeListenClient) Recv() (*EsbMessage, error) {
 	return m, nil
 }
 
+func (c *esbBridgeClient) Subscribe(ctx context.Context, opts ...grpc.CallOption) (EsbBridge_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EsbBridge_ServiceDesc.Streams[1], "/server.EsbBridge/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &esbBridgeSubscribeClient{stream}
+	return x, nil
+}
+
+type EsbBridge_SubscribeClient interface {
+	Send(*SubscribeRequest) error
+	Recv() (*SubscribedMessage, error)
+	grpc.ClientStream
+}
+
+type esbBridgeSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *esbBridgeSubscribeClient) Send(m *SubscribeRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *esbBridgeSubscribeClient) Recv() (*SubscribedMessage, error) {
+	m := new(SubscribedMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *esbBridgeClient) Session(ctx context.Context, opts ...grpc.CallOption) (EsbBridge_SessionClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EsbBridge_ServiceDesc.Streams[2], "/server.EsbBridge/Session", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &esbBridgeSessionClient{stream}
+	return x, nil
+}
+
+type EsbBridge_SessionClient interface {
+	Send(*SessionRequest) error
+	Recv() (*SessionEvent, error)
+	grpc.ClientStream
+}
+
+type esbBridgeSessionClient struct {
+	grpc.ClientStream
+}
+
+func (x *esbBridgeSessionClient) Send(m *SessionRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *esbBridgeSessionClient) Recv() (*SessionEvent, error) {
+	m := new(SessionEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // EsbBridgeServer is the server API for EsbBridge service.
 // All implementations must embed UnimplementedEsbBridgeServer
 // for forward compatibility
 type EsbBridgeServer interface {
 	// Transfers an ESB message to a peripheral device and returns the anwser
 	Transfer(context.Context, *EsbMessage) (*EsbMessage, error)
+	// Sends an ESB message to a peripheral device without waiting for a reply. Fails if the message was not acknowledged
+	Send(context.Context, *EsbMessage) (*SendResult, error)
+	// Returns information about the esb-bridge device, its firmware and its connection
+	GetBridgeInfo(context.Context, *BridgeInfoRequest) (*BridgeInfo, error)
 	// Starts listening for specific packages. Server will send matching messages async to the client
 	Listen(*Listener, EsbBridge_ListenServer) error
+	// Listens with many subscriptions on one stream. The client adds and removes subscriptions, the server sends the
+	// messages matching any of them, tagged with the IDs of the matching subscriptions
+	Subscribe(EsbBridge_SubscribeServer) error
+	// Transfers and sends messages and receives incoming messages on one stream. The server sends the answers,
+	// acknowledgements and incoming messages in the order the esb-bridge device received them
+	Session(EsbBridge_SessionServer) error
 	mustEmbedUnimplementedEsbBridgeServer()
 }
 
@@ -91,9 +191,21 @@ type UnimplementedEsbBridgeServer struct {
 func (UnimplementedEsbBridgeServer) Transfer(context.Context, *EsbMessage) (*EsbMessage, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Transfer not implemented")
 }
+func (UnimplementedEsbBridgeServer) Send(context.Context, *EsbMessage) (*SendResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Send not implemented")
+}
+func (UnimplementedEsbBridgeServer) GetBridgeInfo(context.Context, *BridgeInfoRequest) (*BridgeInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBridgeInfo not implemented")
+}
 func (UnimplementedEsbBridgeServer) Listen(*Listener, EsbBridge_ListenServer) error {
 	return status.Errorf(codes.Unimplemented, "method Listen not implemented")
 }
+func (UnimplementedEsbBridgeServer) Subscribe(EsbBridge_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedEsbBridgeServer) Session(EsbBridge_SessionServer) error {
+	return status.Errorf(codes.Unimplemented, "method Session not implemented")
+}
 func (UnimplementedEsbBridgeServer) mustEmbedUnimplementedEsbBridgeServer() {}
 
 // UnsafeEsbBridgeServer may be embedded to opt out of forward compatibility for this service.
@@ -125,6 +237,42 @@ func _EsbBridge_Transfer_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _EsbBridge_Send_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EsbMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EsbBridgeServer).Send(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/server.EsbBridge/Send",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EsbBridgeServer).Send(ctx, req.(*EsbMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EsbBridge_GetBridgeInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BridgeInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EsbBridgeServer).GetBridgeInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/server.EsbBridge/GetBridgeInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EsbBridgeServer).GetBridgeInfo(ctx, req.(*BridgeInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _EsbBridge_Listen_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(Listener)
 	if err := stream.RecvMsg(m); err != nil {
@@ -146,6 +294,58 @@ func (x *esbBridgeListenServer) Send(m *EsbMessage) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _EsbBridge_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EsbBridgeServer).Subscribe(&esbBridgeSubscribeServer{stream})
+}
+
+type EsbBridge_SubscribeServer interface {
+	Send(*SubscribedMessage) error
+	Recv() (*SubscribeRequest, error)
+	grpc.ServerStream
+}
+
+type esbBridgeSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *esbBridgeSubscribeServer) Send(m *SubscribedMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *esbBridgeSubscribeServer) Recv() (*SubscribeRequest, error) {
+	m := new(SubscribeRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _EsbBridge_Session_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EsbBridgeServer).Session(&esbBridgeSessionServer{stream})
+}
+
+type EsbBridge_SessionServer interface {
+	Send(*SessionEvent) error
+	Recv() (*SessionRequest, error)
+	grpc.ServerStream
+}
+
+type esbBridgeSessionServer struct {
+	grpc.ServerStream
+}
+
+func (x *esbBridgeSessionServer) Send(m *SessionEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *esbBridgeSessionServer) Recv() (*SessionRequest, error) {
+	m := new(SessionRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // EsbBridge_ServiceDesc is the grpc.ServiceDesc for EsbBridge service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -157,6 +357,14 @@ var EsbBridge_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Transfer",
 			Handler:    _EsbBridge_Transfer_Handler,
 		},
+		{
+			MethodName: "Send",
+			Handler:    _EsbBridge_Send_Handler,
+		},
+		{
+			MethodName: "GetBridgeInfo",
+			Handler:    _EsbBridge_GetBridgeInfo_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -164,6 +372,18 @@ var EsbBridge_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _EsbBridge_Listen_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _EsbBridge_Subscribe_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Session",
+			Handler:       _EsbBridge_Session_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "pkg/server/service/esbbridge_rpc.proto",
 }
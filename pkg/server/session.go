@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// Session runs the transfers and sends requested by the client and streams their results and the incoming messages
+// matching the filters of the client, in the order the bridge received them
+func (s *esbBridgeServer) Session(stream pb.EsbBridge_SessionServer) error {
+	ctx := stream.Context()
+
+	// requests are received by a goroutine, so the stream can be served while waiting for them
+	requests := make(chan *pb.SessionRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	session, err := s.bridge.OpenSession(s.listenerOptions)
+	if err != nil {
+		return rpcError(err)
+	}
+	// running requests are canceled with the context of the stream
+	defer session.Close()
+
+	for {
+		select {
+		case req := <-requests:
+			if err := startSessionRequest(ctx, session, req); err != nil {
+				log.Printf("Session stream: %v", err)
+				return rpcError(err)
+			}
+		case err := <-recvErr:
+			if err != io.EOF {
+				return err
+			}
+			// the client does not send requests anymore, but still receives the events
+			recvErr = nil
+		case event, ok := <-session.Events():
+			if !ok {
+				log.Printf("Session stream disconnected, client does not keep up")
+				return status.Error(codes.ResourceExhausted, "session queue overflow, client does not keep up")
+			}
+			if event.Message.Dropped > 0 {
+				log.Printf("Session stream: %v messages dropped, client does not keep up", event.Message.Dropped)
+			}
+			if err := stream.Send(sessionEventToProto(event)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			log.Printf("Session stream canceled by client")
+			return nil
+		case <-s.stopping:
+			log.Printf("Session stream ended by server shutdown")
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+// startSessionRequest starts a transfer or send, or replaces the filters of a session. Returns an error if the
+// request is invalid
+func startSessionRequest(ctx context.Context, session *esbbridge.Session, req *pb.SessionRequest) error {
+	switch r := req.Request.(type) {
+	case *pb.SessionRequest_Transfer:
+		if len(r.Transfer.Cmd) == 0 {
+			return errMissingCmd
+		}
+		message := esbbridge.EsbMessage{Address: r.Transfer.Addr, Cmd: r.Transfer.Cmd[0], Payload: r.Transfer.Payload}
+		log.Printf("Session stream: transfer %v: %v", req.Id, message)
+		session.Transfer(ctx, req.Id, message)
+
+	case *pb.SessionRequest_Send:
+		if len(r.Send.Cmd) == 0 {
+			return errMissingCmd
+		}
+		message := esbbridge.EsbMessage{Address: r.Send.Addr, Cmd: r.Send.Cmd[0], Payload: r.Send.Payload}
+		log.Printf("Session stream: send %v: %v", req.Id, message)
+		session.Send(ctx, req.Id, message)
+
+	case *pb.SessionRequest_Listen:
+		filters := make([]esbbridge.Filter, 0, len(r.Listen.Filters))
+		for _, f := range r.Listen.Filters {
+			filter, err := filterFromProto(f)
+			if err != nil {
+				return err
+			}
+			filters = append(filters, filter)
+		}
+		log.Printf("Session stream: listen for %v", filters)
+		return session.SetFilters(filters...)
+
+	default:
+		return fmt.Errorf("%w: empty session request", esbbridge.ErrInvalidParam)
+	}
+	return nil
+}
+
+// sessionEventToProto converts an event of a session
+func sessionEventToProto(event esbbridge.SessionEvent) *pb.SessionEvent {
+	msg := event.Message
+	out := &pb.SessionEvent{Seq: msg.Seq, Id: event.ID}
+	if !msg.Timestamp.IsZero() {
+		out.TimeUnixNano = msg.Timestamp.UnixNano()
+	}
+
+	switch event.Type {
+	case esbbridge.EventReceived:
+		out.Event = &pb.SessionEvent_Received{Received: messageToProto(msg)}
+	case esbbridge.EventAnswer:
+		out.Event = &pb.SessionEvent_Answer{Answer: messageToProto(msg)}
+	case esbbridge.EventSent:
+		out.Event = &pb.SessionEvent_Sent{Sent: &pb.SendResult{}}
+	default:
+		st := status.Convert(rpcError(event.Err))
+		sessionErr := &pb.SessionError{Code: int32(st.Code()), Message: st.Message()}
+		for _, d := range st.Details() {
+			if detail, ok := d.(*pb.ErrorDetail); ok {
+				sessionErr.Detail = detail
+			}
+		}
+		out.Event = &pb.SessionEvent_Error{Error: sessionErr}
+	}
+	return out
+}
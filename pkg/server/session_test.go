@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// TestSessionErrors tests that invalid session requests end the stream and failed requests are reported as events
+func TestSessionErrors(t *testing.T) {
+	e := emulator.New()
+	// the peripheral does not acknowledge messages
+	e.AddPeripheral(&emulator.Peripheral{Address: testAddress, Silent: true})
+	policy := &Policy{Clients: []ClientPolicy{{Name: "controller", Token: "controller-token",
+		RPCs: []string{"Session"}, Addresses: []string{"111.111.111.111"}}}}
+	s, client := startTestServer(t, e, Config{Policy: policy})
+	ctx, cancel := context.WithCancel(withToken("controller-token"))
+	defer cancel()
+	go s.Run(ctx)
+
+	transfer := func(addr []byte, cmd []byte) *pb.SessionRequest {
+		return &pb.SessionRequest{Id: 1, Request: &pb.SessionRequest_Transfer{
+			Transfer: &pb.EsbMessage{Addr: addr, Cmd: cmd}}}
+	}
+	listen := func(filters ...*pb.Filter) *pb.SessionRequest {
+		return &pb.SessionRequest{Request: &pb.SessionRequest_Listen{Listen: &pb.SessionFilters{Filters: filters}}}
+	}
+
+	cases := []struct {
+		name    string
+		request *pb.SessionRequest
+		code    codes.Code
+	}{
+		{"missing cmd", transfer(testAddress[:], nil), codes.InvalidArgument},
+		{"empty request", &pb.SessionRequest{}, codes.InvalidArgument},
+		{"invalid filter", listen(&pb.Filter{Addr: testAddress[:], AddrMask: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+			Cmds: []*pb.CmdRange{{First: 0x01, Last: 0x00}}}), codes.InvalidArgument},
+		{"policy transfer", transfer([]byte{9, 9, 9, 9, 9}, []byte{0x01}), codes.PermissionDenied},
+		{"policy filter", listen(&pb.Filter{}), codes.PermissionDenied},
+	}
+	for _, c := range cases {
+		stream, err := client.Session(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Send(c.request)
+		if _, err := stream.Recv(); status.Code(err) != c.code {
+			t.Fatalf("%v: expected status %v, got %v", c.name, c.code, err)
+		}
+	}
+
+	// a failed transfer does not end the stream
+	stream, err := client.Session(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []*pb.SessionRequest{transfer(testAddress[:], []byte{0x01}),
+		listen(&pb.Filter{Addr: testAddress[:4], AddrMask: []byte{0xFF, 0xFF, 0xFF, 0xFF}})} {
+		if err := stream.Send(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionErr := event.GetError()
+	if event.Id != 1 || codes.Code(sessionErr.GetCode()) != codes.Aborted ||
+		sessionErr.GetDetail().GetReason() != pb.ErrorReason_ERR_FIRMWARE {
+		t.Fatalf("Expected a failed transfer, got %v", event)
+	}
+}
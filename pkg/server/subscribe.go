@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/esbbridge"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// MaxSubscriptions limits the number of subscriptions on one Subscribe stream
+const MaxSubscriptions = 1024
+
+// subscriptions are the subscriptions of a Subscribe stream. They share one listener of the bridge, which receives
+// the messages matching any of their filters
+type subscriptions struct {
+	bridge  *esbbridge.Bridge
+	opts    esbbridge.ListenerOptions
+	channel chan esbbridge.EsbMessage
+	sub     *esbbridge.Subscription // created with the first subscription
+	filters map[uint32]esbbridge.Filter
+	ids     []uint32 // sorted
+}
+
+// Subscribe listens with the subscriptions added and removed by the client and streams the matching messages, tagged
+// with the IDs of the matching subscriptions. Messages arriving while a subscription is added or removed may be
+// missed or tagged without it
+func (s *esbBridgeServer) Subscribe(stream pb.EsbBridge_SubscribeServer) error {
+	streamDone := stream.Context().Done()
+
+	// requests are received by a goroutine, so the stream can be served while waiting for them
+	requests := make(chan *pb.SubscribeRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-streamDone:
+				return
+			}
+		}
+	}()
+
+	subs := &subscriptions{bridge: s.bridge, opts: s.listenerOptions, channel: make(chan esbbridge.EsbMessage),
+		filters: map[uint32]esbbridge.Filter{}}
+	defer subs.close()
+
+	for {
+		select {
+		case req := <-requests:
+			if err := subs.update(req); err != nil {
+				log.Printf("Subscribe stream: %v", err)
+				return rpcError(err)
+			}
+		case err := <-recvErr:
+			if err != io.EOF {
+				return err
+			}
+			// the client does not change the subscriptions anymore, but still receives messages
+			recvErr = nil
+		case <-subs.done():
+			log.Printf("Subscribe stream disconnected, client does not keep up")
+			return status.Error(codes.ResourceExhausted, "listener queue overflow, client does not keep up")
+		case msg := <-subs.channel:
+			ids := subs.match(msg)
+			if len(ids) == 0 {
+				continue
+			}
+			if msg.Dropped > 0 {
+				log.Printf("Subscribe stream: %v messages dropped, client does not keep up", msg.Dropped)
+			}
+			err := stream.Send(&pb.SubscribedMessage{Message: messageToProto(msg), SubscriptionIds: ids})
+			if err != nil {
+				return err
+			}
+		case <-streamDone:
+			log.Printf("Subscribe stream canceled by client")
+			return nil
+		case <-s.stopping:
+			log.Printf("Subscribe stream ended by server shutdown")
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+// update adds or removes a subscription. Removing an unknown subscription has no effect
+func (subs *subscriptions) update(req *pb.SubscribeRequest) error {
+	switch r := req.Request.(type) {
+	case *pb.SubscribeRequest_Add:
+		id := r.Add.Id
+		if _, ok := subs.filters[id]; ok {
+			return fmt.Errorf("%w: subscription %v exists", esbbridge.ErrInvalidParam, id)
+		}
+		if len(subs.filters) >= MaxSubscriptions {
+			return fmt.Errorf("%w: more than %v subscriptions", esbbridge.ErrInvalidParam, MaxSubscriptions)
+		}
+		var filter esbbridge.Filter
+		if r.Add.Filter != nil {
+			var err error
+			if filter, err = filterFromProto(r.Add.Filter); err != nil {
+				return err
+			}
+		}
+		log.Printf("Subscribe stream: add subscription %v for %v", id, filter)
+		subs.filters[id] = filter
+		subs.ids = append(subs.ids, id)
+		sort.Slice(subs.ids, func(i, j int) bool { return subs.ids[i] < subs.ids[j] })
+
+	case *pb.SubscribeRequest_Remove:
+		if _, ok := subs.filters[r.Remove]; !ok {
+			return nil
+		}
+		log.Printf("Subscribe stream: remove subscription %v", r.Remove)
+		delete(subs.filters, r.Remove)
+		for i, id := range subs.ids {
+			if id == r.Remove {
+				subs.ids = append(subs.ids[:i], subs.ids[i+1:]...)
+				break
+			}
+		}
+
+	default:
+		return fmt.Errorf("%w: empty subscribe request", esbbridge.ErrInvalidParam)
+	}
+
+	filters := make([]esbbridge.Filter, 0, len(subs.ids))
+	for _, id := range subs.ids {
+		filters = append(filters, subs.filters[id])
+	}
+	if subs.sub == nil {
+		// the first subscription was added
+		sub, err := subs.bridge.SubscribeFilter(filters[0], subs.channel, subs.opts)
+		subs.sub = sub
+		return err
+	}
+	return subs.sub.SetFilters(filters...)
+}
+
+// match returns the IDs of the subscriptions matching a message
+func (subs *subscriptions) match(msg esbbridge.EsbMessage) []uint32 {
+	var ids []uint32
+	for _, id := range subs.ids {
+		if subs.filters[id].Match(msg) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// done returns a channel which is closed when the listener of the subscriptions was disconnected. nil (blocking
+// forever) before the first subscription was added
+func (subs *subscriptions) done() <-chan struct{} {
+	if subs.sub == nil {
+		return nil
+	}
+	return subs.sub.Done()
+}
+
+// close removes the listener of the subscriptions
+func (subs *subscriptions) close() {
+	if subs.sub != nil {
+		subs.sub.Unsubscribe()
+	}
+}
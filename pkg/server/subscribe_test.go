@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spritkopf/esb-bridge/pkg/emulator"
+	pb "github.com/spritkopf/esb-bridge/pkg/server/service"
+)
+
+// addRequest returns a request which adds a subscription
+func addRequest(id uint32, filter *pb.Filter) *pb.SubscribeRequest {
+	return &pb.SubscribeRequest{Request: &pb.SubscribeRequest_Add{Add: &pb.Subscription{Id: id, Filter: filter}}}
+}
+
+// TestSubscribeErrors tests that invalid subscribe requests end the stream
+func TestSubscribeErrors(t *testing.T) {
+	policy := &Policy{Clients: []ClientPolicy{{Name: "dashboard", Token: "dashboard-token",
+		RPCs: []string{"Subscribe"}, Cmds: []uint8{0x01}}}}
+	s, client := startTestServer(t, emulator.New(), Config{Policy: policy})
+	ctx, cancel := context.WithCancel(withToken("dashboard-token"))
+	defer cancel()
+	go s.Run(ctx)
+
+	cmd1 := &pb.Filter{Cmds: []*pb.CmdRange{{First: 0x01, Last: 0x01}}}
+	cases := []struct {
+		name     string
+		requests []*pb.SubscribeRequest
+		code     codes.Code
+	}{
+		{"duplicate id", []*pb.SubscribeRequest{addRequest(1, cmd1), addRequest(1, cmd1)}, codes.InvalidArgument},
+		{"invalid filter", []*pb.SubscribeRequest{
+			addRequest(1, &pb.Filter{Cmds: []*pb.CmdRange{{First: 0x01, Last: 0x00}}})}, codes.InvalidArgument},
+		{"empty request", []*pb.SubscribeRequest{{}}, codes.InvalidArgument},
+		{"policy", []*pb.SubscribeRequest{addRequest(1, cmd1), addRequest(2, nil)}, codes.PermissionDenied},
+	}
+	for _, c := range cases {
+		stream, err := client.Subscribe(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, req := range c.requests {
+			if err := stream.Send(req); err != nil {
+				break
+			}
+		}
+		if _, err := stream.Recv(); status.Code(err) != c.code {
+			t.Fatalf("%v: expected status %v, got %v", c.name, c.code, err)
+		}
+	}
+}
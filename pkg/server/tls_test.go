@@ -0,0 +1,52 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spritkopf/esb-bridge/internal/testcert"
+)
+
+// TestTLSConfig tests the validation of the TLS configuration
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := testcert.NewCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key, err := ca.Issue("localhost", "localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := tlsConfig(Config{})
+	if config != nil || err != nil {
+		t.Fatalf("No TLS expected without certificate, got %v, %v", config, err)
+	}
+
+	for _, cfg := range []Config{
+		{TLSCert: cert, TLSKey: key},
+		{TLSCert: cert, TLSKey: key, TLSClientCA: ca.CertFile},
+	} {
+		config, err := tlsConfig(cfg)
+		if err != nil {
+			t.Fatalf("tlsConfig(%+v) failed: %v", cfg, err)
+		}
+		if len(config.Certificates) != 1 || (config.ClientCAs != nil) != (cfg.TLSClientCA != "") {
+			t.Fatalf("Unexpected TLS configuration for %+v", cfg)
+		}
+	}
+
+	for _, cfg := range []Config{
+		{TLSCert: cert},
+		{TLSKey: key},
+		{TLSClientCA: ca.CertFile},
+		{TLSCert: key, TLSKey: cert},
+		{TLSCert: cert, TLSKey: key, TLSClientCA: filepath.Join(dir, "missing.pem")},
+		{TLSCert: cert, TLSKey: key, TLSClientCA: key},
+	} {
+		if _, err := tlsConfig(cfg); err == nil {
+			t.Fatalf("tlsConfig(%+v) should fail", cfg)
+		}
+	}
+}